@@ -0,0 +1,73 @@
+package pbxproj
+
+import (
+	"testing"
+
+	"github.com/soapywu/pbxproj/pegparser"
+)
+
+func TestAddXCConfigurationList(t *testing.T) {
+	p := loadExampleProject(t)
+	configurations := []pegparser.Object{
+		pegparser.NewObjectWithData([]pegparser.SliceItem{pegparser.NewObjectItem("name", "Debug")}),
+		pegparser.NewObjectWithData([]pegparser.SliceItem{pegparser.NewObjectItem("name", "Release")}),
+	}
+	list := p.addXCConfigurationList(configurations, "Release", "Build configuration list")
+
+	buildConfigurations, ok := p.pbxXCConfigurationListSection.GetObject(list.UUID).ForceGet("buildConfigurations").([]interface{})
+	if !ok {
+		t.Fatalf("buildConfigurations = %#v, want a list", list.ForceGet("buildConfigurations"))
+	}
+	if len(buildConfigurations) != len(configurations) {
+		t.Fatalf("buildConfigurations = %v, want %d entries", buildConfigurations, len(configurations))
+	}
+	for i, entry := range buildConfigurations {
+		configuration := entry.(pegparser.Object)
+		if got, want := configuration.GetString("comment"), configurations[i].GetString("name"); got != want {
+			t.Errorf("buildConfigurations[%d] comment = %q, want %q", i, got, want)
+		}
+		if !p.pbxXCBuildConfigurationSection.Has(configuration.GetString("value")) {
+			t.Errorf("buildConfigurations[%d] = %s is not in the XCBuildConfiguration section", i, configuration.GetString("value"))
+		}
+	}
+}
+
+func TestConfigurationList(t *testing.T) {
+	tests := []struct {
+		target      string
+		wantUUID    string
+		wantDefault string
+		wantOK      bool
+	}{
+		{"DWebBrowser", "046BD66627EC518A0044E784", "Release", true},
+		{"DWebBrowserTests", "046BD66927EC518A0044E784", "Release", true},
+		{"Missing", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			list, ok := loadExampleProject(t).ConfigurationList(tt.target)
+			if ok != tt.wantOK || list.UUID != tt.wantUUID {
+				t.Fatalf("ConfigurationList(%q) = %s, %v, want %s, %v", tt.target, list.UUID, ok, tt.wantUUID, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got := list.GetString("defaultConfigurationName"); got != tt.wantDefault {
+				t.Errorf("defaultConfigurationName = %q, want %q", got, tt.wantDefault)
+			}
+			if got := listValues(list.Object, "buildConfigurations"); len(got) != 2 {
+				t.Errorf("buildConfigurations = %v, want Debug and Release", got)
+			}
+		})
+	}
+
+	// new targets get a list too
+	p := loadExampleProject(t)
+	if err := p.AddTarget("Kit", "framework", "Kit", ""); err != nil {
+		t.Fatal(err)
+	}
+	list, ok := reparse(t, p).ConfigurationList("Kit")
+	if !ok || list.GetString("defaultConfigurationName") != "Release" {
+		t.Errorf("ConfigurationList(Kit) = %v, %v, want a list defaulting to Release", list.Object, ok)
+	}
+}
@@ -0,0 +1,338 @@
+package pbxproj
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/soapywu/pbxproj/pegparser"
+)
+
+func TestInitSectionsGroupSection(t *testing.T) {
+	p := loadExampleProject(t)
+	for _, key := range []string{exampleMainGroupKey, exampleProductsGroupKey} {
+		if !p.pbxGroupSection.Has(key) {
+			t.Errorf("pbxGroupSection misses group %s", key)
+		}
+	}
+	if p.pbxGroupByName("Products").IsEmpty() {
+		t.Error(`pbxGroupByName("Products") found nothing`)
+	}
+}
+
+func TestAddToPbxGroup(t *testing.T) {
+	p := loadExampleProject(t)
+	pbxfile := newPbxFile("Foo.swift", newPbxFileOptions())
+	pbxfile.FileRef = p.generateUuid()
+	p.addToPbxGroup(pbxfile, "Products")
+
+	children, _ := p.pbxGroupByName("Products").ForceGet("children").([]interface{})
+	child, ok := children[len(children)-1].(pegparser.Object)
+	if !ok {
+		t.Fatalf("children ends with %#v, want an object", children[len(children)-1])
+	}
+	if got := child.GetString("value"); got != pbxfile.FileRef {
+		t.Errorf("child value = %q, want %q", got, pbxfile.FileRef)
+	}
+	if got := child.GetString("comment"); got != "Foo.swift" {
+		t.Errorf("child comment = %q, want %q", got, "Foo.swift")
+	}
+}
+
+func TestFindPBXGroupKey(t *testing.T) {
+	p := loadExampleProject(t)
+	tests := []struct {
+		name     string
+		criteria FindGroupCriteria
+		want     string
+	}{
+		{"by name", FindGroupCriteria{Name: "Products"}, exampleProductsGroupKey},
+		{"by quoted name", FindGroupCriteria{Name: `"Products"`}, exampleProductsGroupKey},
+		{"by path", FindGroupCriteria{Path: "DWebBrowser"}, "046BD63E27EC51880044E784"},
+		{"by quoted path", FindGroupCriteria{Path: `"DWebBrowserTests"`}, "046BD65527EC518A0044E784"},
+		{"by name and path", FindGroupCriteria{Name: "Products", Path: "DWebBrowser"}, ""},
+		{"missing", FindGroupCriteria{Name: "Missing"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.findPBXGroupKey(tt.criteria); got != tt.want {
+				t.Errorf("findPBXGroupKey(%+v) = %q, want %q", tt.criteria, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPbxCreateGroup(t *testing.T) {
+	tests := []struct {
+		groupType string
+		create    func(p *PbxProject) string
+	}{
+		{"PBXGroup", func(p *PbxProject) string { return p.pbxCreateGroup("Group", "Group") }},
+		{"PBXVariantGroup", func(p *PbxProject) string { return p.pbxCreateVariantGroup("Group") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.groupType, func(t *testing.T) {
+			p := loadExampleProject(t)
+			key := tt.create(p)
+			section := p.pbxObjectSection.GetObject(tt.groupType)
+			if got := section.GetObject(key).GetString("isa"); got != tt.groupType {
+				t.Errorf("isa = %q, want %q", got, tt.groupType)
+			}
+			if got := section.GetString(toCommentKey(key)); got != "Group" {
+				t.Errorf("comment = %q, want %q", got, "Group")
+			}
+			if p.pbxGroupSection.Has(tt.groupType) {
+				t.Errorf("pbxGroupSection got a nested %s section", tt.groupType)
+			}
+		})
+	}
+}
+
+func TestAddFileToGroupByKey(t *testing.T) {
+	p := loadExampleProject(t)
+	pbxfile, err := p.addFile("Foo.swift", exampleProductsGroupKey, newPbxFileOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	isChild := func() bool {
+		children, _ := p.getPBXGroupByKey(exampleProductsGroupKey).ForceGet("children").([]interface{})
+		for _, child := range children {
+			if child, ok := child.(pegparser.Object); ok && child.GetString("value") == pbxfile.FileRef {
+				return true
+			}
+		}
+		return false
+	}
+	if !isChild() {
+		t.Errorf("Products children miss %s", pbxfile.FileRef)
+	}
+	if !p.pbxGroupByName(exampleProductsGroupKey).IsEmpty() {
+		t.Errorf("a group named %s was created", exampleProductsGroupKey)
+	}
+
+	p.removeFile("Foo.swift", exampleProductsGroupKey, newPbxFileOptions())
+	if isChild() {
+		t.Errorf("Products children still list %s", pbxfile.FileRef)
+	}
+}
+
+func TestGroupChildrenAreWrittenWithComments(t *testing.T) {
+	tests := []struct {
+		name string
+		add  func(p *PbxProject) (key, comment string)
+	}{
+		{"variant group member", func(p *PbxProject) (string, string) {
+			groupKey := p.pbxCreateVariantGroup("Main.storyboard")
+			pbxfile := newPbxFile("fr.lproj/Main.storyboard", newPbxFileOptions())
+			pbxfile.FileRef = p.generateUuid()
+			p.addToPbxVariantGroup(pbxfile, groupKey)
+			return pbxfile.FileRef, "Main.storyboard"
+		}},
+		{"localization variant group", func(p *PbxProject) (string, string) {
+			p.pbxCreateGroup("Resources", "")
+			variantGroup := p.AddLocalizationVariantGroup("Localizable.strings")
+			return variantGroup.FileRef, "Localizable.strings"
+		}},
+		{"group member", func(p *PbxProject) (string, string) {
+			pbxfile := newPbxFile("Foo.swift", newPbxFileOptions())
+			pbxfile.FileRef = p.generateUuid()
+			p.addToPbxGroupByKey(pbxfile, exampleProductsGroupKey)
+			return pbxfile.FileRef, "Foo.swift"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			key, comment := tt.add(p)
+			want := "\t\t\t\t" + key + " /* " + comment + " */,\n"
+			if data := string(NewPbxWriter(p).Bytes()); !strings.Contains(data, want) {
+				t.Errorf("output lacks the child line %q", want)
+			}
+		})
+	}
+}
+
+func TestAddAndRemoveFileFromGroupKey(t *testing.T) {
+	const appDelegateRef = "046BD63F27EC51880044E784"
+	childValues := func(p *PbxProject, groupKey string) []string {
+		group := p.getPBXGroupByKey(groupKey)
+		if group.IsEmpty() {
+			group = p.getPBXVariantGroupByKey(groupKey)
+		}
+		return listValues(group, "children")
+	}
+	tests := []struct {
+		name    string
+		file    func(p *PbxProject) interface{}
+		variant bool
+	}{
+		{"new path", func(p *PbxProject) interface{} { return "New.swift" }, false},
+		{"known path", func(p *PbxProject) interface{} { return "AppDelegate.swift" }, false},
+		{"pbxfile", func(p *PbxProject) interface{} { return p.getFile("AppDelegate.swift") }, false},
+		{"new path in variant group", func(p *PbxProject) interface{} { return "fr.lproj/New.strings" }, true},
+		{"pbxfile in variant group", func(p *PbxProject) interface{} { return p.getFile("AppDelegate.swift") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			groupKey := exampleProductsGroupKey
+			if tt.variant {
+				groupKey = p.pbxCreateVariantGroup("New.strings")
+			}
+			file := tt.file(p)
+			if err := p.AddFileToGroupKey(file, groupKey); err != nil {
+				t.Fatal(err)
+			}
+			pbxfile, ok := file.(*PbxFile)
+			if !ok {
+				pbxfile = p.getFile(file.(string))
+			}
+			if pbxfile == nil || !containsString(childValues(p, groupKey), pbxfile.FileRef) {
+				t.Fatalf("children of %s = %v, want %v added", groupKey, childValues(p, groupKey), file)
+			}
+
+			if err := p.RemoveFileFromGroupKey(file, groupKey); err != nil {
+				t.Fatal(err)
+			}
+			if containsString(childValues(p, groupKey), pbxfile.FileRef) {
+				t.Errorf("children of %s still list %s", groupKey, pbxfile.FileRef)
+			}
+			if !p.pbxFileReferenceSection.Has(pbxfile.FileRef) {
+				t.Errorf("file reference %s was removed", pbxfile.FileRef)
+			}
+		})
+	}
+
+	p := loadExampleProject(t)
+	errorTests := []struct {
+		name     string
+		file     interface{}
+		groupKey string
+	}{
+		{"missing group", "New.swift", "000000000000000000000000"},
+		{"unsupported file", 42, exampleProductsGroupKey},
+	}
+	for _, tt := range errorTests {
+		if err := p.AddFileToGroupKey(tt.file, tt.groupKey); err == nil {
+			t.Errorf("%s: AddFileToGroupKey succeeded", tt.name)
+		}
+		if err := p.RemoveFileFromGroupKey(tt.file, tt.groupKey); err == nil {
+			t.Errorf("%s: RemoveFileFromGroupKey succeeded", tt.name)
+		}
+	}
+	if err := p.RemoveFileFromGroupKey("Missing.swift", exampleProductsGroupKey); err == nil {
+		t.Error("removing an unknown path succeeded")
+	}
+	if !containsString(listValues(p.getPBXGroupByKey("046BD63E27EC51880044E784"), "children"), appDelegateRef) {
+		t.Error("AppDelegate.swift left its group")
+	}
+}
+
+func TestResourceFileGroupKey(t *testing.T) {
+	const appGroupKey = "046BD63E27EC51880044E784"
+	p := loadExampleProject(t)
+	want := string(NewPbxWriter(p).Bytes())
+	if err := p.AddResourceFile("Extra.json", PbxFileOptions{}, appGroupKey); err != nil {
+		t.Fatal(err)
+	}
+	fileReference, ok := p.FileReferenceByPath("Extra.json")
+	if !ok {
+		t.Fatal("no file reference to Extra.json")
+	}
+	if !containsString(listValues(p.getPBXGroupByKey(appGroupKey), "children"), fileReference.UUID) {
+		t.Error("Extra.json is not a child of the group")
+	}
+	if !p.pbxGroupByName(appGroupKey).IsEmpty() {
+		t.Errorf("a group named %s was created", appGroupKey)
+	}
+
+	if err := p.RemoveResourceFile("Extra.json", PbxFileOptions{}, appGroupKey); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(NewPbxWriter(p).Bytes()); got != want {
+		t.Error("output after removing Extra.json differs from the example project")
+	}
+}
+
+func TestAddPbxGroupSection(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(p *PbxProject)
+	}{
+		{"existing group section", func(p *PbxProject) {}},
+		{"empty group section", func(p *PbxProject) {
+			p.pbxGroupSection.Clear()
+		}},
+		{"missing group section", func(p *PbxProject) {
+			p.pbxObjectSection.Delete("PBXGroup")
+			p.initSections()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			tt.setup(p)
+			p.AddPbxGroup([]string{"AppDelegate.swift", "Extra.swift"}, "Extra", "Extra", "")
+
+			p = reparse(t, p)
+			key := p.findPBXGroupKey(FindGroupCriteria{Name: "Extra"})
+			if key == "" {
+				t.Fatal("group Extra missing")
+			}
+			if got := p.pbxGroupSection.GetString(toCommentKey(key)); got != "Extra" {
+				t.Errorf("group comment = %q, want Extra", got)
+			}
+			group := p.getPBXGroupByKey(key)
+			if got := group.GetString("path"); got != "Extra" {
+				t.Errorf("path = %q, want Extra", got)
+			}
+			children := listValues(group, "children")
+			if len(children) != 2 || children[0] != "046BD63F27EC51880044E784" {
+				t.Errorf("children = %v, want the AppDelegate.swift reference and a new one", children)
+			}
+		})
+	}
+}
+
+func TestAddFileToGroupAtIndex(t *testing.T) {
+	const appGroupKey = "046BD63E27EC51880044E784"
+	tests := []struct {
+		name  string
+		index int
+		want  int
+	}{
+		{"first", 0, 0},
+		{"middle", 5, 5},
+		{"last", 11, 11},
+		{"after the last", 12, 12},
+		{"out of range", 100, 12},
+		{"negative", -1, 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			before := listValues(p.getPBXGroupByKey(appGroupKey), "children")
+			if err := p.AddFileToGroupAtIndex("Extra.swift", appGroupKey, tt.index, PbxFileOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			p = reparse(t, p)
+			fileReference, ok := p.FileReferenceByPath("Extra.swift")
+			if !ok {
+				t.Fatal("file reference missing")
+			}
+			children := listValues(p.getPBXGroupByKey(appGroupKey), "children")
+			if len(children) != len(before)+1 || children[tt.want] != fileReference.UUID {
+				t.Fatalf("children = %v, want %s at %d", children, fileReference.UUID, tt.want)
+			}
+			// the other children keep their order
+			others := append(append([]string{}, children[:tt.want]...), children[tt.want+1:]...)
+			if strings.Join(others, ",") != strings.Join(before, ",") {
+				t.Errorf("other children = %v, want %v", others, before)
+			}
+		})
+	}
+
+	if err := loadExampleProject(t).AddFileToGroupAtIndex("Extra.swift", "AA0000000000000000000001", 0, PbxFileOptions{}); err == nil {
+		t.Error("adding to a missing group succeeded")
+	}
+}
@@ -1,7 +1,9 @@
 package pbxproj
 
 import (
+	"math"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -35,10 +37,14 @@ func toString(obj interface{}) string {
 	return obj.(string)
 }
 
+// isInt also accepts integral floats, encoding/json decodes every number as float64
 func isInt(obj interface{}) bool {
 	switch obj.(type) {
 	case int, int8, int16, int32, int64:
 		return true
+	case float32, float64:
+		f := reflect.ValueOf(obj).Float()
+		return f == math.Trunc(f)
 	}
 	return false
 }
@@ -46,11 +52,27 @@ func toIntString(obj interface{}) string {
 	switch obj.(type) {
 	case int, int8, int16, int32, int64:
 		return strconv.FormatInt(reflect.ValueOf(obj).Int(), 10)
+	case float32, float64:
+		return strconv.FormatInt(int64(reflect.ValueOf(obj).Float()), 10)
 	}
 
 	return ""
 }
 
+var unquotedStringRegex = regexp.MustCompile(`^[A-Za-z0-9_./]+$`)
+
+// quoteIfNeeded quotes s the way Xcode does: only when it is empty or contains
+// characters other than letters, digits, '_', '.' and '/'. Already quoted strings are kept as is.
+func quoteIfNeeded(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return s
+	}
+	if unquotedStringRegex.MatchString(s) {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
 func toCommentKey(key string) string {
 	return key + COMMENT_KEY_SUFFIX
 }
@@ -100,6 +122,38 @@ func stringToInterfaceSlice(val []string) []interface{} {
 	return result
 }
 
+func toBuildSettingValue(val interface{}) interface{} {
+	switch val := val.(type) {
+	case bool:
+		if val {
+			return "YES"
+		}
+		return "NO"
+	case int, int8, int16, int32, int64:
+		return val
+	case float32, float64:
+		// keep a fractional digit so 5.0 isn't written as 5
+		s := strconv.FormatFloat(reflect.ValueOf(val).Float(), 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	case string:
+		// quoteIfNeeded leaves an already quoted value, escapes and all, as it is
+		return quoteIfNeeded(val)
+	case []string:
+		return toBuildSettingValue(stringToInterfaceSlice(val))
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, v := range val {
+			result[i] = toBuildSettingValue(v)
+		}
+		return result
+	default:
+		return val
+	}
+}
+
 func addToObjectList(obj pegparser.Object, key string, val interface{}) {
 	if obj.IsEmpty() {
 		return
@@ -113,6 +167,23 @@ func addToObjectList(obj pegparser.Object, key string, val interface{}) {
 	obj.Set(key, list)
 }
 
+// insertToObjectList inserts val at index, an index out of range appends it.
+func insertToObjectList(obj pegparser.Object, key string, val interface{}, index int) {
+	if obj.IsEmpty() {
+		return
+	}
+	list, _ := obj.ForceGet(key).([]interface{})
+	if index < 0 || index >= len(list) {
+		obj.Set(key, append(list, val))
+		return
+	}
+	inserted := make([]interface{}, 0, len(list)+1)
+	inserted = append(inserted, list[:index]...)
+	inserted = append(inserted, val)
+	inserted = append(inserted, list[index:]...)
+	obj.Set(key, inserted)
+}
+
 func addToObjectListOnlyNotExist(obj pegparser.Object, key string, val interface{}, equal func(v1, v2 interface{}) bool) {
 	if obj.IsEmpty() {
 		return
@@ -140,14 +211,16 @@ func removeFromObjectList(obj pegparser.Object, key string, condition func(inter
 		return
 	}
 
-	for i, v := range list.([]interface{}) {
-		if condition(v) {
-			list = append(list.([]interface{})[:i], list.([]interface{})[i+1:]...)
-			if !all {
-				break
-			}
+	// build a new list, removing in place would skip the entry following each removed one
+	kept := []interface{}{}
+	removed := false
+	for _, v := range list.([]interface{}) {
+		if (all || !removed) && condition(v) {
+			removed = true
+			continue
 		}
+		kept = append(kept, v)
 	}
 
-	obj.Set(key, list)
+	obj.Set(key, kept)
 }
@@ -0,0 +1,189 @@
+package pbxproj
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/soapywu/pbxproj/pegparser"
+)
+
+const exampleProjectPath = "../example/project.pbxproj"
+
+// example project keys
+const (
+	exampleProjectKey       = "046BD63427EC51880044E784"
+	exampleMainGroupKey     = "046BD63327EC51880044E784"
+	exampleProductsGroupKey = "046BD63D27EC51880044E784"
+	exampleAppTargetKey     = "046BD63B27EC51880044E784"
+	exampleTestsTargetKey   = "046BD65127EC518A0044E784"
+)
+
+func loadProject(t *testing.T, path string) *PbxProject {
+	t.Helper()
+	project := NewPbxProject(path)
+	if err := project.Parse(); err != nil {
+		t.Fatalf("parse %s: %v", path, err)
+	}
+	return &project
+}
+
+func loadExampleProject(t *testing.T) *PbxProject {
+	t.Helper()
+	return loadProject(t, exampleProjectPath)
+}
+
+// reparse writes the project and parses the output again, so assertions see what ends up on disk.
+func reparse(t *testing.T, p *PbxProject) *PbxProject {
+	t.Helper()
+	data := NewPbxWriter(p).Bytes()
+	project := NewPbxProject("")
+	if err := project.ReparseBytes(data); err != nil {
+		t.Fatalf("reparse: %v\n%s", err, data)
+	}
+	return &project
+}
+
+func listValues(obj pegparser.Object, key string) []string {
+	list, _ := obj.ForceGet(key).([]interface{})
+	values := []string{}
+	for _, entry := range list {
+		if o, ok := entry.(pegparser.Object); ok {
+			values = append(values, o.GetString("value"))
+		} else if s, ok := entry.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFixture writes data to dir/name, creating the parent directories.
+func writeFixture(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readExampleProject(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(exampleProjectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// loadExampleProjectWith parses the example project after replacing each old, new pair of replacements once.
+func loadExampleProjectWith(t *testing.T, replacements ...string) *PbxProject {
+	t.Helper()
+	data := string(readExampleProject(t))
+	for i := 0; i+1 < len(replacements); i += 2 {
+		if !strings.Contains(data, replacements[i]) {
+			t.Fatalf("example project does not contain %q", replacements[i])
+		}
+		data = strings.Replace(data, replacements[i], replacements[i+1], 1)
+	}
+	project := NewPbxProject(exampleProjectPath)
+	if err := project.ReparseBytes([]byte(data)); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return &project
+}
+
+func TestQuoteIfNeeded(t *testing.T) {
+	// the expectations are taken from files written by Xcode
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"AppDelegate.swift", "AppDelegate.swift"},
+		{"DWebBrowser/Info.plist", "DWebBrowser/Info.plist"},
+		{"iphoneos", "iphoneos"},
+		{"5.0", "5.0"},
+		{"en", "en"},
+		{"BUILT_PRODUCTS_DIR", "BUILT_PRODUCTS_DIR"},
+		{"", `""`},
+		{"<group>", `"<group>"`},
+		{"zh-Hans", `"zh-Hans"`},
+		{"My App", `"My App"`},
+		{"$(inherited)", `"$(inherited)"`},
+		{"@executable_path/Frameworks", `"@executable_path/Frameworks"`},
+		{"com.apple.product-type.application", `"com.apple.product-type.application"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`"already quoted"`, `"already quoted"`},
+	}
+	for _, tt := range tests {
+		if got := quoteIfNeeded(tt.in); got != tt.want {
+			t.Errorf("quoteIfNeeded(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsInt(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{int64(2147483647), "2147483647"},
+		{2147483647, "2147483647"},
+		{float64(2147483647), "2147483647"},
+		{float32(8), "8"},
+		{float64(-1), "-1"},
+		{1.5, ""},
+		{"8", ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := isInt(tt.in); got != (tt.want != "") {
+			t.Errorf("isInt(%#v) = %v, want %v", tt.in, got, tt.want != "")
+		}
+		if tt.want != "" {
+			if got := toIntString(tt.in); got != tt.want {
+				t.Errorf("toIntString(%#v) = %q, want %q", tt.in, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestRemoveFromObjectList(t *testing.T) {
+	isA := func(v interface{}) bool { return v == "a" }
+	tests := []struct {
+		name string
+		list []interface{}
+		all  bool
+		want []interface{}
+	}{
+		{"adjacent duplicates", []interface{}{"a", "a", "b", "a", "a"}, true, []interface{}{"b"}},
+		{"only matches", []interface{}{"a", "a", "a"}, true, []interface{}{}},
+		{"first match", []interface{}{"b", "a", "a"}, false, []interface{}{"b", "a"}},
+		{"no match", []interface{}{"b", "c"}, true, []interface{}{"b", "c"}},
+		{"empty", []interface{}{}, true, []interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := pegparser.NewObject()
+			obj.Set("files", tt.list)
+			removeFromObjectList(obj, "files", isA, tt.all)
+			if got := obj.ForceGet("files").([]interface{}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
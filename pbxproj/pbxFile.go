@@ -20,6 +20,7 @@ package pbxproj
 import (
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/soapywu/pbxproj/pegparser"
 )
@@ -33,29 +34,30 @@ const (
 )
 
 var FILETYPE_BY_EXTENSION = map[string]string{
-	"a":           "archive.ar",
-	"app":         "wrapper.application",
-	"appex":       "wrapper.app-extension",
-	"bundle":      "wrapper.plug-in",
-	"dylib":       "compiled.mach-o.dylib",
-	"framework":   "wrapper.framework",
-	"h":           "sourcecode.c.h",
-	"m":           "sourcecode.c.objc",
-	"markdown":    "text",
-	"mdimporter":  "wrapper.cfbundle",
-	"octest":      "wrapper.cfbundle",
-	"pch":         "sourcecode.c.h",
-	"plist":       "text.plist.xml",
-	"sh":          "text.script.sh",
-	"swift":       "sourcecode.swift",
-	"tbd":         "sourcecode.text-based-dylib-definition",
-	"xcassets":    "folder.assetcatalog",
-	"xcconfig":    "text.xcconfig",
-	"xcdatamodel": "wrapper.xcdatamodel",
-	"xcodeproj":   "wrapper.pb-project",
-	"xctest":      "wrapper.cfbundle",
-	"xib":         "file.xib",
-	"strings":     "text.plist.strings",
+	"a":            "archive.ar",
+	"app":          "wrapper.application",
+	"appex":        "wrapper.app-extension",
+	"bundle":       "wrapper.plug-in",
+	"dylib":        "compiled.mach-o.dylib",
+	"entitlements": "text.plist.entitlements",
+	"framework":    "wrapper.framework",
+	"h":            "sourcecode.c.h",
+	"m":            "sourcecode.c.objc",
+	"markdown":     "text",
+	"mdimporter":   "wrapper.cfbundle",
+	"octest":       "wrapper.cfbundle",
+	"pch":          "sourcecode.c.h",
+	"plist":        "text.plist.xml",
+	"sh":           "text.script.sh",
+	"swift":        "sourcecode.swift",
+	"tbd":          "sourcecode.text-based-dylib-definition",
+	"xcassets":     "folder.assetcatalog",
+	"xcconfig":     "text.xcconfig",
+	"xcdatamodel":  "wrapper.xcdatamodel",
+	"xcodeproj":    "wrapper.pb-project",
+	"xctest":       "wrapper.cfbundle",
+	"xib":          "file.xib",
+	"strings":      "text.plist.strings",
 }
 
 func revertMap(m map[string]string) map[string]string {
@@ -74,6 +76,7 @@ var GROUP_BY_FILETYPE = map[string]string{
 	"sourcecode.text-based-dylib-definition": "Frameworks",
 	"wrapper.framework":                      "Frameworks",
 	"embedded.framework":                     "Embed Frameworks",
+	"folder.assetcatalog":                    "Resources",
 	"sourcecode.c.h":                         "Resources",
 	"sourcecode.c.objc":                      "Sources",
 	"sourcecode.swift":                       "Sources",
@@ -121,14 +124,23 @@ type PbxFileOptions struct {
 	SourceTree        string
 	Weak              bool
 	CompilerFlags     string
-	Embed             bool
-	Sign              bool
-	Target            string
-	Group             string
-	Plugin            bool
-	VariantGroup      bool
-	IncludeInIndex    int
-	Link              bool
+	// Embed copies the file into the bundle. It is re-signed on copy (CodeSignOnCopy)
+	// only when Sign is set too, frameworks that must keep their signature leave it off
+	Embed          bool
+	Sign           bool
+	Target         string
+	Group          string
+	Plugin         bool
+	VariantGroup   bool
+	IncludeInIndex int
+	Link           bool
+	// Static marks a static .framework, which is linked but never embedded
+	Static bool
+	// Attributes are added to the build file's ATTRIBUTES, e.g. RemoveHeadersOnCopy
+	Attributes []string
+	// Destination picks the copy files phase of AddCopyfile by destination, e.g. frameworks
+	// or shared_support, instead of the "Copy Files" phase
+	Destination string
 }
 
 func newPbxFileOptions() PbxFileOptions {
@@ -206,10 +218,7 @@ func newPbxFile(filePath string, options PbxFileOptions) *PbxFile {
 	}
 
 	if options.Weak {
-		if pbxfile.Settings.IsEmpty() {
-			pbxfile.Settings = pegparser.NewObject()
-		}
-		addToObjectList(pbxfile.Settings, "ATTRIBUTES", "Weak")
+		pbxfile.addAttribute("Weak")
 	}
 
 	if options.CompilerFlags != "" {
@@ -219,25 +228,43 @@ func newPbxFile(filePath string, options PbxFileOptions) *PbxFile {
 		pbxfile.Settings.Set("COMPILER_FLAGS", "\""+options.CompilerFlags+"\"")
 	}
 
+	// Embed without Sign copies the file untouched
 	if options.Embed && options.Sign {
-		if pbxfile.Settings.IsEmpty() {
-			pbxfile.Settings = pegparser.NewObject()
-		}
-		addToObjectList(pbxfile.Settings, "ATTRIBUTES", "CodeSignOnCopy")
+		pbxfile.addAttribute("CodeSignOnCopy")
+	}
+
+	for _, attr := range options.Attributes {
+		pbxfile.addAttribute(attr)
 	}
 	return &pbxfile
 }
 
+// addAttribute appends attr to the ATTRIBUTES of the build file settings.
+// addToObjectList can't be used here, it ignores the still empty settings object.
+func (pbxfile *PbxFile) addAttribute(attr string) {
+	if pbxfile.Settings.IsEmpty() {
+		pbxfile.Settings = pegparser.NewObject()
+	}
+	attributes, _ := pbxfile.Settings.ForceGet("ATTRIBUTES").([]interface{})
+	for _, v := range attributes {
+		if v == attr {
+			return
+		}
+	}
+	pbxfile.Settings.Set("ATTRIBUTES", append(attributes, attr))
+}
+
 func fromObject(obj pegparser.Object) *PbxFile {
 	option := PbxFileOptions{
-		LastKnownFileType: obj.GetString("lastKnownFileType"),
+		LastKnownFileType: unquoted(obj.GetString("lastKnownFileType")),
 		DefaultEncoding:   obj.GetInt("fileEncoding"),
-		ExplicitFileType:  obj.GetString("explicitFileType"),
+		ExplicitFileType:  unquoted(obj.GetString("explicitFileType")),
 		SourceTree:        obj.GetString("sourceTree"),
 		IncludeInIndex:    obj.GetInt("includeInIndex"),
 		Link:              true,
 	}
-	filePath := obj.GetString("path")
+	// paths with spaces or special characters are stored quoted
+	filePath := unquoted(obj.GetString("path"))
 	settings := obj.GetObject("settings")
 	if !settings.IsEmpty() {
 		option.CompilerFlags = unquoted(settings.GetString("COMPILER_FLAGS"))
@@ -261,7 +288,7 @@ func (pbxfile *PbxFile) defaultExtension() string {
 }
 
 func (pbxfile *PbxFile) detectType(filePath string) string {
-	extension := filepath.Ext(filePath)[1:]
+	extension := strings.TrimPrefix(filepath.Ext(filePath), ".")
 	filetype, found := FILETYPE_BY_EXTENSION[unquoted(extension)]
 
 	if !found {
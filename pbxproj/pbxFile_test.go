@@ -0,0 +1,53 @@
+package pbxproj
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectType(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"main.m", "sourcecode.c.objc"},
+		{"Sources/App.swift", "sourcecode.swift"},
+		{"libz.tbd", "sourcecode.text-based-dylib-definition"},
+		{"notes.unknownext", DEFAULT_FILETYPE},
+		{"Makefile", DEFAULT_FILETYPE},
+		{"Sources/LICENSE", DEFAULT_FILETYPE},
+	}
+	for _, tt := range tests {
+		if got := (&PbxFile{}).detectType(tt.path); got != tt.want {
+			t.Errorf("detectType(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNewPbxFileAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		options PbxFileOptions
+		want    []interface{}
+	}{
+		{"embed and sign", PbxFileOptions{Embed: true, Sign: true}, []interface{}{"CodeSignOnCopy"}},
+		{"embed without sign", PbxFileOptions{Embed: true}, nil},
+		{"sign without embed", PbxFileOptions{Sign: true}, nil},
+		{"weak", PbxFileOptions{Weak: true}, []interface{}{"Weak"}},
+		{"weak embed and sign", PbxFileOptions{Weak: true, Embed: true, Sign: true}, []interface{}{"Weak", "CodeSignOnCopy"}},
+		{"attributes", PbxFileOptions{Attributes: []string{"RemoveHeadersOnCopy"}}, []interface{}{"RemoveHeadersOnCopy"}},
+		{"attributes and sign", PbxFileOptions{Embed: true, Sign: true, Attributes: []string{"RemoveHeadersOnCopy"}},
+			[]interface{}{"CodeSignOnCopy", "RemoveHeadersOnCopy"}},
+		{"duplicate attributes", PbxFileOptions{Weak: true, Attributes: []string{"Weak", "Public", "Public"}}, []interface{}{"Weak", "Public"}},
+		{"none", PbxFileOptions{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pbxfile := newPbxFile("Kit.framework", tt.options)
+			got, _ := pbxfile.Settings.ForceGet("ATTRIBUTES").([]interface{})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ATTRIBUTES = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -25,7 +25,10 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/gofrs/uuid"
 	"github.com/soapywu/pbxproj/pegparser"
@@ -46,7 +49,13 @@ func (c CommentValue) ToObject() pegparser.Object {
 type PbxProjectWriterOption struct {
 }
 
+// PbxProject methods do not lock, only View and Update take mu. After Parse, methods that
+// only read, e.g. Groups, FileReferenceByPath or ObjectsByISA, may be called concurrently as
+// long as nothing modifies the project. Once any goroutine modifies it, all concurrent access,
+// reads included, must go through View and Update: View calls run concurrently with each
+// other, Update excludes every View and Update. View, Update and Parse can be used on the zero value.
 type PbxProject struct {
+	mu                             sync.RWMutex
 	filePath                       string
 	pbxContents                    pegparser.Object
 	topProjectSection              pegparser.Object
@@ -73,21 +82,117 @@ func NewPbxProject(filename string) PbxProject {
 	}
 }
 
+// Reset clears all parsed contents, cached sections and uuids so the project
+// can be parsed again, e.g. after SetFilePath.
+func (p *PbxProject) Reset() {
+	// field by field, overwriting mu would break a Reset run by Update
+	p.pbxContents = pegparser.Object{}
+	p.topProjectSection = pegparser.Object{}
+	p.pbxObjectSection = pegparser.Object{}
+	p.pbxGroupSection = pegparser.Object{}
+	p.pbxProjectSection = pegparser.Object{}
+	p.pbxBuildFileSection = pegparser.Object{}
+	p.pbxXCBuildConfigurationSection = pegparser.Object{}
+	p.pbxFileReferenceSection = pegparser.Object{}
+	p.pbxNativeTargetSection = pegparser.Object{}
+	p.xcVersionGroupSection = pegparser.Object{}
+	p.pbxXCConfigurationListSection = pegparser.Object{}
+	p.pbxTargetDependencySection = pegparser.Object{}
+	p.pbxContainerItemProxySection = pegparser.Object{}
+	p.uuids = make(map[string]struct{})
+	p.pbxFileReferences = make(map[string]*PbxFile)
+}
+
+// Snapshot returns a deep copy of the project with its own lock, sections and uuids,
+// changing it leaves p untouched.
+func (p *PbxProject) Snapshot() *PbxProject {
+	snapshot := NewPbxProject(p.filePath)
+	if p.pbxContents.IsEmpty() {
+		return &snapshot
+	}
+	snapshot.pbxContents = p.pbxContents.Clone()
+	snapshot.initSections()
+	snapshot.buildExistUuids()
+	snapshot.initFileReference()
+	return &snapshot
+}
+
+// View runs fn holding the read lock, concurrently with other View calls. fn must only read the project.
+func (p *PbxProject) View(fn func(p *PbxProject)) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	fn(p)
+}
+
+// Update runs fn holding the write lock, no View or other Update runs meanwhile. fn may modify the project.
+func (p *PbxProject) Update(fn func(p *PbxProject)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(p)
+}
+
+func (p *PbxProject) SetFilePath(filename string) {
+	p.filePath = filename
+}
+
 func (p *PbxProject) Contents() pegparser.Object {
 	return p.pbxContents
 }
 
+// HeadComment returns the comment of the first line without the leading "//", usually !$*UTF8*$!.
+func (p *PbxProject) HeadComment() string {
+	return p.pbxContents.GetString("headComment")
+}
+
+func (p *PbxProject) SetHeadComment(comment string) {
+	if p.pbxContents.IsEmpty() {
+		return
+	}
+	p.pbxContents.Set("headComment", comment)
+}
+
 func (p *PbxProject) Parse() error {
 	data, err := ioutil.ReadFile(p.filePath)
 	if err != nil {
 		return err
 	}
 
+	return p.parse(data)
+}
+
+// ReparseBytes replaces the project contents with the result of parsing data.
+func (p *PbxProject) ReparseBytes(data []byte) error {
+	return p.parse(data)
+}
+
+// ReparseFromWriter runs the writer output back through the parser, normalizing the project.
+func (p *PbxProject) ReparseFromWriter(w *PbxWriter) error {
+	return p.parse(w.Bytes())
+}
+
+const utf8Marker = "!$*UTF8*$!"
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// ErrUnsupportedFormat is returned when the project file is a binary or XML property list.
+var ErrUnsupportedFormat = errors.New("binary/XML plist format is not supported; convert to ASCII plist")
+
+func (p *PbxProject) parse(data []byte) error {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if head := bytes.TrimLeft(data, " \t\r\n"); bytes.HasPrefix(head, []byte("bplist")) ||
+		bytes.HasPrefix(head, []byte("<?xml")) || bytes.HasPrefix(head, []byte("<plist")) {
+		return ErrUnsupportedFormat
+	}
 	contents, err := pegparser.ParseReader("", bytes.NewReader(data))
 	if err != nil {
-		return err
+		return pegparser.NewParseError(err, data)
 	}
 	p.pbxContents = contents.(pegparser.Object)
+	// `//!$*UTF8*$!` or trailing blanks are written back as the canonical marker
+	if headComment := strings.TrimSpace(p.pbxContents.GetString("headComment")); strings.EqualFold(headComment, utf8Marker) {
+		p.pbxContents.Set("headComment", utf8Marker)
+	}
+	p.unquoteObjectKeys()
 	p.initSections()
 	p.buildExistUuids()
 	p.initFileReference()
@@ -104,12 +209,47 @@ func (p *PbxProject) Dump(writer io.Writer) error {
 	return err
 }
 
+// DumpClean is Dump without the *_comment keys kept next to the values, the project itself is left untouched.
+func (p *PbxProject) DumpClean(writer io.Writer) error {
+	contents := p.Contents().Clone()
+	stripCommentKeys(contents)
+	bytes, err := pegparser.MarshalWithIndentEscape(contents)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(bytes)
+	return err
+}
+
+func stripCommentKeys(value interface{}) {
+	switch v := value.(type) {
+	case pegparser.Object:
+		commentKeys := []string{}
+		v.ForeachWithFilter(func(key string, _ interface{}) pegparser.IterateActionType {
+			commentKeys = append(commentKeys, key)
+			return pegparser.IterateActionContinue
+		}, onlyCommentsFilter)
+		for _, key := range commentKeys {
+			v.Delete(key)
+		}
+		v.ForeachWithFilter(func(_ string, child interface{}) pegparser.IterateActionType {
+			stripCommentKeys(child)
+			return pegparser.IterateActionContinue
+		}, nonCommentsFilter)
+	case []interface{}:
+		for _, child := range v {
+			stripCommentKeys(child)
+		}
+	}
+}
+
 func (p *PbxProject) initFileReference() {
 	files := make(map[string]*PbxFile)
-	p.pbxFileReferenceSection.ForeachWithFilter(func(_ string, v interface{}) pegparser.IterateActionType {
+	p.pbxFileReferenceSection.ForeachWithFilter(func(key string, v interface{}) pegparser.IterateActionType {
 		obj := v.(pegparser.Object)
-		filePath := obj.GetString("path")
+		filePath := unquoted(obj.GetString("path"))
 		files[filePath] = fromObject(obj)
+		files[filePath].FileRef = key
 		return pegparser.IterateActionContinue
 	}, nonCommentsFilter)
 
@@ -119,30 +259,67 @@ func (p *PbxProject) initFileReference() {
 func (p *PbxProject) initSections() {
 	p.topProjectSection = p.pbxContents.GetObject("project")
 	p.pbxObjectSection = p.topProjectSection.GetObject("objects")
-	p.pbxGroupSection = p.topProjectSection.GetObject("PBXGroup")
+	p.pbxGroupSection = p.pbxObjectSection.GetObject("PBXGroup")
 	p.pbxProjectSection = p.pbxObjectSection.GetObject("PBXProject")
 	p.pbxBuildFileSection = p.pbxObjectSection.GetObject("PBXBuildFile")
 	p.pbxXCBuildConfigurationSection = p.pbxObjectSection.GetObject("XCBuildConfiguration")
 	p.pbxFileReferenceSection = p.pbxObjectSection.GetObject("PBXFileReference")
 	p.pbxNativeTargetSection = p.pbxObjectSection.GetObject("PBXNativeTarget")
-	p.pbxTargetDependencySection = p.pbxObjectSection.GetObject("PBXTargetDependency")     // @fixme if not exist create when add
-	p.pbxContainerItemProxySection = p.pbxObjectSection.GetObject("PBXContainerItemProxy") // @fixme if not exist create when add
+	pbxTargetDependencySection := p.pbxObjectSection.GetObject("PBXTargetDependency")
+	if !p.pbxObjectSection.Has("PBXTargetDependency") {
+		p.pbxObjectSection.Set("PBXTargetDependency", pbxTargetDependencySection)
+	}
+	p.pbxTargetDependencySection = pbxTargetDependencySection
+
+	pbxContainerItemProxySection := p.pbxObjectSection.GetObject("PBXContainerItemProxy")
+	if !p.pbxObjectSection.Has("PBXContainerItemProxy") {
+		p.pbxObjectSection.Set("PBXContainerItemProxy", pbxContainerItemProxySection)
+	}
+	p.pbxContainerItemProxySection = pbxContainerItemProxySection
+
 	xcVersionGroupSection := p.pbxObjectSection.GetObject("XCVersionGroup")
-	if xcVersionGroupSection.IsEmpty() {
-		xcVersionGroupSection = pegparser.NewObject()
+	if !p.pbxObjectSection.Has("XCVersionGroup") {
 		p.pbxObjectSection.Set("XCVersionGroup", xcVersionGroupSection)
 	}
 	p.xcVersionGroupSection = xcVersionGroupSection
 
 	pbxXCConfigurationListSection := p.pbxObjectSection.GetObject("XCConfigurationList")
-	if pbxXCConfigurationListSection.IsEmpty() {
-		pbxXCConfigurationListSection = pegparser.NewObject()
+	if !p.pbxObjectSection.Has("XCConfigurationList") {
 		p.pbxObjectSection.Set("XCConfigurationList", pbxXCConfigurationListSection)
 	}
 	p.pbxXCConfigurationListSection = pbxXCConfigurationListSection
 
 }
 
+// unquoteObjectKeys strips the quotes some tools write around section names and uuids,
+// so "PBXGroup" and "046BD63427EC51880044E784" are found like their unquoted form.
+func (p *PbxProject) unquoteObjectKeys() {
+	objects := p.pbxContents.GetObject("project").GetObject("objects")
+	unquoteKeys(objects)
+	objects.Foreach(func(_ string, v interface{}) pegparser.IterateActionType {
+		if section, ok := v.(pegparser.Object); ok {
+			unquoteKeys(section)
+		}
+		return pegparser.IterateActionContinue
+	})
+}
+
+func unquoteKeys(obj pegparser.Object) {
+	obj.Foreach(func(key string, _ interface{}) pegparser.IterateActionType {
+		name := fromCommentKey(key)
+		unquotedName := unquoted(name)
+		if unquotedName == name || quoteIfNeeded(unquotedName) != unquotedName {
+			return pegparser.IterateActionContinue
+		}
+		if isCommentKey(key) {
+			obj.RenameKey(key, toCommentKey(unquotedName))
+		} else {
+			obj.RenameKey(key, unquotedName)
+		}
+		return pegparser.IterateActionContinue
+	})
+}
+
 func (p *PbxProject) buildExistUuids() {
 	uuids := make(map[string]struct{})
 	p.pbxObjectSection.Foreach(func(_ string, v interface{}) pegparser.IterateActionType {
@@ -229,9 +406,14 @@ func (p *PbxProject) addProductFile(filePath string, options PbxFileOptions) *Pb
 	pbxfile.IncludeInIndex = 0
 	pbxfile.FileRef = p.generateUuid()
 	pbxfile.Target = options.Target
+	// Group only names the build phase the product is copied into (e.g. "Copy Files"),
+	// the file reference itself always belongs to the Products group
 	pbxfile.Group = options.Group
 	pbxfile.Uuid = p.generateUuid()
 	pbxfile.Path = pbxfile.Basename
+	if options.SourceTree == "" {
+		pbxfile.SourceTree = DEFAULT_PRODUCT_SOURCETREE
+	}
 	p.addToPbxFileReferenceSection(pbxfile)
 	p.addToProductsPbxGroup(pbxfile) // PBXGroup
 	return pbxfile
@@ -301,6 +483,60 @@ func (p *PbxProject) AddHeaderFileWithOptions(filePath string, params ...interfa
 		return p.AddPluginFile(filePath, options)
 	}
 }
+
+// AddHeaderToBuildPhase adds the header to the Headers build phase of target, a uuid or name, creating
+// the phase when needed. visibility is one of "public", "private" or "project".
+func (p *PbxProject) AddHeaderToBuildPhase(filePath, target, visibility string) error {
+	var attributes []interface{}
+	switch strings.ToLower(visibility) {
+	case "public":
+		attributes = []interface{}{"Public"}
+	case "private":
+		attributes = []interface{}{"Private"}
+	case "project", "":
+	default:
+		return fmt.Errorf("unknown header visibility: %s", visibility)
+	}
+
+	targetKey := p.resolveTargetKey(target)
+	if targetKey == "" {
+		return fmt.Errorf("target %s not found", target)
+	}
+	target = targetKey
+
+	pbxfile := p.getFile(filePath)
+	if pbxfile == nil {
+		var err error
+		pbxfile, err = p.addPluginFile(filePath, newPbxFileOptions())
+		if err != nil {
+			return err
+		}
+	}
+
+	headers := p.buildPhaseObject("PBXHeadersBuildPhase", "Headers", target)
+	if headers.IsEmpty() {
+		if err := p.AddBuildPhase([]string{}, "PBXHeadersBuildPhase", "Headers", target, nil, ""); err != nil {
+			return err
+		}
+		headers = p.buildPhaseObject("PBXHeadersBuildPhase", "Headers", target)
+	}
+
+	buildFile := &PbxFile{
+		Uuid:     p.generateUuid(),
+		FileRef:  pbxfile.FileRef,
+		Basename: pbxfile.Basename,
+		Group:    "Headers",
+		Target:   target,
+	}
+	if attributes != nil {
+		buildFile.Settings = pegparser.NewObject()
+		buildFile.Settings.Set("ATTRIBUTES", attributes)
+	}
+	p.addToPbxBuildFileSection(buildFile)    // PBXBuildFile
+	p.addToPbxBuildPhase(headers, buildFile) // PBXHeadersBuildPhase
+	return nil
+}
+
 func (p *PbxProject) RemoveHeaderFile(filePath string, params ...interface{}) error {
 	options, group := parseFileVariadicParams(params...)
 	if group != "" {
@@ -311,6 +547,10 @@ func (p *PbxProject) RemoveHeaderFile(filePath string, params ...interface{}) er
 }
 func (p *PbxProject) AddResourceFile(filePath string, params ...interface{}) error {
 	options, group := parseFileVariadicParams(params...)
+	// an asset catalog is a single folder reference, a trailing slash would hide its extension
+	if trimmed := strings.TrimRight(filePath, "/"); filepath.Ext(trimmed) == ".xcassets" {
+		filePath = trimmed
+	}
 	var pbxfile *PbxFile
 	var err error
 
@@ -342,7 +582,7 @@ func (p *PbxProject) AddResourceFile(filePath string, params ...interface{}) err
 		p.addToPbxFileReferenceSection(pbxfile) // PBXFileReference
 		if group != "" {
 			if !p.getPBXGroupByKey(group).IsEmpty() {
-				p.addToPbxGroup(pbxfile, group) //Group other than Resources (i.e. "splash")
+				p.addToPbxGroupByKey(pbxfile, group) //Group other than Resources (i.e. "splash")
 			} else if !p.getPBXVariantGroupByKey(group).IsEmpty() {
 				p.addToPbxVariantGroup(pbxfile, group) // PBXVariantGroup
 			}
@@ -366,7 +606,7 @@ func (p *PbxProject) RemoveResourceFile(filePath string, params ...interface{})
 	p.removeFromPbxFileReferenceSection(pbxfile) // PBXFileReference
 	if group != "" {
 		if !p.getPBXGroupByKey(group).IsEmpty() {
-			p.removeFromPbxGroup(pbxfile, group) //Group other than Resources (i.e. "splash")
+			p.removeFromPbxGroupByKey(pbxfile, group) //Group other than Resources (i.e. "splash")
 		} else if !p.getPBXVariantGroupByKey(group).IsEmpty() {
 			p.removeFromPbxVariantGroup(pbxfile, group) // PBXVariantGroup
 		}
@@ -381,7 +621,8 @@ func (p *PbxProject) AddFramework(filePath string, params ...interface{}) error
 	options, _ := parseFileVariadicParams(params...)
 	customFramework := options.CustomFramework
 	link := options.Link
-	embed := options.Embed
+	// static frameworks are linked into the binary, embedding them would ship a useless copy
+	embed := options.Embed && !options.Static
 
 	options.Embed = false
 	pbxfile := newPbxFile(filePath, options)
@@ -438,22 +679,145 @@ func (p *PbxProject) RemoveFramework(filePath string, params ...interface{}) err
 	return nil
 }
 
+// FrameworkInfo describes a framework or library of the project's frameworks and embed phases.
+type FrameworkInfo struct {
+	Name     string
+	FileRef  string
+	Linked   bool
+	Embedded bool
+	Weak     bool
+}
+
+// Frameworks returns the files linked in a PBXFrameworksBuildPhase or copied by an
+// "Embed Frameworks" phase of any target, each once in order of appearance.
+func (p *PbxProject) Frameworks() []FrameworkInfo {
+	frameworks := []FrameworkInfo{}
+	indexes := map[string]int{}
+	visit := func(phase pegparser.Object, embedded bool) {
+		files, _ := phase.ForceGet("files").([]interface{})
+		for _, file := range files {
+			entry, ok := file.(pegparser.Object)
+			if !ok {
+				continue
+			}
+			buildFile := p.pbxBuildFileSection.GetObject(entry.GetString("value"))
+			fileRef := buildFile.GetString("fileRef")
+			if fileRef == "" {
+				continue
+			}
+			idx, found := indexes[fileRef]
+			if !found {
+				fileReference := p.pbxFileReferenceSection.GetObject(fileRef)
+				name := unquoted(fileReference.GetString("name"))
+				if name == "" {
+					name = filepath.Base(unquoted(fileReference.GetString("path")))
+				}
+				idx = len(frameworks)
+				indexes[fileRef] = idx
+				frameworks = append(frameworks, FrameworkInfo{Name: name, FileRef: fileRef})
+			}
+			if embedded {
+				frameworks[idx].Embedded = true
+			} else {
+				frameworks[idx].Linked = true
+			}
+			attributes, _ := buildFile.GetObject("settings").ForceGet("ATTRIBUTES").([]interface{})
+			for _, attr := range attributes {
+				if attr == "Weak" {
+					frameworks[idx].Weak = true
+				}
+			}
+		}
+	}
+
+	p.getPBXObject("PBXFrameworksBuildPhase").ForeachWithFilter(func(_ string, value interface{}) pegparser.IterateActionType {
+		visit(value.(pegparser.Object), false)
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	p.getPBXObject("PBXCopyFilesBuildPhase").ForeachWithFilter(func(_ string, value interface{}) pegparser.IterateActionType {
+		phase := value.(pegparser.Object)
+		if unquoted(phase.GetString("name")) == "Embed Frameworks" {
+			visit(phase, true)
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	return frameworks
+}
+
 func (p *PbxProject) AddCopyfile(filePath string, params ...interface{}) error {
 	options, _ := parseFileVariadicParams(params...)
+	copyFilesPhase := pegparser.NewObject()
+	if options.Destination != "" {
+		var err error
+		if copyFilesPhase, err = p.copyFilesBuildPhaseForDestination(options.Destination, options.Target); err != nil {
+			return err
+		}
+	}
+
 	pbxfile := newPbxFile(filePath, options)
-	// catch duplicates
-	if p.hasFile(pbxfile.Path) {
+	// catch duplicates, a known file is copied through its existing reference
+	existing := p.hasFile(pbxfile.Path)
+	if existing {
 		pbxfile = p.getFile(pbxfile.Path)
 	}
 	pbxfile.Uuid = p.generateUuid()
-	pbxfile.FileRef = pbxfile.Uuid
 	pbxfile.Target = options.Target
-	p.addToPbxBuildFileSection(pbxfile)     // PBXBuildFile
-	p.addToPbxFileReferenceSection(pbxfile) // PBXFileReference
-	p.addToPbxCopyfilesBuildPhase(pbxfile)  // PBXCopyFilesBuildPhase
+	if options.Destination != "" {
+		// the build file is commented "<file> in <phase name>"
+		pbxfile.Group = unquoted(copyFilesPhase.GetString("name"))
+	}
+	if !existing || pbxfile.FileRef == "" {
+		pbxfile.FileRef = p.generateUuid()
+		p.addToPbxFileReferenceSection(pbxfile) // PBXFileReference
+	}
+	p.addToPbxBuildFileSection(pbxfile) // PBXBuildFile
+	if options.Destination != "" {
+		addToObjectList(copyFilesPhase, "files", pbxBuildPhaseObj(pbxfile)) // PBXCopyFilesBuildPhase
+	} else {
+		p.addToPbxCopyfilesBuildPhase(pbxfile) // PBXCopyFilesBuildPhase
+	}
 	return nil
 }
 
+// copyFilesBuildPhaseForDestination returns the target's copy files phase copying to destination,
+// a key of SUBFOLDERSPEC_BY_DESTINATION, creating it when the target has none.
+func (p *PbxProject) copyFilesBuildPhaseForDestination(destination, target string) (pegparser.Object, error) {
+	spec, ok := SUBFOLDERSPEC_BY_DESTINATION[destination]
+	if !ok {
+		return pegparser.NewObject(), fmt.Errorf("unknown copy files destination: %s", destination)
+	}
+	targetKey := p.resolveTargetKey(target)
+	targetObj := p.pbxNativeTargetSection.GetObject(targetKey)
+	if targetObj.IsEmpty() {
+		return pegparser.NewObject(), fmt.Errorf("target %s not found", target)
+	}
+
+	// destinations may share the spec, e.g. absolute_path and xpc_services, and differ in dstPath
+	dstPath := DSTPATH_BY_DESTINATION[destination]
+	find := func() pegparser.Object {
+		buildPhases, _ := targetObj.ForceGet("buildPhases").([]interface{})
+		for _, buildPhase := range buildPhases {
+			entry, ok := buildPhase.(pegparser.Object)
+			if !ok {
+				continue
+			}
+			obj := p.objectByKey(entry.GetString("value"))
+			if obj.GetString("isa") == "PBXCopyFilesBuildPhase" && obj.GetInt("dstSubfolderSpec") == spec &&
+				unquoted(obj.GetString("dstPath")) == dstPath {
+				return obj
+			}
+		}
+		return pegparser.NewObject()
+	}
+	if phase := find(); !phase.IsEmpty() {
+		return phase, nil
+	}
+	if err := p.AddBuildPhase([]string{}, "PBXCopyFilesBuildPhase", "Copy Files ("+destination+")", targetKey, destination, dstPath); err != nil {
+		return pegparser.NewObject(), err
+	}
+	return find(), nil
+}
+
 func (p *PbxProject) pbxCopyfilesBuildPhaseObj(target string) pegparser.Object {
 	return p.buildPhaseObject("PBXCopyFilesBuildPhase", "Copy Files", target)
 }
@@ -475,12 +839,7 @@ func (p *PbxProject) RemoveCopyfile(filePath string, params ...interface{}) erro
 
 func (p *PbxProject) removeFromPbxCopyfilesBuildPhase(pbxfile *PbxFile) {
 	sources := p.pbxCopyfilesBuildPhaseObj(pbxfile.Target)
-	pbxfileComment := longComment(pbxfile)
-	removeFromObjectList(sources, "files", func(v interface{}) bool {
-		comment := v.(pegparser.Object).GetString("comment")
-		return comment == pbxfileComment
-	}, false)
-
+	removeFromObjectList(sources, "files", p.removedBuildFileMatcher(pbxfile), false)
 }
 
 func (p *PbxProject) AddStaticLibrary(filePath string, params ...interface{}) error {
@@ -518,8 +877,16 @@ func (p *PbxProject) addToPbxBuildFileSection(pbxfile *PbxFile) {
 }
 
 func (p *PbxProject) removeFromPbxBuildFileSection(pbxfile *PbxFile) {
-	p.pbxGroupSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
-		if value.(pegparser.Object).GetString(toCommentKey("FileRef")) == pbxfile.Basename {
+	fileRef := pbxfile.FileRef
+	if existing := p.getFile(pbxfile.Path); fileRef == "" && existing != nil {
+		fileRef = existing.FileRef
+	}
+	// the settings block (ATTRIBUTES, COMPILER_FLAGS) lives inside the build file object
+	p.pbxBuildFileSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		buildFile := value.(pegparser.Object)
+		// files in different folders share the basename, it only identifies the file without reference
+		if (fileRef != "" && buildFile.GetString("fileRef") == fileRef) ||
+			(fileRef == "" && buildFile.GetString(toCommentKey("fileRef")) == pbxfile.Basename) {
 			p.pbxBuildFileSection.Delete(key)
 			p.pbxBuildFileSection.Delete(toCommentKey(key))
 		}
@@ -593,10 +960,11 @@ func (p *PbxProject) AddPbxGroup(filePathsArray []string, name, path, sourceTree
 		}.ToObject())
 	}
 
-	if !p.pbxGroupSection.IsEmpty() {
-		p.pbxGroupSection.Set(pbxGroupUuid, pbxGroup)
-		p.pbxGroupSection.Set(toCommentKey(pbxGroupUuid), name)
+	if !p.pbxObjectSection.Has("PBXGroup") {
+		p.pbxObjectSection.Set("PBXGroup", p.pbxGroupSection)
 	}
+	p.pbxGroupSection.Set(pbxGroupUuid, pbxGroup)
+	p.pbxGroupSection.Set(toCommentKey(pbxGroupUuid), name)
 }
 
 func (p *PbxProject) RemovePbxGroup(groupName string) {
@@ -610,6 +978,39 @@ func (p *PbxProject) RemovePbxGroup(groupName string) {
 	}, onlyCommentsFilter)
 }
 
+// RenameGroup renames the PBXGroup called oldName, in its parent's children too. Groups that
+// only carry a path are matched by it and get a name, so the folder on disk is left untouched.
+func (p *PbxProject) RenameGroup(oldName, newName string) error {
+	groupKey := p.findPBXGroupKey(FindGroupCriteria{Name: oldName})
+	if groupKey == "" {
+		groupKey = p.findPBXGroupKey(FindGroupCriteria{Path: oldName})
+	}
+	if groupKey == "" {
+		return fmt.Errorf("group %s not found", oldName)
+	}
+
+	group := p.getPBXGroupByKey(groupKey)
+	hadName := group.Has("name")
+	group.Set("name", quoteIfNeeded(newName))
+	if pathIdx := group.IndexOf("path"); !hadName && pathIdx >= 0 {
+		// Xcode writes name before path
+		group.MoveKey("name", pathIdx)
+	}
+	p.pbxGroupSection.Set(toCommentKey(groupKey), newName)
+
+	// the parent lists the group as `key /* name */`
+	p.pbxGroupSection.ForeachWithFilter(func(_ string, value interface{}) pegparser.IterateActionType {
+		children, _ := value.(pegparser.Object).ForceGet("children").([]interface{})
+		for _, child := range children {
+			if childObj, ok := child.(pegparser.Object); ok && childObj.GetString("value") == groupKey {
+				childObj.Set("comment", newName)
+			}
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	return nil
+}
+
 func (p *PbxProject) addToPbxProjectSection(uuid string, target pegparser.Object) {
 	newTarget := CommentValue{
 		Value:   uuid,
@@ -621,27 +1022,32 @@ func (p *PbxProject) addToPbxProjectSection(uuid string, target pegparser.Object
 
 func (p *PbxProject) addToPbxNativeTargetSection(uuid string, target pegparser.Object) {
 	p.pbxNativeTargetSection.Set(uuid, target)
-	p.pbxNativeTargetSection.Set(toCommentKey(uuid), target.GetString("name"))
+	p.pbxNativeTargetSection.Set(toCommentKey(uuid), pbxNativeTargetComment(target))
 }
 
 func (p *PbxProject) addToPbxFileReferenceSection(pbxfile *PbxFile) {
 	p.pbxFileReferenceSection.Set(pbxfile.FileRef, newPbxFileReferenceObj(pbxfile))
 	p.pbxFileReferenceSection.Set(toCommentKey(pbxfile.FileRef), pbxFileReferenceComment(pbxfile))
-	p.pbxFileReferences[pbxfile.Path] = pbxfile
+	p.pbxFileReferences[unquoted(pbxfile.Path)] = pbxfile
 }
 
 func (p *PbxProject) removeFromPbxFileReferenceSection(pbxfile *PbxFile) {
 	refObj := newPbxFileReferenceObj(pbxfile)
-	refObjName := refObj.GetString("name")
+	refObjName := quoteIfNeeded(pbxfile.Basename) // not in refObj when it equals the path's last component
 	refObjPath := refObj.GetString("path")
 
 	p.pbxFileReferenceSection.ForeachWithFilter(func(key string, val interface{}) pegparser.IterateActionType {
-		pbxfile := val.(pegparser.Object)
-		name := pbxfile.GetString("name")
-		path := pbxfile.GetString("path")
+		fileReference := val.(pegparser.Object)
+		name := fileReference.GetString("name")
+		path := fileReference.GetString("path")
 		if name == refObjName || `"`+name+`"` == refObjName || path == refObjPath || `"`+path+`"` == refObjPath {
 			p.pbxFileReferenceSection.Delete(key)
-			p.pbxFileReferenceSection.Delete(toCommentKey(pbxfile.GetString("FileRef")))
+			p.pbxFileReferenceSection.Delete(toCommentKey(key))
+			delete(p.pbxFileReferences, unquoted(path))
+			// let the following group/build phase removals match on the real reference
+			if pbxfile.FileRef == "" {
+				pbxfile.FileRef = key
+			}
 			return pegparser.IterateActionBreak
 		}
 
@@ -676,10 +1082,20 @@ func (p *PbxProject) addToXcVersionGroupSection(pbxfile *PbxFile) error {
 
 func (p *PbxProject) addToPbxGroup(pbxfile *PbxFile, groupName string) {
 	group := p.pbxGroupByName(groupName)
+	if group.IsEmpty() {
+		// the section comment may be missing, look at the group's own name/path before creating a new one
+		groupKey := p.findPBXGroupKey(FindGroupCriteria{Name: groupName})
+		if groupKey == "" {
+			groupKey = p.findPBXGroupKey(FindGroupCriteria{Path: groupName})
+		}
+		group = p.getPBXGroupByKey(groupKey)
+	}
+
 	if group.IsEmpty() {
 		p.AddPbxGroup([]string{pbxfile.Path}, groupName, "", "")
 	} else {
-		addToObjectList(group, "children", pbxGroupChild(pbxfile))
+		// only children is touched, any other key of the group is kept as is
+		addToObjectList(group, "children", pbxGroupChild(pbxfile).ToObject())
 	}
 }
 
@@ -732,10 +1148,17 @@ func (p *PbxProject) addToPbxBuildPhase(source pegparser.Object, pbxfile *PbxFil
 }
 
 func (p *PbxProject) removeFromPbxBuildPhase(source pegparser.Object, pbxfile *PbxFile) {
+	removeFromObjectList(source, "files", p.removedBuildFileMatcher(pbxfile), false)
+}
+
+// removedBuildFileMatcher matches the phase entries of pbxfile whose build file was removed already,
+// the comment alone is ambiguous for files with the same name in different folders.
+func (p *PbxProject) removedBuildFileMatcher(pbxfile *PbxFile) func(interface{}) bool {
 	comment := longComment(pbxfile)
-	removeFromObjectList(source, "files", func(file interface{}) bool {
-		return file.(pegparser.Object).GetString("comment") == comment
-	}, false)
+	return func(file interface{}) bool {
+		entry, ok := file.(pegparser.Object)
+		return ok && entry.GetString("comment") == comment && !p.pbxBuildFileSection.Has(entry.GetString("value"))
+	}
 }
 
 func (p *PbxProject) addToPbxEmbedFrameworksBuildPhase(pbxfile *PbxFile) {
@@ -772,7 +1195,7 @@ func (p *PbxProject) removeFromPbxFrameworksBuildPhase(pbxfile *PbxFile) {
 
 func (p *PbxProject) addXCConfigurationList(configurationObjectsArray []pegparser.Object, defaultConfigurationName, comment string) pegparser.ObjectWithUUID {
 	xcConfigurationListUuid := p.generateUuid()
-	buildConfigurations := make([]pegparser.Object, 0)
+	buildConfigurations := make([]interface{}, 0)
 
 	xcConfigurationList := pegparser.NewObjectWithData([]pegparser.SliceItem{
 		pegparser.NewObjectItem("isa", "XCConfigurationList"),
@@ -829,7 +1252,7 @@ func (p *PbxProject) AddTargetDependency(target string, dependencyTargets []stri
 			pegparser.NewObjectItem(toCommentKey("containerPortal"), p.topProjectSection.GetString(toCommentKey("rootObject"))),
 			pegparser.NewObjectItem("proxyType", 1),
 			pegparser.NewObjectItem("remoteGlobalIDString", dependencyTargetUuid),
-			pegparser.NewObjectItem("remoteInfo", p.pbxNativeTargetSection.GetObject(dependencyTargetUuid).GetString("name")),
+			pegparser.NewObjectItem("remoteInfo", quoteIfNeeded(unquoted(p.pbxNativeTargetSection.GetObject(dependencyTargetUuid).GetString("name")))),
 		})
 
 		targetDependency := pegparser.NewObjectWithData([]pegparser.SliceItem{
@@ -841,109 +1264,462 @@ func (p *PbxProject) AddTargetDependency(target string, dependencyTargets []stri
 		})
 
 		p.pbxContainerItemProxySection.Set(itemProxyUuid, itemProxy)
-		p.pbxContainerItemProxySection.Set(toCommentKey(itemProxyUuid), "pbxContainerItemProxy")
+		p.pbxContainerItemProxySection.Set(toCommentKey(itemProxyUuid), "PBXContainerItemProxy")
 		p.pbxTargetDependencySection.Set(targetDependencyUuid, targetDependency)
-		p.pbxTargetDependencySection.Set(toCommentKey(targetDependencyUuid), "pbxTargetDependency")
+		p.pbxTargetDependencySection.Set(toCommentKey(targetDependencyUuid), "PBXTargetDependency")
 		addToObjectList(targetObj, "dependencies", CommentValue{
 			Value:   targetDependencyUuid,
-			Comment: "pbxTargetDependency",
+			Comment: "PBXTargetDependency",
 		}.ToObject())
 	}
 }
 
-func (p *PbxProject) AddBuildPhase(filePathsArray []string, buildPhaseType, comment, target string, optionsOrFolderType interface{}, subfolderPath string) {
-	buildPhaseUuid := p.generateUuid()
-	buildPhaseTargetUuid := target
-	if target == "" {
-		buildPhaseTargetUuid = p.getFirstTarget().UUID
+// RemoveTargetDependency removes the dependencies of target on dependencyTargets (uuids or names)
+// with their PBXTargetDependency and PBXContainerItemProxy objects. Targets target doesn't
+// depend on are skipped.
+func (p *PbxProject) RemoveTargetDependency(target string, dependencyTargets []string) error {
+	targetObj := p.pbxNativeTargetSection.GetObject(p.resolveTargetKey(target))
+	if targetObj.IsEmpty() {
+		return fmt.Errorf("target %s not found", target)
 	}
-	commentKey := toCommentKey(buildPhaseUuid)
 
-	buildPhase := pegparser.NewObjectWithData([]pegparser.SliceItem{
-		pegparser.NewObjectItem("isa", buildPhaseType),
-		pegparser.NewObjectItem("buildActionMask", 2147483647),
-		pegparser.NewObjectItem("files", []interface{}{}),
-		pegparser.NewObjectItem("runOnlyForDeploymentPostprocessing", 0),
+	dependencyKeys := map[string]struct{}{}
+	for _, dependencyTarget := range dependencyTargets {
+		dependencyKey := p.resolveTargetKey(dependencyTarget)
+		if !p.pbxNativeTargetSection.Has(dependencyKey) {
+			return fmt.Errorf("dependency target %s not found", dependencyTarget)
+		}
+		dependencyKeys[dependencyKey] = struct{}{}
+	}
+
+	removeListEntries(targetObj, "dependencies", func(key string) bool {
+		targetDependency := p.pbxTargetDependencySection.GetObject(key)
+		if _, found := dependencyKeys[targetDependency.GetString("target")]; !found {
+			return false
+		}
+		itemProxyKey := targetDependency.GetString("targetProxy")
+		p.pbxContainerItemProxySection.Delete(itemProxyKey)
+		p.pbxContainerItemProxySection.Delete(toCommentKey(itemProxyKey))
+		p.pbxTargetDependencySection.Delete(key)
+		p.pbxTargetDependencySection.Delete(toCommentKey(key))
+		return true
 	})
+	return nil
+}
 
-	filePathToBuildFile := map[string]*PbxFile{}
-	if buildPhaseType == "PBXCopyFilesBuildPhase" {
-		folderType, ok := optionsOrFolderType.(string)
+// TargetDependencies returns the names of the targets targetName (uuid or name) depends on, in
+// order. Targets of other projects are named after their container item proxy's remoteInfo.
+func (p *PbxProject) TargetDependencies(targetName string) []string {
+	targetObj := p.pbxNativeTargetSection.GetObject(p.resolveTargetKey(targetName))
+	dependencies, _ := targetObj.ForceGet("dependencies").([]interface{})
+
+	names := []string{}
+	for _, dependency := range dependencies {
+		dependencyObj, ok := dependency.(pegparser.Object)
 		if !ok {
-			fmt.Println("optionsOrFolderType is not string")
-			return
+			continue
 		}
-		buildPhase = pbxCopyFilesBuildPhaseObj(buildPhase, folderType, subfolderPath, comment)
-	} else if buildPhaseType == "PBXShellScriptBuildPhase" {
-		options, ok := optionsOrFolderType.(pbxShellScriptBuildPhaseObjOptions)
-		if !ok {
-			fmt.Println("optionsOrFolderType is not pbxShellScriptBuildPhaseObjOptions")
-			return
+		targetDependency := p.pbxTargetDependencySection.GetObject(dependencyObj.GetString("value"))
+		name := unquoted(p.pbxNativeTargetSection.GetObject(targetDependency.GetString("target")).GetString("name"))
+		if name == "" {
+			name = unquoted(p.pbxContainerItemProxySection.GetObject(targetDependency.GetString("targetProxy")).GetString("remoteInfo"))
+		}
+		if name != "" {
+			names = append(names, name)
 		}
-		buildPhase = pbxShellScriptBuildPhaseObj(buildPhase, options, comment)
 	}
+	return names
+}
+
+// HasDependencyCycle looks for circular PBXTargetDependency edges between native targets and
+// returns the target names along the first cycle found, e.g. [A B A].
+func (p *PbxProject) HasDependencyCycle() ([]string, bool) {
+	targetKeys := []string{}
+	edges := map[string][]string{}
+	p.pbxNativeTargetSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		targetKeys = append(targetKeys, key)
+		dependencies, _ := value.(pegparser.Object).ForceGet("dependencies").([]interface{})
+		for _, dependency := range dependencies {
+			dependencyObj, ok := dependency.(pegparser.Object)
+			if !ok {
+				continue
+			}
+			dependencyTarget := p.pbxTargetDependencySection.GetObject(dependencyObj.GetString("value")).GetString("target")
+			if dependencyTarget != "" {
+				edges[key] = append(edges[key], dependencyTarget)
+			}
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
 
-	buildPhaseSection := p.pbxObjectSection.GetObject(buildPhaseType)
-	if buildPhaseSection.IsEmpty() {
-		buildPhaseSection = pegparser.NewObject()
-		p.pbxObjectSection.Set(buildPhaseType, buildPhaseSection)
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	stack := []string{}
+	var cycle []string
+	var visit func(key string) bool
+	visit = func(key string) bool {
+		state[key] = visiting
+		stack = append(stack, key)
+		for _, next := range edges[key] {
+			switch state[next] {
+			case visiting:
+				for i, k := range stack {
+					if k == next {
+						cycle = append(append([]string{}, stack[i:]...), next)
+						break
+					}
+				}
+				return true
+			case unvisited:
+				if visit(next) {
+					return true
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[key] = visited
+		return false
 	}
-	if !buildPhaseSection.Has(buildPhaseUuid) {
-		buildPhaseSection.Set(buildPhaseUuid, buildPhase)
-		buildPhaseSection.Set(commentKey, comment)
+
+	for _, key := range targetKeys {
+		if state[key] == unvisited && visit(key) {
+			names := make([]string, len(cycle))
+			for i, k := range cycle {
+				names[i] = unquoted(p.pbxNativeTargetSection.GetObject(k).GetString("name"))
+				if names[i] == "" {
+					names[i] = k
+				}
+			}
+			return names, true
+		}
 	}
+	return nil, false
+}
 
-	targetObj := p.pbxNativeTargetSection.GetObject(buildPhaseTargetUuid)
-	if targetObj.Has("buildPhases") {
-		addToObjectList(targetObj, "buildPhases", CommentValue{
-			Value:   buildPhaseUuid,
-			Comment: comment,
-		}.ToObject())
+// RemovePackageProductFromTarget unlinks the Swift package product productName from target
+// (a uuid or name): the target's product dependency and its Frameworks build file are removed,
+// the XCRemoteSwiftPackageReference and other targets using the product are left alone.
+func (p *PbxProject) RemovePackageProductFromTarget(productName, target string) error {
+	targetKey := p.resolveTargetKey(target)
+	targetObj := p.pbxNativeTargetSection.GetObject(targetKey)
+	if targetObj.IsEmpty() {
+		return fmt.Errorf("target %s not found", target)
 	}
 
-	p.pbxBuildFileSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
-		buildFileKey := fromCommentKey(key)
-		buildFile := p.pbxBuildFileSection.GetObject(buildFileKey)
-		fileReference := p.pbxFileReferenceSection.GetObject(buildFile.GetString("fileRef"))
-		if fileReference.IsEmpty() {
-			return pegparser.IterateActionContinue
+	productDependencySection := p.pbxObjectSection.GetObject("XCSwiftPackageProductDependency")
+	removed := map[string]struct{}{}
+	productDependencies, _ := targetObj.ForceGet("packageProductDependencies").([]interface{})
+	kept := []interface{}{}
+	for _, productDependency := range productDependencies {
+		entry, ok := productDependency.(pegparser.Object)
+		if !ok {
+			kept = append(kept, productDependency)
+			continue
 		}
-		filePath := fileReference.GetString("path")
-		pbxFileObj := newPbxFile(filePath, newPbxFileOptions())
-		filePathToBuildFile[filePath] = &PbxFile{
-			Uuid:     buildFileKey,
-			Basename: pbxFileObj.Basename,
-			Group:    pbxFileObj.Group,
+		key := entry.GetString("value")
+		if unquoted(productDependencySection.GetObject(key).GetString("productName")) == productName {
+			removed[key] = struct{}{}
+			continue
 		}
-		return pegparser.IterateActionContinue
-	}, onlyCommentsFilter)
+		kept = append(kept, productDependency)
+	}
+	if len(removed) == 0 {
+		return fmt.Errorf("package product %s not found in target %s", productName, target)
+	}
+	targetObj.Set("packageProductDependencies", kept)
 
-	for _, filePath := range filePathsArray {
-		filePathQuoted := `"` + filePath + `"`
-		pbxfile, ok := filePathToBuildFile[filePath]
-		if ok {
-			addToObjectList(buildPhase, "files", pbxBuildPhaseObj(pbxfile))
+	frameworksBuildPhase := p.pbxFrameworksBuildPhaseObj(targetKey)
+	files, _ := frameworksBuildPhase.ForceGet("files").([]interface{})
+	keptFiles := []interface{}{}
+	for _, file := range files {
+		entry, ok := file.(pegparser.Object)
+		if !ok {
+			keptFiles = append(keptFiles, file)
 			continue
 		}
-		pbxfile, ok = filePathToBuildFile[filePathQuoted]
-		if ok {
-			addToObjectList(buildPhase, "files", pbxBuildPhaseObj(pbxfile))
+		buildFileKey := entry.GetString("value")
+		if _, found := removed[p.pbxBuildFileSection.GetObject(buildFileKey).GetString("productRef")]; found {
+			p.pbxBuildFileSection.Delete(buildFileKey)
+			p.pbxBuildFileSection.Delete(toCommentKey(buildFileKey))
 			continue
 		}
+		keptFiles = append(keptFiles, file)
+	}
+	if files != nil {
+		frameworksBuildPhase.Set("files", keptFiles)
+	}
 
-		pbxfile = newPbxFile(filePath, newPbxFileOptions())
-		pbxfile.Uuid = p.generateUuid()
-		pbxfile.FileRef = p.generateUuid()
-		p.addToPbxFileReferenceSection(pbxfile) // PBXFileReference
-		p.addToPbxBuildFileSection(pbxfile)     // PBXBuildFile
-		addToObjectList(buildPhase, "files", pbxBuildPhaseObj(pbxfile))
+	// product dependencies are per target, the removed ones are orphans now
+	for key := range removed {
+		productDependencySection.Delete(key)
+		productDependencySection.Delete(toCommentKey(key))
 	}
-	buildPhaseSection.Set(buildPhaseUuid, buildPhase)
-	buildPhaseSection.Set(commentKey, comment)
+	return nil
 }
 
-func (p *PbxProject) pbxGroupByName(name string) (obj pegparser.Object) {
-	obj = pegparser.NewObject()
+type subProjectProduct struct {
+	uuid     string
+	path     string
+	fileType string
+	target   string
+}
+
+// subProjectProducts reads the products of the sub-project at xcodeprojPath, relative paths are
+// resolved against the directory holding this project. A sub-project that can't be read or
+// parsed is an error.
+func (p *PbxProject) subProjectProducts(xcodeprojPath string) ([]subProjectProduct, error) {
+	if !filepath.IsAbs(xcodeprojPath) {
+		xcodeprojPath = filepath.Join(filepath.Dir(filepath.Dir(p.filePath)), xcodeprojPath)
+	}
+	sub := NewPbxProject(filepath.Join(xcodeprojPath, "project.pbxproj"))
+	if err := sub.Parse(); err != nil {
+		return nil, err
+	}
+
+	products := []subProjectProduct{}
+	sub.pbxNativeTargetSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		target := value.(pegparser.Object)
+		productReference := target.GetString("productReference")
+		fileReference := sub.pbxFileReferenceSection.GetObject(productReference)
+		if fileReference.IsEmpty() {
+			return pegparser.IterateActionContinue
+		}
+		fileType := fileReference.GetString("explicitFileType")
+		if fileType == "" {
+			fileType = fileReference.GetString("lastKnownFileType")
+		}
+		products = append(products, subProjectProduct{
+			uuid:     productReference,
+			path:     unquoted(fileReference.GetString("path")),
+			fileType: fileType,
+			target:   unquoted(target.GetString("name")),
+		})
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	return products, nil
+}
+
+// AddProjectReference references the sub-project at xcodeprojPath: a file reference in the main
+// group, a "<name> Products" group holding a PBXReferenceProxy per product of the sub-project and
+// the matching projectReferences entry of the PBXProject. Nothing changes when the sub-project
+// cannot be read.
+func (p *PbxProject) AddProjectReference(xcodeprojPath string) error {
+	project := p.getFirstProject()
+	if project.UUID == "" {
+		return errors.New("No project found")
+	}
+	if filepath.Ext(xcodeprojPath) != ".xcodeproj" {
+		return fmt.Errorf("%s is not an .xcodeproj", xcodeprojPath)
+	}
+
+	pbxfile := newPbxFile(xcodeprojPath, newPbxFileOptions())
+	if p.hasFile(pbxfile.Path) {
+		return fmt.Errorf("file %s already exists", pbxfile.Path)
+	}
+	products, err := p.subProjectProducts(xcodeprojPath)
+	if err != nil {
+		return fmt.Errorf("read sub-project %s: %v", xcodeprojPath, err)
+	}
+	pbxfile.FileRef = p.generateUuid()
+	p.addToPbxFileReferenceSection(pbxfile)                              // PBXFileReference
+	p.addToPbxGroupByKey(pbxfile, project.Object.GetString("mainGroup")) // PBXGroup
+
+	// not "Products" like Xcode, that name is looked up for the project's own products group
+	productGroupName := strings.TrimSuffix(pbxfile.Basename, ".xcodeproj") + " Products"
+	productGroupKey := p.pbxCreateGroup(productGroupName, "")
+	productGroup := p.getPBXGroupByKey(productGroupKey)
+	productGroup.Set("name", quoteIfNeeded(productGroupName))
+	referenceProxySection := p.pbxObjectSection.GetObject("PBXReferenceProxy")
+	if referenceProxySection.IsEmpty() {
+		referenceProxySection = pegparser.NewObject()
+		p.pbxObjectSection.Set("PBXReferenceProxy", referenceProxySection)
+	}
+
+	for _, product := range products {
+		itemProxyUuid := p.generateUuid()
+		itemProxy := pegparser.NewObjectWithData([]pegparser.SliceItem{
+			pegparser.NewObjectItem("isa", "PBXContainerItemProxy"),
+			pegparser.NewObjectItem("containerPortal", pbxfile.FileRef),
+			pegparser.NewObjectItem(toCommentKey("containerPortal"), pbxfile.Basename),
+			pegparser.NewObjectItem("proxyType", 2),
+			pegparser.NewObjectItem("remoteGlobalIDString", product.uuid),
+			pegparser.NewObjectItem("remoteInfo", quoteIfNeeded(product.target)),
+		})
+		p.pbxContainerItemProxySection.Set(itemProxyUuid, itemProxy)
+		p.pbxContainerItemProxySection.Set(toCommentKey(itemProxyUuid), "PBXContainerItemProxy")
+
+		referenceProxyUuid := p.generateUuid()
+		referenceProxy := pegparser.NewObjectWithData([]pegparser.SliceItem{
+			pegparser.NewObjectItem("isa", "PBXReferenceProxy"),
+			pegparser.NewObjectItem("fileType", product.fileType),
+			pegparser.NewObjectItem("path", quoteIfNeeded(product.path)),
+			pegparser.NewObjectItem("remoteRef", itemProxyUuid),
+			pegparser.NewObjectItem(toCommentKey("remoteRef"), "PBXContainerItemProxy"),
+			pegparser.NewObjectItem("sourceTree", DEFAULT_PRODUCT_SOURCETREE),
+		})
+		referenceProxySection.Set(referenceProxyUuid, referenceProxy)
+		referenceProxySection.Set(toCommentKey(referenceProxyUuid), product.path)
+
+		addToObjectList(productGroup, "children", CommentValue{
+			Value:   referenceProxyUuid,
+			Comment: product.path,
+		}.ToObject())
+	}
+
+	projectReference := pegparser.NewObjectWithData([]pegparser.SliceItem{
+		pegparser.NewObjectItem("ProductGroup", productGroupKey),
+		pegparser.NewObjectItem(toCommentKey("ProductGroup"), productGroupName),
+		pegparser.NewObjectItem("ProjectRef", pbxfile.FileRef),
+		pegparser.NewObjectItem(toCommentKey("ProjectRef"), pbxfile.Basename),
+	})
+	addToObjectList(project.Object, "projectReferences", projectReference)
+	return nil
+}
+
+func (p *PbxProject) AddBuildPhase(filePathsArray []string, buildPhaseType, comment, target string, optionsOrFolderType interface{}, subfolderPath string) error {
+	buildPhaseTargetUuid := target
+	if target == "" {
+		firstTarget, ok := p.getFirstTarget()
+		if !ok {
+			return errors.New("No target to add the build phase to")
+		}
+		buildPhaseTargetUuid = firstTarget.UUID
+	}
+	buildPhaseUuid := p.generateUuid()
+	commentKey := toCommentKey(buildPhaseUuid)
+
+	buildPhase := pegparser.NewObjectWithData([]pegparser.SliceItem{
+		pegparser.NewObjectItem("isa", buildPhaseType),
+		pegparser.NewObjectItem("buildActionMask", 2147483647),
+		pegparser.NewObjectItem("files", []interface{}{}),
+		pegparser.NewObjectItem("runOnlyForDeploymentPostprocessing", 0),
+	})
+
+	filePathToBuildFile := map[string]*PbxFile{}
+	if buildPhaseType == "PBXCopyFilesBuildPhase" {
+		folderType, ok := optionsOrFolderType.(string)
+		if !ok {
+			return errors.New("optionsOrFolderType is not string")
+		}
+		buildPhase = pbxCopyFilesBuildPhaseObj(buildPhase, folderType, subfolderPath, comment)
+	} else if buildPhaseType == "PBXShellScriptBuildPhase" {
+		options, ok := optionsOrFolderType.(pbxShellScriptBuildPhaseObjOptions)
+		if !ok {
+			return errors.New("optionsOrFolderType is not pbxShellScriptBuildPhaseObjOptions")
+		}
+		buildPhase = pbxShellScriptBuildPhaseObj(buildPhase, options, comment)
+	}
+
+	buildPhaseSection := p.pbxObjectSection.GetObject(buildPhaseType)
+	if buildPhaseSection.IsEmpty() {
+		buildPhaseSection = pegparser.NewObject()
+		p.pbxObjectSection.Set(buildPhaseType, buildPhaseSection)
+	}
+	if !buildPhaseSection.Has(buildPhaseUuid) {
+		buildPhaseSection.Set(buildPhaseUuid, buildPhase)
+		buildPhaseSection.Set(commentKey, comment)
+	}
+
+	targetObj := p.pbxNativeTargetSection.GetObject(buildPhaseTargetUuid)
+	if targetObj.Has("buildPhases") {
+		addToObjectList(targetObj, "buildPhases", CommentValue{
+			Value:   buildPhaseUuid,
+			Comment: comment,
+		}.ToObject())
+	}
+
+	p.pbxBuildFileSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		buildFileKey := fromCommentKey(key)
+		buildFile := p.pbxBuildFileSection.GetObject(buildFileKey)
+		fileReference := p.pbxFileReferenceSection.GetObject(buildFile.GetString("fileRef"))
+		if fileReference.IsEmpty() {
+			return pegparser.IterateActionContinue
+		}
+		filePath := fileReference.GetString("path")
+		pbxFileObj := newPbxFile(filePath, newPbxFileOptions())
+		filePathToBuildFile[filePath] = &PbxFile{
+			Uuid:     buildFileKey,
+			Basename: pbxFileObj.Basename,
+			Group:    pbxFileObj.Group,
+		}
+		return pegparser.IterateActionContinue
+	}, onlyCommentsFilter)
+
+	for _, filePath := range filePathsArray {
+		filePathQuoted := `"` + filePath + `"`
+		pbxfile, ok := filePathToBuildFile[filePath]
+		if ok {
+			addToObjectList(buildPhase, "files", pbxBuildPhaseObj(pbxfile))
+			continue
+		}
+		pbxfile, ok = filePathToBuildFile[filePathQuoted]
+		if ok {
+			addToObjectList(buildPhase, "files", pbxBuildPhaseObj(pbxfile))
+			continue
+		}
+
+		pbxfile = newPbxFile(filePath, newPbxFileOptions())
+		pbxfile.Uuid = p.generateUuid()
+		pbxfile.FileRef = p.generateUuid()
+		p.addToPbxFileReferenceSection(pbxfile) // PBXFileReference
+		p.addToPbxBuildFileSection(pbxfile)     // PBXBuildFile
+		addToObjectList(buildPhase, "files", pbxBuildPhaseObj(pbxfile))
+	}
+	buildPhaseSection.Set(buildPhaseUuid, buildPhase)
+	buildPhaseSection.Set(commentKey, comment)
+	return nil
+}
+
+// hasBuildPhaseOfType reports whether one of the target's build phases has the given isa.
+func (p *PbxProject) hasBuildPhaseOfType(targetKey, buildPhaseType string) bool {
+	section := p.pbxObjectSection.GetObject(buildPhaseType)
+	buildPhases, _ := p.pbxNativeTargetSection.GetObject(targetKey).ForceGet("buildPhases").([]interface{})
+	for _, buildPhase := range buildPhases {
+		entry, ok := buildPhase.(pegparser.Object)
+		if !ok {
+			continue
+		}
+		if section.Has(entry.GetString("value")) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetTypesWithStandardBuildPhases get Sources, Frameworks and Resources phases from AddTarget.
+var targetTypesWithStandardBuildPhases = map[string]struct{}{
+	"application":      {},
+	"app_extension":    {},
+	"framework":        {},
+	"unit_test_bundle": {},
+	"watch2_extension": {},
+}
+
+// EnsureStandardBuildPhases adds the Sources, Frameworks and Resources phases Xcode
+// expects on a native target when they are missing. target is a target uuid or name.
+func (p *PbxProject) EnsureStandardBuildPhases(target string) {
+	targetKey := p.resolveTargetKey(target)
+	targetObj := p.pbxNativeTargetSection.GetObject(targetKey)
+	if targetObj.IsEmpty() {
+		return
+	}
+	if !targetObj.Has("buildPhases") {
+		targetObj.Set("buildPhases", []interface{}{})
+	}
+
+	for _, buildPhaseType := range []string{"PBXSourcesBuildPhase", "PBXFrameworksBuildPhase", "PBXResourcesBuildPhase"} {
+		if !p.hasBuildPhaseOfType(targetKey, buildPhaseType) {
+			p.AddBuildPhase([]string{}, buildPhaseType, buildPhaseNameForIsa(buildPhaseType), targetKey, nil, "")
+		}
+	}
+}
+
+func (p *PbxProject) pbxGroupByName(name string) (obj pegparser.Object) {
+	obj = pegparser.NewObject()
 	p.pbxGroupSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
 		if value.(string) == name {
 			obj = p.pbxGroupSection.GetObject(fromCommentKey(key))
@@ -961,15 +1737,27 @@ func (p *PbxProject) pbxTargetByName(name string) pegparser.Object {
 func (p *PbxProject) findTargetKey(name string) (targetKey string) {
 	targets := p.pbxObjectSection.GetObject("PBXNativeTarget")
 	targets.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
-		if value.(pegparser.Object).GetString("name") == name {
+		if unquoted(value.(pegparser.Object).GetString("name")) == unquoted(name) {
 			targetKey = key
 			return pegparser.IterateActionBreak
 		}
 		return pegparser.IterateActionContinue
-	}, onlyCommentsFilter)
+	}, nonCommentsFilter)
 	return
 }
 
+// resolveTargetKey accepts a target uuid or name, empty means the first target.
+func (p *PbxProject) resolveTargetKey(target string) string {
+	if target == "" {
+		firstTarget, _ := p.getFirstTarget()
+		return firstTarget.UUID
+	}
+	if p.pbxNativeTargetSection.Has(target) {
+		return target
+	}
+	return p.findTargetKey(target)
+}
+
 func (p *PbxProject) pbxItemByComment(name, pbxSectionName string) (obj pegparser.Object) {
 	obj = pegparser.NewObject()
 	section := p.pbxObjectSection.GetObject(pbxSectionName)
@@ -1056,6 +1844,29 @@ func (p *PbxProject) AddBuildProperty(prop, value, build_name string) {
 	}, nonCommentsFilter)
 }
 
+// AddBuildPropertyAppend adds value to a list setting such as GCC_PREPROCESSOR_DEFINITIONS instead
+// of replacing it like AddBuildProperty does. A single existing value is turned into a list and
+// values already present are not added twice.
+func (p *PbxProject) AddBuildPropertyAppend(prop, value, build_name string) {
+	value = quoteIfNeeded(value)
+	p.pbxXCBuildConfigurationSection.ForeachWithFilter(func(key string, val interface{}) pegparser.IterateActionType {
+		configuration := val.(pegparser.Object)
+		if build_name != "" && configuration.GetString("name") != build_name {
+			return pegparser.IterateActionContinue
+		}
+
+		buildSettings := configuration.GetObject("buildSettings")
+		if existing, ok := buildSettings.ForceGet(prop).(string); ok {
+			buildSettings.Set(prop, []interface{}{existing})
+		}
+		addToObjectListOnlyNotExist(buildSettings, prop, value, func(v1, v2 interface{}) bool {
+			s1, _ := v1.(string)
+			return quoteIfNeeded(s1) == v2
+		})
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+}
+
 func (p *PbxProject) RemoveBuildProperty(prop, build_name string) {
 	p.pbxXCBuildConfigurationSection.ForeachWithFilter(func(key string, val interface{}) pegparser.IterateActionType {
 		configuration := val.(pegparser.Object)
@@ -1066,26 +1877,61 @@ func (p *PbxProject) RemoveBuildProperty(prop, build_name string) {
 	}, nonCommentsFilter)
 }
 
-func (p *PbxProject) UpdateBuildProperty(prop, value, build, targetName string) {
+// SetBaseConfiguration makes the xcconfig file the baseConfigurationReference of the build
+// configuration buildName of targetName, adding the file reference to the main group if needed.
+func (p *PbxProject) SetBaseConfiguration(targetName, buildName, xcconfigPath string) error {
+	configurations := p.buildConfigurations(buildName, targetName)
+	if len(configurations) == 0 {
+		return fmt.Errorf("build configuration %s of target %s not found", buildName, targetName)
+	}
+
+	pbxfile := p.getFile(xcconfigPath)
+	if pbxfile == nil {
+		var err error
+		pbxfile, err = p.addFile(xcconfigPath, p.getFirstProject().Object.GetString("mainGroup"), newPbxFileOptions())
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, configuration := range configurations {
+		hadReference := configuration.Has("baseConfigurationReference")
+		configuration.Set("baseConfigurationReference", pbxfile.FileRef)
+		configuration.Set(toCommentKey("baseConfigurationReference"), pbxfile.Basename)
+		if !hadReference {
+			// Xcode writes it right after isa
+			configuration.MoveKey("baseConfigurationReference", 1)
+		}
+	}
+	return nil
+}
+
+// RemoveBuildPropertyForTarget removes prop only from the build configurations of targetName,
+// other targets sharing the configuration name keep it.
+func (p *PbxProject) RemoveBuildPropertyForTarget(prop, buildName, targetName string) {
+	for _, configuration := range p.buildConfigurations(buildName, targetName) {
+		configuration.GetObject("buildSettings").Delete(prop)
+	}
+}
+
+// buildConfigurations returns the XCBuildConfiguration objects named build (all when empty)
+// that belong to targetName, a target uuid or name (all targets when empty).
+func (p *PbxProject) buildConfigurations(build, targetName string) []pegparser.Object {
 	validConfigs := make(map[string]struct{})
 	if targetName != "" {
-		target := p.pbxTargetByName(targetName)
-		if !target.IsEmpty() {
-			targetBuildConfigs := target.GetString("buildConfigurationList")
-			p.pbxXCConfigurationListSection.ForeachWithFilter(func(configName string, val interface{}) pegparser.IterateActionType {
-				if targetBuildConfigs == configName {
-					buildVariants := val.(pegparser.Object).ForceGet("buildConfigurations")
-					for _, buildVariant := range buildVariants.([]interface{}) {
-						validConfigs[buildVariant.(pegparser.Object).GetString("value")] = struct{}{}
-					}
-					return pegparser.IterateActionBreak
-				}
-				return pegparser.IterateActionContinue
-			}, nonCommentsFilter)
+		target := p.pbxNativeTargetSection.GetObject(p.resolveTargetKey(targetName))
+		if target.IsEmpty() {
+			return nil
+		}
+		configurationList := p.pbxXCConfigurationListSection.GetObject(target.GetString("buildConfigurationList"))
+		buildVariants, _ := configurationList.ForceGet("buildConfigurations").([]interface{})
+		for _, buildVariant := range buildVariants {
+			validConfigs[buildVariant.(pegparser.Object).GetString("value")] = struct{}{}
 		}
 	}
 
-	p.pbxXCConfigurationListSection.ForeachWithFilter(func(configName string, val interface{}) pegparser.IterateActionType {
+	configurations := []pegparser.Object{}
+	p.pbxXCBuildConfigurationSection.ForeachWithFilter(func(configName string, val interface{}) pegparser.IterateActionType {
 		if targetName != "" {
 			_, found := validConfigs[configName]
 			if !found {
@@ -1093,15 +1939,68 @@ func (p *PbxProject) UpdateBuildProperty(prop, value, build, targetName string)
 			}
 		}
 
-		if build == "" || val.(pegparser.Object).GetString("name") == build {
-			val.(pegparser.Object).Set(prop, value)
+		if build == "" || unquoted(val.(pegparser.Object).GetString("name")) == build {
+			configurations = append(configurations, val.(pegparser.Object))
 		}
 		return pegparser.IterateActionContinue
 	}, nonCommentsFilter)
+	return configurations
+}
+
+// UpdateBuildProperty sets prop to value in the buildSettings of the XCBuildConfiguration
+// objects named build (all when empty) of targetName, a target uuid or name (all targets when empty).
+// It used to set prop on the XCConfigurationList objects themselves, where Xcode ignores it,
+// and to set nothing at all for a target.
+func (p *PbxProject) UpdateBuildProperty(prop, value, build, targetName string) {
+	for _, configuration := range p.buildConfigurations(build, targetName) {
+		configuration.GetObject("buildSettings").Set(prop, value)
+	}
+}
+
+// SetBuildSetting is UpdateBuildProperty for typed values: bools become YES/NO, ints are kept,
+// strings are quoted when needed and []string are written as a list.
+func (p *PbxProject) SetBuildSetting(prop string, value interface{}, buildName, targetName string) {
+	for _, configuration := range p.buildConfigurations(buildName, targetName) {
+		configuration.GetObject("buildSettings").Set(prop, toBuildSettingValue(value))
+	}
+}
+
+// ApplyBuildSettings sets every entry of settings on the matching build configurations.
+// Strings are quoted, bools become YES/NO and slices become arrays.
+func (p *PbxProject) ApplyBuildSettings(settings map[string]interface{}, build, targetName string) {
+	props := make([]string, 0, len(settings))
+	for prop := range settings {
+		props = append(props, prop)
+	}
+	sort.Strings(props)
+
+	for _, configuration := range p.buildConfigurations(build, targetName) {
+		buildSettings := configuration.GetObject("buildSettings")
+		for _, prop := range props {
+			buildSettings.Set(prop, toBuildSettingValue(settings[prop]))
+		}
+	}
+}
+
+// SetOnlyActiveArch sets ONLY_ACTIVE_ARCH on the Debug and Release configurations of target.
+func (p *PbxProject) SetOnlyActiveArch(target string, debug, release bool) {
+	p.ApplyBuildSettings(map[string]interface{}{"ONLY_ACTIVE_ARCH": debug}, "Debug", target)
+	p.ApplyBuildSettings(map[string]interface{}{"ONLY_ACTIVE_ARCH": release}, "Release", target)
+}
+
+// OnlyActiveArch reports the ONLY_ACTIVE_ARCH value of the build configuration of target,
+// ok is false when no configuration sets it.
+func (p *PbxProject) OnlyActiveArch(target, build string) (value, ok bool) {
+	for _, configuration := range p.buildConfigurations(build, target) {
+		if val := configuration.GetObject("buildSettings").GetString("ONLY_ACTIVE_ARCH"); val != "" {
+			return unquoted(val) == "YES", true
+		}
+	}
+	return false, false
 }
 
 func (p *PbxProject) UpdateProductName(name string) {
-	p.UpdateBuildProperty("PRODUCT_NAME", `"`+name+`"`, "", "")
+	p.UpdateBuildProperty("PRODUCT_NAME", quoteIfNeeded(name), "", "")
 }
 
 func (p *PbxProject) addToSearchPaths(searchPath string, pbxfile *PbxFile) {
@@ -1200,56 +2099,376 @@ func (p *PbxProject) productName() (name string) {
 	return
 }
 
-// // check if file is present
-func (p *PbxProject) getFile(filePath string) *PbxFile {
-	pbxfile, ok := p.pbxFileReferences[filePath]
-	if ok {
-		return pbxfile
+// ProductName returns the product name of the target (uuid or name), falling back to the name of
+// the file its productReference points at.
+func (p *PbxProject) ProductName(targetName string) string {
+	target := p.pbxNativeTargetSection.GetObject(p.resolveTargetKey(targetName))
+	if target.IsEmpty() {
+		return ""
 	}
-	pbxfile, ok = p.pbxFileReferences[`"`+filePath+`"`]
-	if ok {
-		return pbxfile
+	if productName := unquoted(target.GetString("productName")); productName != "" {
+		return productName
 	}
 
-	return nil
+	productPath := unquoted(p.pbxFileReferenceSection.GetObject(target.GetString("productReference")).GetString("path"))
+	return strings.TrimSuffix(productPath, filepath.Ext(productPath))
 }
 
-func (p *PbxProject) hasFile(filePath string) bool {
-	return p.getFile(filePath) != nil
+// ProductPath returns the path of the target's product, e.g. "MyApp.app". target is a uuid or name.
+func (p *PbxProject) ProductPath(target string) string {
+	targetObj := p.pbxNativeTargetSection.GetObject(p.resolveTargetKey(target))
+	if targetObj.IsEmpty() {
+		return ""
+	}
+	return unquoted(p.pbxFileReferenceSection.GetObject(targetObj.GetString("productReference")).GetString("path"))
 }
 
-func (p *PbxProject) AddTarget(name, targetType, subfolder, bundleId string) error {
-	// Setup uuid and name of new target
-	targetUuid := p.generateUuid()
-	targetSubfolder := subfolder
-	if targetSubfolder == "" {
-		targetSubfolder = name
-	}
-	targetName := strings.Trim(name, " ")
-	targetBundleId := bundleId
+// ProductType returns the productType of the target (uuid or name).
+func (p *PbxProject) ProductType(targetName string) string {
+	return unquoted(p.pbxNativeTargetSection.GetObject(p.resolveTargetKey(targetName)).GetString("productType"))
+}
 
-	// Check type against list of allowed target types
-	if targetName == "" {
-		return fmt.Errorf("Target name missing.")
-	}
+var deploymentTargetSettings = map[string]string{
+	"ios":      "IPHONEOS_DEPLOYMENT_TARGET",
+	"macos":    "MACOSX_DEPLOYMENT_TARGET",
+	"osx":      "MACOSX_DEPLOYMENT_TARGET",
+	"tvos":     "TVOS_DEPLOYMENT_TARGET",
+	"watchos":  "WATCHOS_DEPLOYMENT_TARGET",
+	"visionos": "XROS_DEPLOYMENT_TARGET",
+	"xros":     "XROS_DEPLOYMENT_TARGET",
+}
 
-	// Check type against list of allowed target types
-	if targetType == "" {
-		return fmt.Errorf("Target type missing.")
+// DeploymentTarget returns the deployment target of targetName for platform (ios, macos, tvos,
+// watchos or visionos), falling back to the project-level build configurations.
+func (p *PbxProject) DeploymentTarget(targetName, platform string) string {
+	prop, ok := deploymentTargetSettings[strings.ToLower(platform)]
+	if !ok {
+		return ""
 	}
 
-	// Check type against list of allowed target types
-	if producttypeForTargettype(targetType) == "" {
-		return fmt.Errorf("Target type invalid: %s\n", targetType)
+	configurations := p.buildConfigurations("", targetName)
+	if targetName != "" {
+		configurations = append(configurations, p.projectBuildConfigurations()...)
 	}
-
+	for _, configuration := range configurations {
+		val := configuration.GetObject("buildSettings").ForceGet(prop)
+		switch {
+		case val == nil:
+			continue
+		case isString(val):
+			return unquoted(toString(val))
+		case isInt(val):
+			return toIntString(val)
+		default:
+			if f, ok := val.(float64); ok {
+				return strconv.FormatFloat(f, 'f', -1, 32)
+			}
+		}
+	}
+	return ""
+}
+
+// DeploymentTargetVersion parses DeploymentTarget into its major and minor components.
+func (p *PbxProject) DeploymentTargetVersion(targetName, platform string) (major, minor int, ok bool) {
+	version := p.DeploymentTarget(targetName, platform)
+	if version == "" {
+		return 0, 0, false
+	}
+
+	parts := strings.Split(version, ".")
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	if len(parts) > 1 {
+		minor, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return major, minor, true
+}
+
+// projectBuildConfigurations returns the build configurations of the root project object.
+func (p *PbxProject) projectBuildConfigurations() []pegparser.Object {
+	return p.configurationListConfigurations(p.getFirstProject().Object.GetString("buildConfigurationList"))
+}
+
+// configurationListConfigurations returns the build configurations of an XCConfigurationList in list order.
+func (p *PbxProject) configurationListConfigurations(listKey string) []pegparser.Object {
+	configurationList := p.pbxXCConfigurationListSection.GetObject(listKey)
+	buildVariants, _ := configurationList.ForceGet("buildConfigurations").([]interface{})
+
+	configurations := []pegparser.Object{}
+	for _, buildVariant := range buildVariants {
+		configuration := p.pbxXCBuildConfigurationSection.GetObject(buildVariant.(pegparser.Object).GetString("value"))
+		if !configuration.IsEmpty() {
+			configurations = append(configurations, configuration)
+		}
+	}
+	return configurations
+}
+
+// ConfigInfo describes a build configuration, BuildSettings is a copy that can be changed freely.
+type ConfigInfo struct {
+	Name          string
+	BuildSettings pegparser.Object
+}
+
+// BuildConfigurations returns the configurations of the target's (uuid or name)
+// buildConfigurationList in list order, or those of the project when targetName is empty.
+func (p *PbxProject) BuildConfigurations(targetName string) []ConfigInfo {
+	listKey := p.getFirstProject().Object.GetString("buildConfigurationList")
+	if targetName != "" {
+		target := p.pbxNativeTargetSection.GetObject(p.resolveTargetKey(targetName))
+		if target.IsEmpty() {
+			return nil
+		}
+		listKey = target.GetString("buildConfigurationList")
+	}
+
+	configs := []ConfigInfo{}
+	for _, configuration := range p.configurationListConfigurations(listKey) {
+		configs = append(configs, ConfigInfo{
+			Name:          unquoted(configuration.GetString("name")),
+			BuildSettings: configuration.GetObject("buildSettings").Clone(),
+		})
+	}
+	return configs
+}
+
+// ConfigurationList returns the XCConfigurationList of the target (uuid or name), its
+// defaultConfigurationName is the configuration used by command line builds.
+func (p *PbxProject) ConfigurationList(targetName string) (pegparser.ObjectWithUUID, bool) {
+	target := p.pbxNativeTargetSection.GetObject(p.resolveTargetKey(targetName))
+	listKey := target.GetString("buildConfigurationList")
+	if !p.pbxXCConfigurationListSection.Has(listKey) {
+		return pegparser.ObjectWithUUID{}, false
+	}
+	return pegparser.ObjectWithUUID{
+		UUID:   listKey,
+		Object: p.pbxXCConfigurationListSection.GetObject(listKey),
+	}, true
+}
+
+// // check if file is present
+func (p *PbxProject) getFile(filePath string) *PbxFile {
+	pbxfile, ok := p.pbxFileReferences[unquoted(filePath)]
+	if ok {
+		return pbxfile
+	}
+
+	return nil
+}
+
+// FileReferenceByPath returns the PBXFileReference whose path is path, with its uuid.
+func (p *PbxProject) FileReferenceByPath(path string) (pegparser.ObjectWithUUID, bool) {
+	path = unquoted(path)
+	ref := pegparser.ObjectWithUUID{}
+	p.pbxFileReferenceSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		fileReference := value.(pegparser.Object)
+		if unquoted(fileReference.GetString("path")) == path {
+			ref = pegparser.ObjectWithUUID{
+				UUID:   key,
+				Object: fileReference,
+			}
+			return pegparser.IterateActionBreak
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	return ref, ref.UUID != ""
+}
+
+// FindFileReferencesByBasename returns every file reference whose path (or name) ends in basename,
+// e.g. to disambiguate same-named files living in different groups.
+func (p *PbxProject) FindFileReferencesByBasename(basename string) []pegparser.ObjectWithUUID {
+	refs := []pegparser.ObjectWithUUID{}
+	p.pbxFileReferenceSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		fileReference := value.(pegparser.Object)
+		path := unquoted(fileReference.GetString("path"))
+		name := unquoted(fileReference.GetString("name"))
+		if filepath.Base(path) == basename || name == basename {
+			refs = append(refs, pegparser.ObjectWithUUID{
+				UUID:   key,
+				Object: fileReference,
+			})
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	return refs
+}
+
+// PlistFiles returns the paths of the text.plist.xml file references, e.g. Info.plist candidates.
+func (p *PbxProject) PlistFiles() []string {
+	paths := []string{}
+	p.pbxFileReferenceSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		fileReference := value.(pegparser.Object)
+		filetype := fileReference.GetString("lastKnownFileType")
+		if filetype == "" {
+			filetype = fileReference.GetString("explicitFileType")
+		}
+		if unquoted(filetype) == "text.plist.xml" {
+			paths = append(paths, unquoted(fileReference.GetString("path")))
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	return paths
+}
+
+var buildSettingMacroRegex = regexp.MustCompile(`\$[({]([A-Za-z0-9_]+)[)}]`)
+
+// ResolveMacros expands $(SRCROOT), $(SOURCE_ROOT) and $(PROJECT_DIR) to srcRoot, $(PROJECT_NAME)
+// to the project's name and other macros to the project-level build setting of the same name,
+// e.g. "$(INFOPLIST_FILE)". Macros expanding to other macros are resolved too, unknown ones
+// such as $(inherited) are kept.
+func (p *PbxProject) ResolveMacros(value, srcRoot string) string {
+	macros := map[string]string{
+		"SRCROOT":     srcRoot,
+		"SOURCE_ROOT": srcRoot,
+		"PROJECT_DIR": srcRoot,
+	}
+	if projectDir := filepath.Dir(p.filePath); filepath.Ext(projectDir) == ".xcodeproj" {
+		macros["PROJECT_NAME"] = strings.TrimSuffix(filepath.Base(projectDir), ".xcodeproj")
+	}
+
+	settings := p.projectBuildConfigurations()
+	resolve := func(match string) string {
+		name := buildSettingMacroRegex.FindStringSubmatch(match)[1]
+		if macro, found := macros[name]; found {
+			return macro
+		}
+		for _, configuration := range settings {
+			if setting, ok := configuration.GetObject("buildSettings").ForceGet(name).(string); ok {
+				return unquoted(setting)
+			}
+		}
+		return match
+	}
+
+	value = unquoted(value)
+	// bounded, a setting referring to itself would never settle
+	for i := 0; i < 10; i++ {
+		resolved := buildSettingMacroRegex.ReplaceAllStringFunc(value, resolve)
+		if resolved == value {
+			break
+		}
+		value = resolved
+	}
+	return value
+}
+
+// MakePathsRelative rewrites absolute file reference paths below srcRoot relative to it,
+// with sourceTree SOURCE_ROOT, and returns the number of references changed.
+func (p *PbxProject) MakePathsRelative(srcRoot string) int {
+	srcRoot = filepath.Clean(srcRoot)
+	changed := 0
+	p.pbxFileReferenceSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		fileReference := value.(pegparser.Object)
+		path := unquoted(fileReference.GetString("path"))
+		if !filepath.IsAbs(path) {
+			return pegparser.IterateActionContinue
+		}
+		rel, err := filepath.Rel(srcRoot, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return pegparser.IterateActionContinue
+		}
+		rel = filepath.ToSlash(rel)
+
+		fileReference.Set("path", quoteIfNeeded(rel))
+		fileReference.Set("sourceTree", "SOURCE_ROOT")
+		if pbxfile, ok := p.pbxFileReferences[path]; ok {
+			delete(p.pbxFileReferences, path)
+			pbxfile.Path = rel
+			pbxfile.SourceTree = "SOURCE_ROOT"
+			p.pbxFileReferences[rel] = pbxfile
+		}
+		changed++
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	return changed
+}
+
+func (p *PbxProject) hasFile(filePath string) bool {
+	return p.getFile(filePath) != nil
+}
+
+// AddTarget adds a native target of targetType. A unit_test_bundle is hosted by the
+// project's application target when there is one, see AddUnitTestTarget.
+func (p *PbxProject) AddTarget(name, targetType, subfolder, bundleId string) error {
+	hostKey := ""
+	if targetType == "unit_test_bundle" {
+		appTarget, _ := p.AppTarget()
+		hostKey = appTarget.UUID
+	}
+	return p.addTarget(name, targetType, subfolder, bundleId, hostKey)
+}
+
+// AddUnitTestTarget adds a unit test bundle running inside hostTarget (uuid or name): TEST_HOST
+// and BUNDLE_LOADER point at the host's executable and the test target depends on the host.
+func (p *PbxProject) AddUnitTestTarget(name, hostTarget, subfolder, bundleId string) error {
+	hostKey := p.resolveTargetKey(hostTarget)
+	if !p.pbxNativeTargetSection.Has(hostKey) {
+		return fmt.Errorf("host target %s not found", hostTarget)
+	}
+	return p.addTarget(name, "unit_test_bundle", subfolder, bundleId, hostKey)
+}
+
+// testHost is the TEST_HOST value for tests hosted by the target hostKey.
+func (p *PbxProject) testHost(hostKey string) string {
+	productPath := p.ProductPath(hostKey)
+	executable := strings.TrimSuffix(productPath, filepath.Ext(productPath))
+	if p.sdkRoot(hostKey) == "macosx" {
+		return `"$(BUILT_PRODUCTS_DIR)/` + productPath + `/Contents/MacOS/` + executable + `"`
+	}
+	return `"$(BUILT_PRODUCTS_DIR)/` + productPath + `/` + executable + `"`
+}
+
+// sdkRoot returns the SDKROOT the target builds with, its own setting or else the inherited project setting.
+// Deployment targets are no hint, a multiplatform project sets several of them.
+func (p *PbxProject) sdkRoot(targetKey string) string {
+	listKey := p.pbxNativeTargetSection.GetObject(targetKey).GetString("buildConfigurationList")
+	for _, configurations := range [][]pegparser.Object{p.configurationListConfigurations(listKey), p.projectBuildConfigurations()} {
+		for _, configuration := range configurations {
+			if sdk := configuration.GetObject("buildSettings").GetString("SDKROOT"); sdk != "" {
+				return unquoted(sdk)
+			}
+		}
+	}
+	return ""
+}
+
+func (p *PbxProject) addTarget(name, targetType, subfolder, bundleId, hostKey string) error {
+	// Setup uuid and name of new target
+	targetUuid := p.generateUuid()
+	targetSubfolder := subfolder
+	if targetSubfolder == "" {
+		targetSubfolder = name
+	}
+	targetName := strings.Trim(name, " ")
+	targetBundleId := bundleId
+
+	// Check type against list of allowed target types
+	if targetName == "" {
+		return fmt.Errorf("Target name missing.")
+	}
+
+	// Check type against list of allowed target types
+	if targetType == "" {
+		return fmt.Errorf("Target type missing.")
+	}
+
+	// Check type against list of allowed target types
+	if producttypeForTargettype(targetType) == "" {
+		return fmt.Errorf("Target type invalid: %s\n", targetType)
+	}
+
 	// Build Configuration: Create
 	buildConfigurationsList := []pegparser.Object{
 		pegparser.NewObjectWithData([]pegparser.SliceItem{
 			pegparser.NewObjectItem("name", "Debug"),
 			pegparser.NewObjectItem("isa", "XCBuildConfiguration"),
 			pegparser.NewObjectItem("buildSettings", pegparser.NewObjectWithData([]pegparser.SliceItem{
-				pegparser.NewObjectItem("GCC_PREPROCESSOR_DEFINITIONS", []string{`"DEBUG=1"`, `"$(inherited)"`}),
+				pegparser.NewObjectItem("GCC_PREPROCESSOR_DEFINITIONS", []interface{}{`"DEBUG=1"`, `"$(inherited)"`}),
 				pegparser.NewObjectItem("INFOPLIST_FILE", `"`+filepath.Join(targetSubfolder, targetSubfolder+"-Info.plist"+`"`)),
 				pegparser.NewObjectItem("LD_RUNPATH_SEARCH_PATHS", `"$(inherited) @executable_path/Frameworks @executable_path/../../Frameworks"`),
 				pegparser.NewObjectItem("PRODUCT_NAME", `"`+targetName+`"`),
@@ -1275,6 +2494,15 @@ func (p *PbxProject) AddTarget(name, targetType, subfolder, bundleId string) err
 		}
 	}
 
+	// Host the tests in the host application
+	if hostKey != "" {
+		testHost := p.testHost(hostKey)
+		for _, buildConfiguration := range buildConfigurationsList {
+			buildConfiguration.GetObject("buildSettings").Set("TEST_HOST", testHost)
+			buildConfiguration.GetObject("buildSettings").Set("BUNDLE_LOADER", `"$(TEST_HOST)"`)
+		}
+	}
+
 	// Build Configuration: Add
 	buildConfigurations := p.addXCConfigurationList(buildConfigurationsList, "Release", `Build configuration list for PBXNativeTarget "`+targetName+`"`)
 
@@ -1307,25 +2535,33 @@ func (p *PbxProject) AddTarget(name, targetType, subfolder, bundleId string) err
 	// Target: Add to PBXNativeTarget section
 	p.addToPbxNativeTargetSection(targetUuid, target)
 
+	// Build phases: the ones Xcode's templates create, so the target builds
+	if _, found := targetTypesWithStandardBuildPhases[targetType]; found {
+		p.EnsureStandardBuildPhases(targetUuid)
+	}
+
+	// the app to embed into and depend from, a project without targets has none
+	firstTarget, hasFirstTarget := p.getFirstTarget()
+
 	// Product: Embed (only for "extension"-type targets)
-	if targetType == "app_extension" {
+	if targetType == "app_extension" && hasFirstTarget {
 
 		// Create CopyFiles phase in first target
-		p.AddBuildPhase([]string{}, "PBXCopyFilesBuildPhase", "Copy Files", p.getFirstTarget().UUID, targetType, "")
+		p.AddBuildPhase([]string{}, "PBXCopyFilesBuildPhase", "Copy Files", firstTarget.UUID, targetType, "")
 
 		// Add product to CopyFiles phase
 		p.addToPbxCopyfilesBuildPhase(productFile)
 
 		// this.addBuildPhaseToTarget(newPhase.buildPhase, this.getFirstTarget().uuid)
-	} else if targetType == "watch2_app" {
+	} else if targetType == "watch2_app" && hasFirstTarget {
 		// Create CopyFiles phase in first target
 		p.AddBuildPhase(
 			[]string{targetName + ".app"},
 			"PBXCopyFilesBuildPhase",
 			"Embed Watch Content",
-			p.getFirstTarget().UUID,
+			firstTarget.UUID,
 			targetType,
-			`"$(CONTENTS_FOLDER_PATH)/Watch"`,
+			"$(CONTENTS_FOLDER_PATH)/Watch",
 		)
 	} else if targetType == "watch2_extension" {
 		// Create CopyFiles phase in watch target (if exists)
@@ -1351,10 +2587,153 @@ func (p *PbxProject) AddTarget(name, targetType, subfolder, bundleId string) err
 		if watch2Target.UUID != "" {
 			p.AddTargetDependency(watch2Target.UUID, []string{targetUuid})
 		}
-	} else {
-		p.AddTargetDependency(p.getFirstTarget().UUID, []string{targetUuid})
+	} else if targetType == "unit_test_bundle" {
+		if hostKey != "" {
+			p.AddTargetDependency(targetUuid, []string{hostKey})
+		}
+	} else if hasFirstTarget {
+		p.AddTargetDependency(firstTarget.UUID, []string{targetUuid})
+	}
+
+	return nil
+}
+
+// AddAggregateTarget adds a PBXAggregateTarget, a target without product whose build phases
+// usually run scripts, and returns its uuid.
+func (p *PbxProject) AddAggregateTarget(name string) (string, error) {
+	targetName := strings.TrimSpace(name)
+	if targetName == "" {
+		return "", fmt.Errorf("Target name missing.")
+	}
+	for _, isa := range []string{"PBXNativeTarget", "PBXAggregateTarget"} {
+		for _, target := range p.ObjectsByISA(isa) {
+			if unquoted(target.Object.GetString("name")) == targetName {
+				return "", fmt.Errorf("target %s already exists", targetName)
+			}
+		}
+	}
+
+	buildConfigurationsList := []pegparser.Object{}
+	for _, buildName := range []string{"Debug", "Release"} {
+		buildConfigurationsList = append(buildConfigurationsList, pegparser.NewObjectWithData([]pegparser.SliceItem{
+			pegparser.NewObjectItem("isa", "XCBuildConfiguration"),
+			pegparser.NewObjectItem("buildSettings", pegparser.NewObjectWithData([]pegparser.SliceItem{
+				pegparser.NewObjectItem("PRODUCT_NAME", `"$(TARGET_NAME)"`),
+			})),
+			pegparser.NewObjectItem("name", buildName),
+		}))
+	}
+	comment := `Build configuration list for PBXAggregateTarget "` + targetName + `"`
+	buildConfigurations := p.addXCConfigurationList(buildConfigurationsList, "Release", comment)
+
+	targetUuid := p.generateUuid()
+	target := pegparser.NewObjectWithData([]pegparser.SliceItem{
+		pegparser.NewObjectItem("isa", "PBXAggregateTarget"),
+		pegparser.NewObjectItem("buildConfigurationList", buildConfigurations.UUID),
+		pegparser.NewObjectItem(toCommentKey("buildConfigurationList"), comment),
+		pegparser.NewObjectItem("buildPhases", []interface{}{}),
+		pegparser.NewObjectItem("dependencies", []interface{}{}),
+		pegparser.NewObjectItem("name", quoteIfNeeded(targetName)),
+		pegparser.NewObjectItem("productName", quoteIfNeeded(targetName)),
+	})
+
+	aggregateTargetSection := p.pbxObjectSection.GetObject("PBXAggregateTarget")
+	if !p.pbxObjectSection.Has("PBXAggregateTarget") {
+		p.pbxObjectSection.Set("PBXAggregateTarget", aggregateTargetSection)
+	}
+	aggregateTargetSection.Set(targetUuid, target)
+	aggregateTargetSection.Set(toCommentKey(targetUuid), targetName)
+	p.addToPbxProjectSection(targetUuid, target)
+	return targetUuid, nil
+}
+
+// RemoveEmbeddedExtension takes the app extension product (e.g. "Share.appex" or "Share") out of
+// every copy files phase embedding it and drops the matching build files. The extension target
+// and its product reference are kept.
+func (p *PbxProject) RemoveEmbeddedExtension(extensionProductName string) error {
+	if filepath.Ext(extensionProductName) == "" {
+		extensionProductName += ".appex"
+	}
+
+	productRefs := map[string]struct{}{}
+	p.pbxFileReferenceSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		if unquoted(value.(pegparser.Object).GetString("path")) == extensionProductName {
+			productRefs[key] = struct{}{}
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	if len(productRefs) == 0 {
+		return fmt.Errorf("extension %s not found", extensionProductName)
+	}
+
+	removed := false
+	p.pbxObjectSection.GetObject("PBXCopyFilesBuildPhase").ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		copyFilesPhase := value.(pegparser.Object)
+		files, _ := copyFilesPhase.ForceGet("files").([]interface{})
+		kept := []interface{}{}
+		for _, file := range files {
+			entry, ok := file.(pegparser.Object)
+			if !ok {
+				kept = append(kept, file)
+				continue
+			}
+			buildFileKey := entry.GetString("value")
+			if _, found := productRefs[p.pbxBuildFileSection.GetObject(buildFileKey).GetString("fileRef")]; found {
+				p.pbxBuildFileSection.Delete(buildFileKey)
+				p.pbxBuildFileSection.Delete(toCommentKey(buildFileKey))
+				removed = true
+				continue
+			}
+			kept = append(kept, file)
+		}
+		if len(kept) != len(files) {
+			copyFilesPhase.Set("files", kept)
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+
+	if !removed {
+		return fmt.Errorf("extension %s is not embedded", extensionProductName)
+	}
+	return nil
+}
+
+// AddEntitlements adds the entitlements file to the target's group and points
+// CODE_SIGN_ENTITLEMENTS of all the target's configurations at it. filePath is relative to the
+// project, targetName is a target uuid or name.
+func (p *PbxProject) AddEntitlements(filePath, targetName string) error {
+	targetKey := p.resolveTargetKey(targetName)
+	if targetKey == "" {
+		return fmt.Errorf("target %s not found", targetName)
+	}
+	targetName = unquoted(p.pbxNativeTargetSection.GetObject(targetKey).GetString("name"))
+
+	filePath = filepath.ToSlash(filePath)
+	groupKey := p.findPBXGroupKey(FindGroupCriteria{Name: targetName})
+	if groupKey == "" {
+		groupKey = p.findPBXGroupKey(FindGroupCriteria{Path: targetName})
+	}
+	if groupKey == "" {
+		groupKey = p.getFirstProject().GetString("mainGroup")
+	}
+	group := p.getPBXGroupByKey(groupKey)
+	if group.IsEmpty() {
+		return fmt.Errorf("group for target %s not found", targetName)
+	}
+
+	// the reference path is relative to its group
+	refPath := filePath
+	if groupPath := unquoted(group.GetString("path")); groupPath != "" {
+		refPath = strings.TrimPrefix(filePath, groupPath+"/")
+	}
+	if !p.hasFile(refPath) {
+		pbxfile := newPbxFile(refPath, newPbxFileOptions())
+		pbxfile.FileRef = p.generateUuid()
+		p.addToPbxFileReferenceSection(pbxfile)                               // PBXFileReference
+		addToObjectList(group, "children", pbxGroupChild(pbxfile).ToObject()) // PBXGroup
 	}
 
+	p.UpdateBuildProperty("CODE_SIGN_ENTITLEMENTS", quoteIfNeeded(filePath), "", targetKey)
 	return nil
 }
 
@@ -1371,16 +2750,32 @@ func pbxBuildFileObj(pbxfile *PbxFile) pegparser.Object {
 }
 
 func newPbxFileReferenceObj(pbxfile *PbxFile) pegparser.Object {
-	return pegparser.NewObjectWithData([]pegparser.SliceItem{
+	path := filepath.ToSlash(pbxfile.Path)
+	items := []pegparser.SliceItem{
 		pegparser.NewObjectItem("isa", "PBXFileReference"),
-		pegparser.NewObjectItem("name", `"`+pbxfile.Basename+`"`),
-		pegparser.NewObjectItem("fileEncoding", pbxfile.FileEncoding),
-		pegparser.NewObjectItem("lastKnownFileType", pbxfile.LastKnownFileType),
-		pegparser.NewObjectItem("path", filepath.ToSlash(pbxfile.Path)),
-		pegparser.NewObjectItem("sourceTree", pbxfile.SourceTree),
-		pegparser.NewObjectItem("explicitFileType", pbxfile.ExplicitFileType),
-		pegparser.NewObjectItem("includeInIndex", pbxfile.IncludeInIndex),
-	})
+	}
+	// like Xcode, name only when it isn't the last component of path
+	if pbxfile.Basename != filepath.Base(unquoted(path)) {
+		items = append(items, pegparser.NewObjectItem("name", quoteIfNeeded(pbxfile.Basename)))
+	}
+	if pbxfile.FileEncoding != 0 {
+		items = append(items, pegparser.NewObjectItem("fileEncoding", pbxfile.FileEncoding))
+	}
+	if pbxfile.LastKnownFileType != "" {
+		items = append(items, pegparser.NewObjectItem("lastKnownFileType", quoteIfNeeded(pbxfile.LastKnownFileType)))
+	}
+	items = append(items,
+		pegparser.NewObjectItem("path", quoteIfNeeded(path)),
+		pegparser.NewObjectItem("sourceTree", quoteIfNeeded(pbxfile.SourceTree)),
+	)
+	// products are the references with an explicit type, Xcode keeps them out of the index
+	if pbxfile.ExplicitFileType != "" {
+		items = append(items, pegparser.NewObjectItem("explicitFileType", quoteIfNeeded(pbxfile.ExplicitFileType)))
+	}
+	if pbxfile.ExplicitFileType != "" || pbxfile.IncludeInIndex != 0 {
+		items = append(items, pegparser.NewObjectItem("includeInIndex", pbxfile.IncludeInIndex))
+	}
+	return pegparser.NewObjectWithData(items)
 }
 
 func pbxGroupChild(pbxfile *PbxFile) CommentValue {
@@ -1397,10 +2792,10 @@ func pbxBuildPhaseObj(pbxfile *PbxFile) pegparser.Object {
 	return obj
 }
 
-func pbxCopyFilesBuildPhaseObj(obj pegparser.Object, folderType, subfolderPath, phaseName string) pegparser.Object {
-
-	// Add additional properties for "CopyFiles" build phase
-	DESTINATION_BY_TARGETTYPE := map[string]string{
+// the copy files destination of each target type's product, the dstSubfolderSpec of each destination
+// and the dstPath of destinations that need one
+var (
+	DESTINATION_BY_TARGETTYPE = map[string]string{
 		"application":       "wrapper",
 		"app_extension":     "plugins",
 		"bundle":            "wrapper",
@@ -1415,7 +2810,7 @@ func pbxCopyFilesBuildPhaseObj(obj pegparser.Object, folderType, subfolderPath,
 		"watch_extension":   "plugins",
 		"watch2_extension":  "plugins",
 	}
-	SUBFOLDERSPEC_BY_DESTINATION := map[string]int{
+	SUBFOLDERSPEC_BY_DESTINATION = map[string]int{
 		"absolute_path":      0,
 		"executables":        6,
 		"frameworks":         10,
@@ -1428,14 +2823,24 @@ func pbxCopyFilesBuildPhaseObj(obj pegparser.Object, folderType, subfolderPath,
 		"wrapper":            1,
 		"xpc_services":       0,
 	}
+	DSTPATH_BY_DESTINATION = map[string]string{
+		"xpc_services": "$(CONTENTS_FOLDER_PATH)/XPCServices",
+	}
+)
 
-	obj.Set("name", `"`+phaseName+`"`)
+func pbxCopyFilesBuildPhaseObj(obj pegparser.Object, folderType, subfolderPath, phaseName string) pegparser.Object {
 
-	if subfolderPath == "" {
-		subfolderPath = `""`
+	// folderType is a target type or, for phases created by destination, the destination itself
+	destination, ok := DESTINATION_BY_TARGETTYPE[folderType]
+	if !ok {
+		destination = folderType
 	}
-	obj.Set("dstPath", subfolderPath)
-	obj.Set("dstSubfolderSpec", SUBFOLDERSPEC_BY_DESTINATION[DESTINATION_BY_TARGETTYPE[folderType]])
+
+	obj.Set("name", `"`+phaseName+`"`)
+
+	// quoted exactly once whether or not the caller quoted it, empty is written as ""
+	obj.Set("dstPath", quoteIfNeeded(subfolderPath))
+	obj.Set("dstSubfolderSpec", SUBFOLDERSPEC_BY_DESTINATION[destination])
 	return obj
 }
 
@@ -1476,7 +2881,7 @@ func pbxFileReferenceComment(pbxfile *PbxFile) string {
 }
 
 func pbxNativeTargetComment(target pegparser.Object) string {
-	return target.GetString("name")
+	return unquoted(target.GetString("name"))
 }
 
 func longComment(pbxfile *PbxFile) string {
@@ -1496,16 +2901,17 @@ func (p *PbxProject) correctForFrameworksPath(pbxFile *PbxFile) *PbxFile {
 	return p.correctForPath(pbxFile, "Frameworks")
 }
 
+// correctForPath makes pbxFile.Path relative to the group groupName when the group has a path,
+// e.g. Resources/foo.png becomes foo.png in a group with path resources.
 func (p *PbxProject) correctForPath(pbxFile *PbxFile, groupName string) *PbxFile {
-	r_group_dir := regexp.MustCompile("^" + groupName + "[\\\\/]")
-
 	group := p.pbxGroupByName(groupName)
-	if !group.IsEmpty() {
-		if group.GetString("path") != "" {
-			pbxFile.Path = r_group_dir.ReplaceAllString(pbxFile.Path, "")
-		}
+	groupPath := strings.Trim(filepath.ToSlash(unquoted(group.GetString("path"))), "/")
+	if groupPath == "" {
+		return pbxFile
 	}
 
+	r_group_dir := regexp.MustCompile("(?i)^" + regexp.QuoteMeta(groupPath) + "[\\\\/]")
+	pbxFile.Path = r_group_dir.ReplaceAllString(pbxFile.Path, "")
 	return pbxFile
 }
 
@@ -1626,37 +3032,64 @@ func (p *PbxProject) getFirstProject() pegparser.ObjectWithUUID {
 	}
 }
 
-func (p *PbxProject) getFirstTarget() pegparser.ObjectWithUUID {
+// RootProject returns the PBXProject object with its uuid.
+func (p *PbxProject) RootProject() pegparser.ObjectWithUUID {
+	return p.getFirstProject()
+}
+
+// ProjectAttributes returns the attributes of the PBXProject object, e.g. LastUpgradeCheck and TargetAttributes.
+// An empty object is returned when the project has no attributes.
+func (p *PbxProject) ProjectAttributes() pegparser.Object {
+	return p.projectAttributes("", false)
+}
+
+// getFirstTarget returns false for projects without targets, e.g. a freshly created project.
+func (p *PbxProject) getFirstTarget() (pegparser.ObjectWithUUID, bool) {
 	project := p.getFirstProject()
-	firstTargetUuid := project.Object.ForceGet("targets").([]interface{})[0].(pegparser.Object).GetString("value")
+	if project.UUID == "" {
+		return pegparser.ObjectWithUUID{}, false
+	}
+	targets, _ := project.Object.ForceGet("targets").([]interface{})
+	if len(targets) == 0 {
+		return pegparser.ObjectWithUUID{}, false
+	}
+	firstTargetUuid := targets[0].(pegparser.Object).GetString("value")
 	firstTarget := p.pbxNativeTargetSection.GetObject(firstTargetUuid)
 
 	return pegparser.ObjectWithUUID{
 		UUID:   firstTargetUuid,
 		Object: firstTarget,
-	}
+	}, true
 }
 
 func (p *PbxProject) getTarget(productType string) (targetWithUUID pegparser.ObjectWithUUID) {
 	project := p.getFirstProject()
-	targets := project.Object.GetObject("targets")
+	if project.UUID == "" {
+		return
+	}
 
-	targets.Foreach(func(key string, value interface{}) pegparser.IterateActionType {
+	targets, _ := project.Object.ForceGet("targets").([]interface{})
+	for _, value := range targets {
 		targetUUID := value.(pegparser.Object).GetString("value")
 		target := p.pbxNativeTargetSection.GetObject(targetUUID)
-		if target.GetString("productType") == `"`+productType+`"` {
-			targetWithUUID = pegparser.ObjectWithUUID{
+		if unquoted(target.GetString("productType")) == productType {
+			return pegparser.ObjectWithUUID{
 				UUID:   targetUUID,
 				Object: target,
 			}
-			return pegparser.IterateActionBreak
 		}
-		return pegparser.IterateActionContinue
-	})
+	}
 
 	return
 }
 
+// AppTarget returns the first target producing an application, which is not
+// necessarily the first target of the project.
+func (p *PbxProject) AppTarget() (pegparser.ObjectWithUUID, bool) {
+	target := p.getTarget(producttypeForTargettype("application"))
+	return target, target.UUID != ""
+}
+
 func (p *PbxProject) addToPbxGroupType(childGroup CommentValue, groupKey, groupType string) {
 	group := p.getPBXGroupByKeyAndType(groupKey, groupType)
 	if group.IsEmpty() {
@@ -1666,7 +3099,7 @@ func (p *PbxProject) addToPbxGroupType(childGroup CommentValue, groupKey, groupT
 	if children == nil {
 		return
 	}
-	children = append(children.([]interface{}), childGroup)
+	children = append(children.([]interface{}), childGroup.ToObject())
 	group.Set("children", children)
 }
 
@@ -1681,7 +3114,7 @@ func (p *PbxProject) addToPbxGroupByKey(pbxfile *PbxFile, groupKey string) {
 func (p *PbxProject) pbxCreateGroupWithType(name, pathName, groupType string) string {
 	//Create object
 	model := pegparser.NewObjectWithData([]pegparser.SliceItem{
-		pegparser.NewObjectItem("isa", `"`+groupType+`"`),
+		pegparser.NewObjectItem("isa", groupType),
 		pegparser.NewObjectItem("children", []interface{}{}),
 		pegparser.NewObjectItem("name", name),
 		pegparser.NewObjectItem("sourceTree", `"<group>"`),
@@ -1693,10 +3126,12 @@ func (p *PbxProject) pbxCreateGroupWithType(name, pathName, groupType string) st
 	key := p.generateUuid()
 
 	//add obj and commentObj to groups;
-	group := p.pbxGroupSection.GetObject(groupType)
-	if group.IsEmpty() {
-		group = pegparser.NewObject()
-		p.pbxGroupSection.Set(groupType, group)
+	group := p.pbxObjectSection.GetObject(groupType)
+	if !p.pbxObjectSection.Has(groupType) {
+		p.pbxObjectSection.Set(groupType, group)
+		if groupType == "PBXGroup" {
+			p.pbxGroupSection = group
+		}
 	}
 
 	group.Set(key, model)
@@ -1760,20 +3195,33 @@ func (p *PbxProject) findPBXGroupKeyAndType(criteria FindGroupCriteria, groupTyp
 	groups := p.pbxObjectSection.GetObject(groupType)
 	groups.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
 		group := value.(pegparser.Object)
-		if criteria.Name != "" && criteria.Name != group.GetString("name") {
+		if criteria.Name != "" && unquoted(criteria.Name) != unquoted(group.GetString("name")) {
 			return pegparser.IterateActionContinue
 		}
 
-		if criteria.Path != "" && criteria.Path != group.GetString("path") {
+		if criteria.Path != "" && unquoted(criteria.Path) != unquoted(group.GetString("path")) {
 			return pegparser.IterateActionContinue
 		}
 
 		target = key
 		return pegparser.IterateActionBreak
-	}, onlyCommentsFilter)
+	}, nonCommentsFilter)
 	return
 }
 
+// Groups returns every PBXGroup of the project in section order.
+func (p *PbxProject) Groups() []pegparser.ObjectWithUUID {
+	groups := []pegparser.ObjectWithUUID{}
+	p.pbxGroupSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		groups = append(groups, pegparser.ObjectWithUUID{
+			UUID:   key,
+			Object: value.(pegparser.Object),
+		})
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	return groups
+}
+
 func (p *PbxProject) findPBXGroupKey(criteria FindGroupCriteria) string {
 	return p.findPBXGroupKeyAndType(criteria, "PBXGroup")
 }
@@ -1800,25 +3248,43 @@ func (p *PbxProject) AddLocalizationVariantGroup(name string) *PbxFile {
 		Uuid:     p.generateUuid(),
 		FileRef:  groupKey,
 		Basename: name,
+		Group:    "Resources",
 	}
 	p.addToPbxBuildFileSection(localizationVariantGroup)    // PBXBuildFile
 	p.addToPbxResourcesBuildPhase(localizationVariantGroup) //PBXResourcesBuildPhase
 	return localizationVariantGroup
 }
 
-func (p *PbxProject) AddKnownRegion(name string) {
-	firstProject := p.getFirstProject()
-	if firstProject.UUID == "" {
-		return
+// AddToLocalizationVariantGroup adds the localized file (e.g. "fr.lproj/Localizable.strings")
+// for language to the variant group created by AddLocalizationVariantGroup.
+func (p *PbxProject) AddToLocalizationVariantGroup(groupName, language, filePath string) (*PbxFile, error) {
+	groupKey := p.findPBXVariantGroupKey(FindGroupCriteria{Name: groupName})
+	if groupKey == "" {
+		return nil, fmt.Errorf("variant group %s not found", groupName)
 	}
 
-	project := p.pbxProjectSection.GetObject(firstProject.GetString("project"))
-	if project.IsEmpty() {
-		return
+	pbxfile := newPbxFile(filePath, newPbxFileOptions())
+	if p.hasFile(pbxfile.Path) {
+		return nil, fmt.Errorf("file %s already exists", pbxfile.Path)
 	}
-	if !project.Has("knownRegions") {
-		project.Set("knownRegions", []string{name})
-	} else if !p.HasKnownRegion(name) {
+	pbxfile.Basename = language
+	pbxfile.FileRef = p.generateUuid()
+	p.addToPbxFileReferenceSection(pbxfile) // PBXFileReference
+
+	group := p.getPBXVariantGroupByKey(groupKey)
+	addToObjectList(group, "children", pbxGroupChild(pbxfile).ToObject()) // PBXVariantGroup
+	return pbxfile, nil
+}
+
+func (p *PbxProject) AddKnownRegion(name string) {
+	project := p.getFirstProject()
+	if project.UUID == "" {
+		return
+	}
+
+	if !project.Has("knownRegions") {
+		project.Set("knownRegions", []interface{}{name})
+	} else if !p.HasKnownRegion(name) {
 		knownRegions := project.ForceGet("knownRegions").([]interface{})
 		knownRegions = append(knownRegions, name)
 		project.Set("knownRegions", knownRegions)
@@ -1826,53 +3292,227 @@ func (p *PbxProject) AddKnownRegion(name string) {
 }
 
 func (p *PbxProject) RemoveKnownRegion(name string) {
-	firstProject := p.getFirstProject()
-	if firstProject.UUID == "" {
+	project := p.getFirstProject()
+	if project.UUID == "" {
 		return
 	}
 
-	projectUuid := firstProject.GetString("project")
-	project := p.pbxProjectSection.GetObject(projectUuid)
-	if project.IsEmpty() {
+	removeFromObjectList(project.Object, "knownRegions", func(v interface{}) bool {
+		return unquoted(v.(string)) == unquoted(name)
+	}, false)
+}
+
+func (p *PbxProject) HasKnownRegion(name string) bool {
+	for _, region := range p.KnownRegions() {
+		if region == unquoted(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KnownRegions returns the project's knownRegions in order, without quotes.
+func (p *PbxProject) KnownRegions() []string {
+	project := p.getFirstProject()
+	if project.UUID == "" {
+		return nil
+	}
+
+	knownRegions := interfaceToStringSlice(project.ForceGet("knownRegions"))
+	for i, region := range knownRegions {
+		knownRegions[i] = unquoted(region)
+	}
+	return knownRegions
+}
+
+// EnableLocalization adds Base and the locales to the known regions. Without a development
+// region the first locale, or en, becomes the development region.
+func (p *PbxProject) EnableLocalization(locales []string) {
+	project := p.getFirstProject()
+	if project.UUID == "" {
 		return
 	}
-	knownRegions := project.ForceGet("knownRegions")
-	if knownRegions == nil {
+
+	for _, locale := range append([]string{"Base"}, locales...) {
+		p.AddKnownRegion(quoteIfNeeded(locale))
+	}
+	if unquoted(project.GetString("developmentRegion")) == "" {
+		region := "en"
+		if len(locales) > 0 {
+			region = locales[0]
+		}
+		p.SetDevelopmentRegion(region)
+	}
+}
+
+// AddKnownAssetTag adds an on-demand resources tag to the KnownAssetTags project attribute.
+func (p *PbxProject) AddKnownAssetTag(tag string) {
+	if p.getFirstProject().UUID == "" {
 		return
 	}
+	// addToObjectListOnlyNotExist skips empty objects, attributes may be new or written as {}
+	attributes := p.projectAttributes("", true)
+	knownAssetTags, _ := attributes.ForceGet("KnownAssetTags").([]interface{})
+	for _, knownTag := range knownAssetTags {
+		if s, ok := knownTag.(string); ok && unquoted(s) == unquoted(tag) {
+			return
+		}
+	}
+	attributes.Set("KnownAssetTags", append(knownAssetTags, quoteIfNeeded(tag)))
+}
+
+// SetFileAssetTags replaces the ASSET_TAGS of every build file of the file at path, the tags
+// become known asset tags of the project as well.
+func (p *PbxProject) SetFileAssetTags(path string, tags []string) error {
+	fileReference, ok := p.FileReferenceByPath(path)
+	if !ok {
+		return fmt.Errorf("file %s not found", path)
+	}
 
-	for i, v := range knownRegions.([]interface{}) {
-		if v.(string) == name {
-			knownRegions = append(knownRegions.([]interface{})[:i], knownRegions.([]interface{})[i+1:]...)
-			project.Set("knownRegions", knownRegions)
-			break
+	assetTags := []interface{}{}
+	for _, tag := range tags {
+		assetTags = append(assetTags, quoteIfNeeded(tag))
+		p.AddKnownAssetTag(tag)
+	}
+
+	found := false
+	p.pbxBuildFileSection.ForeachWithFilter(func(_ string, value interface{}) pegparser.IterateActionType {
+		buildFile := value.(pegparser.Object)
+		if buildFile.GetString("fileRef") != fileReference.UUID {
+			return pegparser.IterateActionContinue
 		}
+		found = true
+		settings := buildFile.GetObject("settings")
+		if !buildFile.Has("settings") {
+			buildFile.Set("settings", settings)
+		}
+		settings.Set("ASSET_TAGS", assetTags)
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	if !found {
+		return fmt.Errorf("file %s is not in a build phase", path)
 	}
+	return nil
 }
 
-func (p *PbxProject) HasKnownRegion(name string) bool {
-	firstProject := p.getFirstProject()
-	if firstProject.UUID == "" {
-		return false
+func (p *PbxProject) ObjectVersion() int {
+	return p.topProjectSection.GetInt("objectVersion")
+}
+
+func (p *PbxProject) SetObjectVersion(version int) {
+	p.topProjectSection.Set("objectVersion", version)
+}
+
+// xcodeVersionByObjectVersion maps the objectVersion of a file to the oldest Xcode writing it.
+var xcodeVersionByObjectVersion = map[int]string{
+	46: "Xcode 3.2+",
+	47: "Xcode 6.3+",
+	48: "Xcode 8+",
+	50: "Xcode 9.3+",
+	51: "Xcode 10+",
+	52: "Xcode 11+",
+	53: "Xcode 11.4+",
+	54: "Xcode 12+",
+	55: "Xcode 13+",
+	56: "Xcode 14+",
+	60: "Xcode 15+",
+	63: "Xcode 15.3+",
+	70: "Xcode 16+",
+	77: "Xcode 16+",
+}
+
+// LikelyXcodeVersion returns a best-effort guess of the Xcode version that wrote the file,
+// from objectVersion or else the LastUpgradeCheck attribute, e.g. "Xcode 14+".
+func (p *PbxProject) LikelyXcodeVersion() string {
+	if version, ok := xcodeVersionByObjectVersion[p.ObjectVersion()]; ok {
+		return version
 	}
 
-	projectUuid := firstProject.GetString("project")
-	project := p.pbxProjectSection.GetObject(projectUuid)
-	if project.IsEmpty() {
-		return false
+	// LastUpgradeCheck is written as MMmp, 1320 is Xcode 13.2
+	lastUpgradeCheck := p.projectAttributes("", false).GetInt("LastUpgradeCheck")
+	if lastUpgradeCheck <= 0 {
+		return ""
+	}
+	major, minor := lastUpgradeCheck/100, lastUpgradeCheck%100/10
+	if minor == 0 {
+		return fmt.Sprintf("Xcode %d+", major)
 	}
-	knownRegions := project.ForceGet("knownRegions")
-	if knownRegions == nil {
+	return fmt.Sprintf("Xcode %d.%d+", major, minor)
+}
+
+func (p *PbxProject) CompatibilityVersion() string {
+	project := p.getFirstProject()
+	if project.UUID == "" {
+		return ""
+	}
+	return unquoted(project.Object.GetString("compatibilityVersion"))
+}
+
+func (p *PbxProject) SetCompatibilityVersion(version string) {
+	project := p.getFirstProject()
+	if project.UUID == "" {
+		return
+	}
+	project.Object.Set("compatibilityVersion", quoteIfNeeded(unquoted(version)))
+}
+
+func (p *PbxProject) HasScannedForEncodings() bool {
+	project := p.getFirstProject()
+	if project.UUID == "" {
 		return false
 	}
+	return project.Object.GetInt("hasScannedForEncodings") == 1
+}
 
-	for _, v := range knownRegions.([]interface{}) {
-		if v.(string) == name {
-			return true
-		}
+// SetHasScannedForEncodings writes the flag as Xcode does, 0 or 1, keeping its place when present.
+func (p *PbxProject) SetHasScannedForEncodings(scanned bool) {
+	project := p.getFirstProject()
+	if project.UUID == "" {
+		return
 	}
+	value := int64(0)
+	if scanned {
+		value = 1
+	}
+	project.Object.Set("hasScannedForEncodings", value)
+}
 
-	return false
+// SetDevelopmentRegion sets the project's development region and adds it to the known regions.
+func (p *PbxProject) SetDevelopmentRegion(region string) {
+	project := p.getFirstProject()
+	if project.UUID == "" {
+		return
+	}
+	project.Set("developmentRegion", quoteIfNeeded(region))
+	p.AddKnownRegion(quoteIfNeeded(region))
+}
+
+func (p *PbxProject) SetOrganizationName(name string) {
+	p.projectAttributes("", true).Set("ORGANIZATIONNAME", quoteIfNeeded(name))
+}
+
+// SetLastUpgradeCheck sets the Xcode version the project was last upgraded with, written as MMmp, e.g. "1320".
+func (p *PbxProject) SetLastUpgradeCheck(version string) error {
+	return p.setXcodeVersionAttribute("LastUpgradeCheck", version)
+}
+
+// SetLastSwiftMigration sets the project's LastSwiftMigration, the Xcode version, e.g. "1320", of the last Swift migration.
+func (p *PbxProject) SetLastSwiftMigration(version string) error {
+	return p.setXcodeVersionAttribute("LastSwiftMigration", version)
+}
+
+// setXcodeVersionAttribute writes version, which must be all digits, unquoted like Xcode does.
+func (p *PbxProject) setXcodeVersionAttribute(key, version string) error {
+	if version == "" || strings.TrimLeft(version, "0123456789") != "" {
+		return fmt.Errorf("invalid %s %q, want digits like 1320", key, version)
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return err
+	}
+	p.projectAttributes("", true).Set(key, v)
+	return nil
 }
 
 func (p *PbxProject) getPBXObject(name string) pegparser.Object {
@@ -1888,7 +3528,7 @@ func (p *PbxProject) addFile(path, group string, opts PbxFileOptions) (*PbxFile,
 	pbxfile.FileRef = p.generateUuid()
 	p.addToPbxFileReferenceSection(pbxfile) // PBXFileReference
 	if !p.getPBXGroupByKey(group).IsEmpty() {
-		p.addToPbxGroup(pbxfile, group) // PBXGroup
+		p.addToPbxGroupByKey(pbxfile, group) // PBXGroup
 	} else if !p.getPBXVariantGroupByKey(group).IsEmpty() {
 		p.addToPbxVariantGroup(pbxfile, group) // PBXVariantGroup
 	}
@@ -1902,13 +3542,129 @@ func (p *PbxProject) AddFile(filePath string, params ...interface{}) error {
 	return err
 }
 
+// AddFileAuto adds filePath with the specialized adder matching its detected type: sources go
+// to AddSourceFile, headers to AddHeaderFile, frameworks and libraries to AddFramework and
+// everything else, asset catalogs included, to AddResourceFile.
+func (p *PbxProject) AddFileAuto(filePath, group string, opts PbxFileOptions) (*PbxFile, error) {
+	existing := make(map[string]struct{}, len(p.pbxFileReferences))
+	for path := range p.pbxFileReferences {
+		existing[path] = struct{}{}
+	}
+
+	detected := newPbxFile(filePath, opts)
+	var err error
+	switch {
+	case unquoted(detected.LastKnownFileType) == "sourcecode.c.h":
+		err = p.AddHeaderFile(filePath, group, opts)
+	case detected.Group == "Sources":
+		err = p.AddSourceFile(filePath, group, opts)
+	case detected.Group == "Frameworks" || detected.Group == "Embed Frameworks":
+		err = p.AddFramework(filePath, opts)
+	default:
+		err = p.AddResourceFile(filePath, group, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the adders may have corrected the path, pick the reference that was just added
+	for path, pbxfile := range p.pbxFileReferences {
+		if _, found := existing[path]; !found && pbxfile.Basename == detected.Basename {
+			return pbxfile, nil
+		}
+	}
+	return p.getFile(detected.Path), nil
+}
+
+// AddFileToGroupKey adds file, a *PbxFile or a path, to the PBXGroup or PBXVariantGroup with
+// the given key. Unlike group names, keys are unambiguous. A path that is not part of the
+// project yet gets a new file reference.
+func (p *PbxProject) AddFileToGroupKey(file interface{}, groupKey string) error {
+	isGroup := !p.getPBXGroupByKey(groupKey).IsEmpty()
+	if !isGroup && p.getPBXVariantGroupByKey(groupKey).IsEmpty() {
+		return fmt.Errorf("group %s not found", groupKey)
+	}
+
+	pbxfile, err := p.pbxFileFromParam(file)
+	if err != nil {
+		return err
+	}
+	if pbxfile == nil {
+		_, err = p.addFile(file.(string), groupKey, newPbxFileOptions())
+		return err
+	}
+
+	if isGroup {
+		p.addToPbxGroupByKey(pbxfile, groupKey)
+	} else {
+		p.addToPbxVariantGroup(pbxfile, groupKey)
+	}
+	return nil
+}
+
+// AddFileToGroupAtIndex adds a new file reference for filePath at position index of the children
+// of the group with the given key, e.g. 0 to put it first. An index out of range appends the file.
+func (p *PbxProject) AddFileToGroupAtIndex(filePath, groupKey string, index int, opts PbxFileOptions) error {
+	group := p.getPBXGroupByKey(groupKey)
+	if group.IsEmpty() {
+		group = p.getPBXVariantGroupByKey(groupKey)
+	}
+	if group.IsEmpty() {
+		return fmt.Errorf("group %s not found", groupKey)
+	}
+
+	pbxfile, err := p.addFile(filePath, "", opts)
+	if err != nil {
+		return err
+	}
+	insertToObjectList(group, "children", pbxGroupChild(pbxfile).ToObject(), index)
+	return nil
+}
+
+// RemoveFileFromGroupKey removes file, a *PbxFile or a path, from the children of the group
+// with the given key. The file reference itself is kept.
+func (p *PbxProject) RemoveFileFromGroupKey(file interface{}, groupKey string) error {
+	isGroup := !p.getPBXGroupByKey(groupKey).IsEmpty()
+	if !isGroup && p.getPBXVariantGroupByKey(groupKey).IsEmpty() {
+		return fmt.Errorf("group %s not found", groupKey)
+	}
+
+	pbxfile, err := p.pbxFileFromParam(file)
+	if err != nil {
+		return err
+	}
+	if pbxfile == nil {
+		return fmt.Errorf("file %s not found", file)
+	}
+
+	if isGroup {
+		p.removeFromPbxGroupByKey(pbxfile, groupKey)
+	} else {
+		p.removeFromPbxVariantGroup(pbxfile, groupKey)
+	}
+	return nil
+}
+
+// pbxFileFromParam resolves a *PbxFile or a path to a file of the project, nil when the
+// path is unknown.
+func (p *PbxProject) pbxFileFromParam(file interface{}) (*PbxFile, error) {
+	switch file := file.(type) {
+	case *PbxFile:
+		return file, nil
+	case string:
+		return p.getFile(file), nil
+	default:
+		return nil, fmt.Errorf("unsupported file type %T", file)
+	}
+}
+
 func (p *PbxProject) removeFile(path, group string, opt PbxFileOptions) *PbxFile {
 	pbxfile := newPbxFile(path, opt)
 
 	p.removeFromPbxFileReferenceSection(pbxfile) // PBXFileReference
 
 	if !p.getPBXGroupByKey(group).IsEmpty() {
-		p.removeFromPbxGroup(pbxfile, group) // PBXGroup
+		p.removeFromPbxGroupByKey(pbxfile, group) // PBXGroup
 	} else if !p.getPBXVariantGroupByKey(group).IsEmpty() {
 		p.removeFromPbxVariantGroup(pbxfile, group) // PBXVariantGroup
 	}
@@ -1921,6 +3677,155 @@ func (p *PbxProject) RemoveFile(filePath string, params ...interface{}) error {
 	return nil
 }
 
+// RemoveFileByUUID removes the file reference fileRef together with its build files,
+// the group children pointing at it and the build phase entries of those build files.
+func (p *PbxProject) RemoveFileByUUID(fileRef string) error {
+	fileReference := p.pbxFileReferenceSection.GetObject(fileRef)
+	if fileReference.IsEmpty() {
+		return fmt.Errorf("file reference %s not found", fileRef)
+	}
+
+	buildFileKeys := map[string]struct{}{}
+	p.pbxBuildFileSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		if value.(pegparser.Object).GetString("fileRef") == fileRef {
+			buildFileKeys[key] = struct{}{}
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+
+	// build phases list build files in "files", groups and variant groups list file references in "children"
+	p.pbxObjectSection.ForeachWithFilter(func(_ string, section interface{}) pegparser.IterateActionType {
+		sectionObj, ok := section.(pegparser.Object)
+		if !ok {
+			return pegparser.IterateActionContinue
+		}
+		sectionObj.ForeachWithFilter(func(_ string, value interface{}) pegparser.IterateActionType {
+			obj, ok := value.(pegparser.Object)
+			if !ok {
+				return pegparser.IterateActionContinue
+			}
+			removeListEntries(obj, "files", func(key string) bool {
+				_, found := buildFileKeys[key]
+				return found
+			})
+			removeListEntries(obj, "children", func(key string) bool {
+				return key == fileRef
+			})
+			return pegparser.IterateActionContinue
+		}, nonCommentsFilter)
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+
+	for key := range buildFileKeys {
+		p.pbxBuildFileSection.Delete(key)
+		p.pbxBuildFileSection.Delete(toCommentKey(key))
+	}
+	p.pbxFileReferenceSection.Delete(fileRef)
+	p.pbxFileReferenceSection.Delete(toCommentKey(fileRef))
+	delete(p.pbxFileReferences, unquoted(fileReference.GetString("path")))
+	return nil
+}
+
+// removeListEntries drops the entries of the commented list obj[key] whose value matches.
+func removeListEntries(obj pegparser.Object, key string, match func(string) bool) {
+	list, ok := obj.ForceGet(key).([]interface{})
+	if !ok {
+		return
+	}
+	kept := []interface{}{}
+	for _, entry := range list {
+		if entryObj, ok := entry.(pegparser.Object); ok && match(entryObj.GetString("value")) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	if len(kept) != len(list) {
+		obj.Set(key, kept)
+	}
+}
+
+// RemoveFileFromBuildPhase removes filePath from the single phase of target (uuid or name) named
+// phaseComment, e.g. "Resources", other phases keep the file.
+func (p *PbxProject) RemoveFileFromBuildPhase(filePath, phaseComment, target string) error {
+	if phaseComment == "" {
+		return fmt.Errorf("build phase missing")
+	}
+	return p.RemovePhaseFileByPath(filePath, target, phaseComment)
+}
+
+// RemovePhaseFileByPath removes filePath from the build phases of target (uuid or name) named
+// phaseComment, e.g. "Sources", or from all of its phases when phaseComment is empty. Entries are
+// matched through their build file's fileRef, whatever group the file was added with.
+func (p *PbxProject) RemovePhaseFileByPath(filePath, target, phaseComment string) error {
+	fileReference, ok := p.FileReferenceByPath(filePath)
+	if !ok {
+		return fmt.Errorf("file %s not found", filePath)
+	}
+	targetObj := p.pbxNativeTargetSection.GetObject(p.resolveTargetKey(target))
+	if targetObj.IsEmpty() {
+		return fmt.Errorf("target %s not found", target)
+	}
+
+	removed := false
+	buildPhases, _ := targetObj.ForceGet("buildPhases").([]interface{})
+	for _, buildPhase := range buildPhases {
+		buildPhaseObj := buildPhase.(pegparser.Object)
+		if phaseComment != "" && buildPhaseObj.GetString("comment") != phaseComment {
+			continue
+		}
+		removeListEntries(p.objectByKey(buildPhaseObj.GetString("value")), "files", func(key string) bool {
+			if p.pbxBuildFileSection.GetObject(key).GetString("fileRef") != fileReference.UUID {
+				return false
+			}
+			p.pbxBuildFileSection.Delete(key)
+			p.pbxBuildFileSection.Delete(toCommentKey(key))
+			removed = true
+			return true
+		})
+	}
+	if !removed {
+		return fmt.Errorf("file %s is not in a build phase of target %s", filePath, target)
+	}
+	return nil
+}
+
+// ObjectsByISA returns every object whose isa is isa. Objects are looked for in all sections,
+// not only the one named after isa.
+func (p *PbxProject) ObjectsByISA(isa string) []pegparser.ObjectWithUUID {
+	objects := []pegparser.ObjectWithUUID{}
+	p.pbxObjectSection.ForeachWithFilter(func(_ string, section interface{}) pegparser.IterateActionType {
+		sectionObj, ok := section.(pegparser.Object)
+		if !ok {
+			return pegparser.IterateActionContinue
+		}
+		sectionObj.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+			if obj, ok := value.(pegparser.Object); ok && unquoted(obj.GetString("isa")) == isa {
+				objects = append(objects, pegparser.ObjectWithUUID{
+					UUID:   key,
+					Object: obj,
+				})
+			}
+			return pegparser.IterateActionContinue
+		}, nonCommentsFilter)
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	return objects
+}
+
+// objectByKey looks up an object in whatever section of the objects it lives in.
+func (p *PbxProject) objectByKey(key string) (obj pegparser.Object) {
+	obj = pegparser.NewObject()
+	p.pbxObjectSection.ForeachWithFilter(func(_ string, section interface{}) pegparser.IterateActionType {
+		sectionObj, ok := section.(pegparser.Object)
+		if !ok || !sectionObj.Has(key) {
+			return pegparser.IterateActionContinue
+		}
+		obj = sectionObj.GetObject(key)
+		return pegparser.IterateActionBreak
+	}, nonCommentsFilter)
+	return
+}
+
 func (p *PbxProject) GetBuildProperty(prop, build, targetName string) (props []string) {
 	validConfigs := make(map[string]struct{})
 	if targetName != "" {
@@ -2056,38 +3961,113 @@ func (p *PbxProject) getBuildConfigByName(name string) map[string]pegparser.Obje
 //     return file;
 // }
 
+// projectAttributes returns the attributes of the root project, or the TargetAttributes entry
+// of the named target when targetName is not empty. Missing objects are created when create is set.
+func (p *PbxProject) projectAttributes(targetName string, create bool) pegparser.Object {
+	project := p.getFirstProject()
+	if project.UUID == "" {
+		return pegparser.NewObject()
+	}
+
+	attributes := project.Object.GetObject("attributes")
+	if !project.Has("attributes") {
+		if !create {
+			return attributes
+		}
+		project.Set("attributes", attributes)
+	}
+	if targetName == "" {
+		return attributes
+	}
+
+	targetKey := p.findTargetKey(targetName)
+	if targetKey == "" {
+		return pegparser.NewObject()
+	}
+	targetAttrs := attributes.GetObject("TargetAttributes")
+	if !attributes.Has("TargetAttributes") {
+		if !create {
+			return targetAttrs
+		}
+		attributes.Set("TargetAttributes", targetAttrs)
+	}
+	targetAttr := targetAttrs.GetObject(targetKey)
+	if !targetAttrs.Has(targetKey) && create {
+		targetAttrs.Set(targetKey, targetAttr)
+	}
+	return targetAttr
+}
+
+// LastSwiftUpdateCheck reads LastSwiftUpdateCheck of the target, or of the project when target is empty.
+func (p *PbxProject) LastSwiftUpdateCheck(target string) int {
+	return p.projectAttributes(target, false).GetInt("LastSwiftUpdateCheck")
+}
+
+func (p *PbxProject) SetLastSwiftUpdateCheck(target string, v int) {
+	p.projectAttributes(target, true).Set("LastSwiftUpdateCheck", v)
+}
+
+// LastSwiftMigrationOfTarget reads the LastSwiftMigration attribute Xcode records after a Swift migration.
+func (p *PbxProject) LastSwiftMigrationOfTarget(target string) int {
+	return p.projectAttributes(target, false).GetInt("LastSwiftMigration")
+}
+
+func (p *PbxProject) SetLastSwiftMigrationOfTarget(target string, v int) {
+	p.projectAttributes(target, true).Set("LastSwiftMigration", v)
+}
+
 func (p *PbxProject) AddTargetAttribute(prop, value string, target pegparser.ObjectWithUUID) error {
 	project := p.getFirstProject()
 	if project.UUID == "" {
 		return errors.New("No project found")
 	}
-	attributes := project.Object.GetObject("attributes")
-	if attributes.IsEmpty() {
+	// an empty attributes dictionary is still the project's attributes
+	if !project.Object.Has("attributes") {
 		return errors.New("No attributes found")
 	}
+	attributes := project.Object.GetObject("attributes")
 
 	targetAttrs := attributes.GetObject("TargetAttributes")
-	if targetAttrs.IsEmpty() {
-		targetAttrs = pegparser.NewObject()
+	if !attributes.Has("TargetAttributes") {
 		attributes.Set("TargetAttributes", targetAttrs)
 	}
 
 	if target.UUID == "" {
-		target = p.getFirstTarget()
-		if target.UUID == "" {
+		var ok bool
+		if target, ok = p.getFirstTarget(); !ok {
 			return errors.New("No target found")
 		}
 	}
 
 	targetAttr := targetAttrs.GetObject(target.UUID)
-	if !targetAttr.IsEmpty() {
-		targetAttr := pegparser.NewObject()
-		attributes.Set(target.UUID, targetAttr)
+	if !targetAttrs.Has(target.UUID) {
+		targetAttrs.Set(target.UUID, targetAttr)
 	}
 	targetAttr.Set(prop, value)
 	return nil
 }
 
+func (p *PbxProject) addTargetAttributeByName(prop, value, targetName string) error {
+	targetKey := p.findTargetKey(targetName)
+	if targetKey == "" {
+		return fmt.Errorf("target %s not found", targetName)
+	}
+	return p.AddTargetAttribute(prop, value, pegparser.ObjectWithUUID{UUID: targetKey})
+}
+
+// SetProvisioningStyle sets the signing style of the target, Automatic or Manual.
+func (p *PbxProject) SetProvisioningStyle(targetName, style string) error {
+	if style != "Automatic" && style != "Manual" {
+		return fmt.Errorf("invalid provisioning style %s", style)
+	}
+	return p.addTargetAttributeByName("ProvisioningStyle", style, targetName)
+}
+
+// SetDevelopmentTeam sets the team used to sign the target.
+func (p *PbxProject) SetDevelopmentTeam(targetName, teamID string) error {
+	return p.addTargetAttributeByName("DevelopmentTeam", quoteIfNeeded(teamID), targetName)
+}
+
 func (p *PbxProject) RemoveTargetAttribute(prop string, target pegparser.ObjectWithUUID) error {
 	project := p.getFirstProject()
 	if project.UUID == "" {
@@ -2098,8 +4078,8 @@ func (p *PbxProject) RemoveTargetAttribute(prop string, target pegparser.ObjectW
 		return errors.New("No attributes found")
 	}
 	if target.UUID == "" {
-		target = p.getFirstTarget()
-		if target.UUID == "" {
+		var ok bool
+		if target, ok = p.getFirstTarget(); !ok {
 			return errors.New("No target found")
 		}
 	}
@@ -2115,3 +4095,211 @@ func (p *PbxProject) RemoveTargetAttribute(prop string, target pegparser.ObjectW
 	}
 	return nil
 }
+
+type MergeOptions struct {
+	// GroupName collects the top level groups and files of the merged project in a new
+	// group of the main group, instead of adding them to the main group itself
+	GroupName string
+}
+
+// Merge adds the targets, groups, files and other objects of other to the project, other is
+// left untouched. Uuids already used here are replaced, file references to a path the project
+// already references are shared and the products join the project's products group. The root
+// object of other and its build configurations are not merged. A target named like one of the
+// project's targets makes Merge fail before anything changes.
+func (p *PbxProject) Merge(other *PbxProject, opts MergeOptions) error {
+	project := p.getFirstProject()
+	otherProject := other.getFirstProject()
+	if project.UUID == "" || otherProject.UUID == "" {
+		return errors.New("No project found")
+	}
+
+	otherTargets, _ := otherProject.ForceGet("targets").([]interface{})
+	for _, target := range otherTargets {
+		name := unquoted(other.objectByKey(target.(pegparser.Object).GetString("value")).GetString("name"))
+		if p.findTargetKey(name) != "" {
+			return fmt.Errorf("target %s already exists", name)
+		}
+	}
+
+	otherMainGroup := otherProject.GetString("mainGroup")
+	otherProductsGroup := otherProject.GetString("productRefGroup")
+	otherConfigurationList := otherProject.GetString("buildConfigurationList")
+	skipped := map[string]struct{}{
+		otherProject.UUID:      {},
+		otherMainGroup:         {},
+		otherProductsGroup:     {},
+		otherConfigurationList: {},
+	}
+	otherConfigurations, _ := other.pbxXCConfigurationListSection.GetObject(otherConfigurationList).ForceGet("buildConfigurations").([]interface{})
+	for _, configuration := range otherConfigurations {
+		skipped[configuration.(pegparser.Object).GetString("value")] = struct{}{}
+	}
+
+	// paths relative to their group can't be compared without resolving the groups
+	fileReferencePath := func(fileReference pegparser.Object) string {
+		sourceTree := unquoted(fileReference.GetString("sourceTree"))
+		if sourceTree == "<group>" {
+			return ""
+		}
+		return sourceTree + "/" + unquoted(fileReference.GetString("path"))
+	}
+	existingPaths := map[string]string{}
+	p.pbxFileReferenceSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		if path := fileReferencePath(value.(pegparser.Object)); path != "" {
+			existingPaths[path] = key
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+
+	// containerPortal of other's item proxies points at its root object, it becomes ours
+	rename := map[string]string{otherProject.UUID: project.UUID}
+	shared := map[string]struct{}{}
+	other.pbxObjectSection.ForeachWithFilter(func(_ string, section interface{}) pegparser.IterateActionType {
+		section.(pegparser.Object).ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+			if _, found := skipped[key]; found {
+				return pegparser.IterateActionContinue
+			}
+			obj, _ := value.(pegparser.Object)
+			if path := fileReferencePath(obj); path != "" && obj.GetString("isa") == "PBXFileReference" {
+				if existing, found := existingPaths[path]; found {
+					rename[key] = existing
+					shared[existing] = struct{}{}
+					return pegparser.IterateActionContinue
+				}
+			}
+			if _, used := p.uuids[key]; used {
+				rename[key] = p.generateUuid()
+			} else {
+				p.uuids[key] = struct{}{}
+			}
+			return pegparser.IterateActionContinue
+		}, nonCommentsFilter)
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+
+	renamed := func(key string) string {
+		if newKey, found := rename[key]; found {
+			return newKey
+		}
+		return key
+	}
+	// children of other's groups that are already in one of ours stay there only
+	isShared := func(key string) bool {
+		_, found := shared[key]
+		return found
+	}
+
+	other.pbxObjectSection.ForeachWithFilter(func(sectionName string, section interface{}) pegparser.IterateActionType {
+		sectionObj := section.(pegparser.Object)
+		sectionObj.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+			if _, found := skipped[key]; found {
+				return pegparser.IterateActionContinue
+			}
+			if _, found := rename[key]; found && isShared(rename[key]) {
+				return pegparser.IterateActionContinue
+			}
+			obj := remapUuids(value, rename)
+			if objObj, ok := obj.(pegparser.Object); ok {
+				removeListEntries(objObj, "children", isShared)
+			}
+
+			dest := p.pbxObjectSection.GetObject(sectionName)
+			if !p.pbxObjectSection.Has(sectionName) {
+				p.pbxObjectSection.Set(sectionName, dest)
+			}
+			dest.Set(renamed(key), obj)
+			if comment, found := sectionObj.Get(toCommentKey(key)); found {
+				dest.Set(toCommentKey(renamed(key)), comment)
+			}
+			return pegparser.IterateActionContinue
+		}, nonCommentsFilter)
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+
+	childrenOf := func(groupKey string) []interface{} {
+		children, _ := other.getPBXGroupByKey(groupKey).ForceGet("children").([]interface{})
+		kept := []interface{}{}
+		for _, child := range remapUuids(children, rename).([]interface{}) {
+			if childObj, ok := child.(pegparser.Object); ok && !isShared(childObj.GetString("value")) {
+				kept = append(kept, child)
+			}
+		}
+		return kept
+	}
+	mainGroup := p.getPBXGroupByKey(project.GetString("mainGroup"))
+	productsGroup := p.getPBXGroupByKey(project.GetString("productRefGroup"))
+	// other's products group is a child of its main group, ours holds the products now
+	mainGroupChildren := []interface{}{}
+	for _, child := range childrenOf(otherMainGroup) {
+		if child.(pegparser.Object).GetString("value") != otherProductsGroup {
+			mainGroupChildren = append(mainGroupChildren, child)
+		}
+	}
+	if opts.GroupName != "" {
+		groupKey := p.pbxCreateGroup(opts.GroupName, "")
+		p.getPBXGroupByKey(groupKey).Set("children", mainGroupChildren)
+		mainGroupChildren = []interface{}{CommentValue{Value: groupKey, Comment: opts.GroupName}.ToObject()}
+	}
+	for _, child := range mainGroupChildren {
+		addToObjectList(mainGroup, "children", child)
+	}
+	for _, child := range childrenOf(otherProductsGroup) {
+		addToObjectList(productsGroup, "children", child)
+	}
+
+	for _, target := range remapUuids(otherTargets, rename).([]interface{}) {
+		addToObjectList(project.Object, "targets", target)
+	}
+	otherTargetAttributes := remapUuids(other.projectAttributes("", false).GetObject("TargetAttributes"), rename).(pegparser.Object)
+	if !otherTargetAttributes.IsEmpty() {
+		attributes := p.projectAttributes("", true)
+		targetAttributes := attributes.GetObject("TargetAttributes")
+		if !attributes.Has("TargetAttributes") {
+			attributes.Set("TargetAttributes", targetAttributes)
+		}
+		otherTargetAttributes.Foreach(func(key string, value interface{}) pegparser.IterateActionType {
+			targetAttributes.Set(key, value)
+			return pegparser.IterateActionContinue
+		})
+	}
+
+	// sections other brought in for the first time
+	p.initSections()
+	p.initFileReference()
+	return nil
+}
+
+// remapUuids copies value replacing the uuids, as values, keys or in comment keys, found in rename.
+func remapUuids(value interface{}, rename map[string]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		if newKey, found := rename[v]; found {
+			return newKey
+		}
+		return v
+	case pegparser.Object:
+		obj := pegparser.NewObject()
+		v.Foreach(func(key string, val interface{}) pegparser.IterateActionType {
+			newKey := key
+			if isCommentKey(key) {
+				if renamed, found := rename[fromCommentKey(key)]; found {
+					newKey = toCommentKey(renamed)
+				}
+			} else if renamed, found := rename[key]; found {
+				newKey = renamed
+			}
+			obj.Set(newKey, remapUuids(val, rename))
+			return pegparser.IterateActionContinue
+		})
+		return obj
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = remapUuids(item, rename)
+		}
+		return arr
+	default:
+		return v
+	}
+}
@@ -0,0 +1,3708 @@
+package pbxproj
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/soapywu/pbxproj/pegparser"
+)
+
+func TestRemoveSourceFileWithSameBasename(t *testing.T) {
+	p := loadExampleProject(t)
+	group := exampleMainGroupKey
+	for _, path := range []string{"A/Util.m", "B/Util.m"} {
+		if err := p.AddSourceFile(path, group, PbxFileOptions{}); err != nil {
+			t.Fatalf("AddSourceFile(%s): %v", path, err)
+		}
+	}
+	kept := p.getFile("B/Util.m")
+	if kept == nil {
+		t.Fatal("B/Util.m not added")
+	}
+	if err := p.RemoveSourceFile("A/Util.m", group, PbxFileOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	p = reparse(t, p)
+	buildFiles := []string{}
+	p.pbxBuildFileSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+		if value.(pegparser.Object).GetString("fileRef") == kept.FileRef {
+			buildFiles = append(buildFiles, key)
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+	if len(buildFiles) != 1 {
+		t.Fatalf("build files of B/Util.m = %v, want one", buildFiles)
+	}
+
+	sources := listValues(p.pbxSourcesBuildPhaseObj(""), "files")
+	for _, key := range sources {
+		if !p.pbxBuildFileSection.Has(key) {
+			t.Errorf("Sources lists removed build file %s", key)
+		}
+	}
+	if !containsString(sources, buildFiles[0]) {
+		t.Errorf("Sources %v does not list B/Util.m's build file %s", sources, buildFiles[0])
+	}
+	if p.getFile("A/Util.m") != nil {
+		t.Error("A/Util.m still referenced")
+	}
+}
+
+func TestAddKnownAssetTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(p *PbxProject)
+	}{
+		{"existing attributes", func(p *PbxProject) {}},
+		{"empty attributes", func(p *PbxProject) {
+			p.getFirstProject().Object.Set("attributes", pegparser.NewObject())
+		}},
+		{"no attributes", func(p *PbxProject) {
+			p.getFirstProject().Object.Delete("attributes")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			tt.prepare(p)
+			p.AddKnownAssetTag("level 1")
+			p.AddKnownAssetTag("level2")
+			p.AddKnownAssetTag(`"level 1"`)
+
+			p = reparse(t, p)
+			got := listValues(p.ProjectAttributes(), "KnownAssetTags")
+			want := []string{`"level 1"`, "level2"}
+			if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+				t.Errorf("KnownAssetTags = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSetFileAssetTags(t *testing.T) {
+	p := loadExampleProject(t)
+	p.getFirstProject().Object.Set("attributes", pegparser.NewObject())
+	if err := p.SetFileAssetTags("Assets.xcassets", []string{"intro"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetFileAssetTags("Missing.png", []string{"intro"}); err == nil {
+		t.Error("SetFileAssetTags on a missing file succeeded")
+	}
+
+	p = reparse(t, p)
+	if got := listValues(p.ProjectAttributes(), "KnownAssetTags"); len(got) != 1 || got[0] != "intro" {
+		t.Errorf("KnownAssetTags = %v, want [intro]", got)
+	}
+	fileReference, _ := p.FileReferenceByPath("Assets.xcassets")
+	p.pbxBuildFileSection.ForeachWithFilter(func(_ string, value interface{}) pegparser.IterateActionType {
+		buildFile := value.(pegparser.Object)
+		if buildFile.GetString("fileRef") == fileReference.UUID {
+			if got := listValues(buildFile.GetObject("settings"), "ASSET_TAGS"); len(got) != 1 || got[0] != "intro" {
+				t.Errorf("ASSET_TAGS = %v, want [intro]", got)
+			}
+		}
+		return pegparser.IterateActionContinue
+	}, nonCommentsFilter)
+}
+
+func TestSetLastUpgradeCheck(t *testing.T) {
+	tests := []struct {
+		version string
+		want    int
+		xcode   string
+		wantErr bool
+	}{
+		{"1320", 1320, "Xcode 13.2+", false},
+		{"1500", 1500, "Xcode 15+", false},
+		{"", 0, "", true},
+		{"15.0", 0, "", true},
+		{"1500a", 0, "", true},
+		{"-1500", 0, "", true},
+	}
+	for _, tt := range tests {
+		p := loadExampleProject(t)
+		p.topProjectSection.Delete("objectVersion")
+		err := p.SetLastUpgradeCheck(tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SetLastUpgradeCheck(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			if got := p.ProjectAttributes().GetInt("LastUpgradeCheck"); got != 1320 {
+				t.Errorf("SetLastUpgradeCheck(%q) changed LastUpgradeCheck to %d", tt.version, got)
+			}
+			continue
+		}
+		if data := string(NewPbxWriter(p).Bytes()); !strings.Contains(data, "LastUpgradeCheck = "+tt.version+";") {
+			t.Errorf("output lacks the unquoted LastUpgradeCheck %s", tt.version)
+		}
+		p = reparse(t, p)
+		if got := p.ProjectAttributes().GetInt("LastUpgradeCheck"); got != tt.want {
+			t.Errorf("LastUpgradeCheck = %d, want %d", got, tt.want)
+		}
+		if got := p.LikelyXcodeVersion(); got != tt.xcode {
+			t.Errorf("LikelyXcodeVersion() = %q, want %q", got, tt.xcode)
+		}
+	}
+}
+
+func TestSetLastSwiftMigration(t *testing.T) {
+	p := loadExampleProject(t)
+	if err := p.SetLastSwiftMigration("1500"); err != nil {
+		t.Fatal(err)
+	}
+	p = reparse(t, p)
+	if got := p.ProjectAttributes().GetInt("LastSwiftMigration"); got != 1500 {
+		t.Errorf("LastSwiftMigration = %d, want 1500", got)
+	}
+	if got := p.LastSwiftUpdateCheck(""); got != 1320 {
+		t.Errorf("LastSwiftUpdateCheck = %d, want the untouched 1320", got)
+	}
+	if got := p.LastSwiftMigrationOfTarget("DWebBrowser"); got != 0 {
+		t.Errorf("LastSwiftMigration of DWebBrowser = %d, want 0", got)
+	}
+	if err := p.SetLastSwiftMigration("15 00"); err == nil {
+		t.Error("SetLastSwiftMigration accepted a version with a space")
+	}
+}
+
+func TestViewUpdateZeroValue(t *testing.T) {
+	var p PbxProject
+	p.View(func(p *PbxProject) {})
+	p.Update(func(p *PbxProject) {
+		p.Reset()
+	})
+}
+
+// TestConcurrentWriterAndReaders is meant for go test -race: a writer keeps adding files and
+// targets through Update while readers list them through View.
+func TestConcurrentWriterAndReaders(t *testing.T) {
+	const writes = 20
+	readers := []struct {
+		name string
+		read func(p *PbxProject) int
+	}{
+		{"file references", func(p *PbxProject) int { return len(p.ObjectsByISA("PBXFileReference")) }},
+		{"targets", func(p *PbxProject) int { return len(p.ObjectsByISA("PBXNativeTarget")) }},
+		{"groups", func(p *PbxProject) int { return len(p.Groups()) }},
+		{"files by basename", func(p *PbxProject) int { return len(p.FindFileReferencesByBasename("Generated.swift")) }},
+		{"output", func(p *PbxProject) int {
+			return strings.Count(string(NewPbxWriter(p).Bytes()), "Generated.swift */ = {")
+		}},
+	}
+
+	p := loadExampleProject(t)
+	var wg sync.WaitGroup
+	wg.Add(1 + len(readers))
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			p.Update(func(p *PbxProject) {
+				if err := p.AddSourceFile(fmt.Sprintf("Gen%d/Generated.swift", i), PbxFileOptions{}, exampleMainGroupKey); err != nil {
+					t.Error(err)
+				}
+				if i%5 == 0 {
+					if err := p.AddTarget(fmt.Sprintf("Target%d", i), "framework", fmt.Sprintf("Target%d", i), ""); err != nil {
+						t.Error(err)
+					}
+				}
+			})
+		}
+	}()
+	for _, reader := range readers {
+		go func(name string, read func(p *PbxProject) int) {
+			defer wg.Done()
+			last := 0
+			for i := 0; i < writes; i++ {
+				var got int
+				p.View(func(p *PbxProject) {
+					got = read(p)
+				})
+				// the project only grows
+				if got < last {
+					t.Errorf("%s went from %d to %d", name, last, got)
+				}
+				last = got
+			}
+		}(reader.name, reader.read)
+	}
+	wg.Wait()
+
+	if got := len(p.FindFileReferencesByBasename("Generated.swift")); got != writes {
+		t.Errorf("%d Generated.swift references, want %d", got, writes)
+	}
+}
+
+// TestViewUpdateConcurrent is meant for go test -race: View readers run next to Update writers.
+func TestViewUpdateConcurrent(t *testing.T) {
+	p := loadExampleProject(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			p.Update(func(p *PbxProject) {
+				if err := p.AddFile(fmt.Sprintf("File%d.swift", i), exampleMainGroupKey); err != nil {
+					t.Error(err)
+				}
+				if err := p.SetLastUpgradeCheck(strconv.Itoa(1400 + i)); err != nil {
+					t.Error(err)
+				}
+			})
+		}(i)
+		go func() {
+			defer wg.Done()
+			p.View(func(p *PbxProject) {
+				_ = NewPbxWriter(p).Bytes()
+				_ = p.Frameworks()
+				_ = p.BuildConfigurations("DWebBrowser")
+				_ = p.ProjectAttributes().GetInt("LastUpgradeCheck")
+				_, _ = p.FileReferenceByPath("File0.swift")
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		if _, ok := p.FileReferenceByPath(fmt.Sprintf("File%d.swift", i)); !ok {
+			t.Errorf("File%d.swift missing", i)
+		}
+	}
+}
+
+func TestAddProjectReference(t *testing.T) {
+	dir := t.TempDir()
+	example := readExampleProject(t)
+	mainPath := writeFixture(t, dir, "Main.xcodeproj/project.pbxproj", example)
+	writeFixture(t, dir, "Sub.xcodeproj/project.pbxproj", example)
+	writeFixture(t, dir, "Broken.xcodeproj/project.pbxproj", []byte("// !$*UTF8*$!\n{ broken"))
+
+	tests := []struct {
+		name      string
+		path      string
+		wantErr   bool
+		wantProxy int
+	}{
+		{"sub-project", "Sub.xcodeproj", false, 3},
+		{"missing", "Missing.xcodeproj", true, 0},
+		{"malformed", "Broken.xcodeproj", true, 0},
+		{"not a project", "Sub.txt", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadProject(t, mainPath)
+			before := string(NewPbxWriter(p).Bytes())
+			err := p.AddProjectReference(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddProjectReference(%s) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if after := string(NewPbxWriter(p).Bytes()); after != before {
+					t.Error("failed AddProjectReference changed the project")
+				}
+				return
+			}
+
+			p = reparse(t, p)
+			references, _ := p.getFirstProject().Object.ForceGet("projectReferences").([]interface{})
+			if len(references) != 1 {
+				t.Fatalf("projectReferences = %v, want one entry", references)
+			}
+			productGroupKey := references[0].(pegparser.Object).GetString("ProductGroup")
+			productGroup := p.getPBXGroupByKey(productGroupKey)
+			if got := productGroup.GetString("name"); got != `"Sub Products"` {
+				t.Errorf("product group name = %s, want \"Sub Products\"", got)
+			}
+			if got := len(listValues(productGroup, "children")); got != tt.wantProxy {
+				t.Errorf("product group has %d children, want %d", got, tt.wantProxy)
+			}
+			projectRef := references[0].(pegparser.Object).GetString("ProjectRef")
+			if got := unquoted(p.pbxFileReferenceSection.GetObject(projectRef).GetString("path")); got != tt.path {
+				t.Errorf("ProjectRef path = %q, want %q", got, tt.path)
+			}
+			for _, proxyKey := range listValues(productGroup, "children") {
+				proxy := p.getPBXObject("PBXReferenceProxy").GetObject(proxyKey)
+				if proxy.IsEmpty() {
+					t.Errorf("product group child %s is not a PBXReferenceProxy", proxyKey)
+					continue
+				}
+				itemProxy := p.getPBXObject("PBXContainerItemProxy").GetObject(proxy.GetString("remoteRef"))
+				if got := itemProxy.GetInt("proxyType"); got != 2 {
+					t.Errorf("%s proxyType = %d, want 2", proxyKey, got)
+				}
+				if got := itemProxy.GetString("containerPortal"); got != projectRef {
+					t.Errorf("%s containerPortal = %s, want %s", proxyKey, got, projectRef)
+				}
+			}
+			if p.pbxGroupByName("Products").SliceMap != p.getPBXGroupByKey(exampleProductsGroupKey).SliceMap {
+				t.Error(`pbxGroupByName("Products") is not the project's own Products group`)
+			}
+		})
+	}
+}
+
+func TestAddHeaderToBuildPhase(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		visibility string
+		wantTarget string
+		wantAttrs  []string
+		wantErr    bool
+	}{
+		{"target name", "DWebBrowser", "public", exampleAppTargetKey, []string{"Public"}, false},
+		{"target uuid", exampleTestsTargetKey, "private", exampleTestsTargetKey, []string{"Private"}, false},
+		{"first target", "", "project", exampleAppTargetKey, nil, false},
+		{"unknown target", "Nope", "public", "", nil, true},
+		{"unknown visibility", "DWebBrowser", "secret", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			err := p.AddHeaderToBuildPhase("Bridge.h", tt.target, tt.visibility)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddHeaderToBuildPhase error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			p = reparse(t, p)
+			files := listValues(p.buildPhaseObject("PBXHeadersBuildPhase", "Headers", tt.wantTarget), "files")
+			if len(files) != 1 {
+				t.Fatalf("Headers phase files = %v, want one", files)
+			}
+			settings := p.pbxBuildFileSection.GetObject(files[0]).GetObject("settings")
+			if got := listValues(settings, "ATTRIBUTES"); len(got) != len(tt.wantAttrs) || (len(got) > 0 && got[0] != tt.wantAttrs[0]) {
+				t.Errorf("ATTRIBUTES = %v, want %v", got, tt.wantAttrs)
+			}
+		})
+	}
+}
+
+func TestAddCopyfileDestination(t *testing.T) {
+	p := loadExampleProject(t)
+	copies := []struct {
+		path        string
+		destination string
+	}{
+		{"Helper.xpc", "xpc_services"},
+		{"tool", "absolute_path"},
+		{"Other.xpc", "xpc_services"},
+		{"Kit.framework", "frameworks"},
+		{"Support.txt", "shared_support"},
+	}
+	for _, c := range copies {
+		if err := p.AddCopyfile(c.path, PbxFileOptions{Destination: c.destination, Target: exampleAppTargetKey}); err != nil {
+			t.Fatalf("AddCopyfile(%s): %v", c.path, err)
+		}
+	}
+	if err := p.AddCopyfile("x", PbxFileOptions{Destination: "nowhere"}); err == nil {
+		t.Error("AddCopyfile to an unknown destination succeeded")
+	}
+
+	p = reparse(t, p)
+	tests := []struct {
+		phase   string
+		spec    int
+		dstPath string
+		files   []string
+	}{
+		{"Copy Files (xpc_services)", 0, `"$(CONTENTS_FOLDER_PATH)/XPCServices"`, []string{"Helper.xpc", "Other.xpc"}},
+		{"Copy Files (absolute_path)", 0, `""`, []string{"tool"}},
+		{"Copy Files (frameworks)", 10, `""`, []string{"Kit.framework"}},
+		{"Copy Files (shared_support)", 12, `""`, []string{"Support.txt"}},
+	}
+	for _, tt := range tests {
+		phase := p.buildPhaseObject("PBXCopyFilesBuildPhase", tt.phase, exampleAppTargetKey)
+		if phase.IsEmpty() {
+			t.Errorf("phase %s missing", tt.phase)
+			continue
+		}
+		if got := phase.GetString("dstPath"); got != tt.dstPath {
+			t.Errorf("%s dstPath = %s, want %s", tt.phase, got, tt.dstPath)
+		}
+		if got := phase.GetInt("dstSubfolderSpec"); got != tt.spec {
+			t.Errorf("%s dstSubfolderSpec = %d, want %d", tt.phase, got, tt.spec)
+		}
+		entries, _ := phase.ForceGet("files").([]interface{})
+		if len(entries) != len(tt.files) {
+			t.Fatalf("%s files = %v, want %v", tt.phase, entries, tt.files)
+		}
+		for i, entry := range entries {
+			want := tt.files[i] + " in " + tt.phase
+			if got := entry.(pegparser.Object).GetString("comment"); got != want {
+				t.Errorf("%s entry comment = %q, want %q", tt.phase, got, want)
+			}
+			key := entry.(pegparser.Object).GetString("value")
+			if got := p.pbxBuildFileSection.GetString(toCommentKey(key)); got != want {
+				t.Errorf("build file comment = %q, want %q", got, want)
+			}
+		}
+	}
+}
+
+func TestAddBuildPhaseWithoutTargets(t *testing.T) {
+	p := loadExampleProject(t)
+	p.getFirstProject().Object.Set("targets", []interface{}{})
+	before := string(NewPbxWriter(p).Bytes())
+	if err := p.AddBuildPhase([]string{}, "PBXSourcesBuildPhase", "Sources", "", nil, ""); err == nil {
+		t.Error("AddBuildPhase without targets succeeded")
+	}
+	if after := string(NewPbxWriter(p).Bytes()); after != before {
+		t.Error("failed AddBuildPhase changed the project")
+	}
+	if err := p.AddBuildPhase([]string{}, "PBXCopyFilesBuildPhase", "Copy Files", exampleAppTargetKey, 1, ""); err == nil {
+		t.Error("AddBuildPhase with a non string folder type succeeded")
+	}
+}
+
+func TestAddUnitTestTargetHostPlatform(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(p *PbxProject)
+		want    string
+	}{
+		{"ios host", func(p *PbxProject) {}, `"$(BUILT_PRODUCTS_DIR)/DWebBrowser.app/DWebBrowser"`},
+		{"ios host in a multiplatform project", func(p *PbxProject) {
+			for _, configuration := range p.projectBuildConfigurations() {
+				configuration.GetObject("buildSettings").Set("MACOSX_DEPLOYMENT_TARGET", "12.0")
+			}
+		}, `"$(BUILT_PRODUCTS_DIR)/DWebBrowser.app/DWebBrowser"`},
+		{"macos host", func(p *PbxProject) {
+			for _, configuration := range p.buildConfigurations("", "DWebBrowser") {
+				configuration.GetObject("buildSettings").Set("SDKROOT", "macosx")
+			}
+		}, `"$(BUILT_PRODUCTS_DIR)/DWebBrowser.app/Contents/MacOS/DWebBrowser"`},
+		{"macos project", func(p *PbxProject) {
+			for _, configuration := range p.projectBuildConfigurations() {
+				configuration.GetObject("buildSettings").Set("SDKROOT", "macosx")
+			}
+		}, `"$(BUILT_PRODUCTS_DIR)/DWebBrowser.app/Contents/MacOS/DWebBrowser"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			tt.prepare(p)
+			if err := p.AddUnitTestTarget("HostTests", "DWebBrowser", "", ""); err != nil {
+				t.Fatal(err)
+			}
+			configs := p.BuildConfigurations("HostTests")
+			if len(configs) == 0 {
+				t.Fatal("HostTests has no build configurations")
+			}
+			for _, config := range configs {
+				if got := config.BuildSettings.GetString("TEST_HOST"); got != tt.want {
+					t.Errorf("%s TEST_HOST = %s, want %s", config.Name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddTargetDependencyRemoteInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		targetName string
+		want       string
+	}{
+		{"plain name", "DWebBrowser", "DWebBrowser"},
+		{"name with spaces", `"My Browser"`, `"My Browser"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			p.pbxNativeTargetSection.GetObject(exampleAppTargetKey).Set("name", tt.targetName)
+			p.pbxNativeTargetSection.Set(toCommentKey(exampleAppTargetKey), unquoted(tt.targetName))
+			p.AddTargetDependency(exampleTestsTargetKey, []string{exampleAppTargetKey})
+
+			p = reparse(t, p)
+			dependencies := listValues(p.pbxNativeTargetSection.GetObject(exampleTestsTargetKey), "dependencies")
+			last := p.pbxTargetDependencySection.GetObject(dependencies[len(dependencies)-1])
+			itemProxy := p.pbxContainerItemProxySection.GetObject(last.GetString("targetProxy"))
+			if got := itemProxy.GetString("remoteInfo"); got != tt.want {
+				t.Errorf("remoteInfo = %s, want %s", got, tt.want)
+			}
+			if got := itemProxy.GetString("remoteGlobalIDString"); got != exampleAppTargetKey {
+				t.Errorf("remoteGlobalIDString = %s, want %s", got, exampleAppTargetKey)
+			}
+			fields := []struct {
+				key  string
+				want string
+			}{
+				{"proxyType", "1"},
+				{"containerPortal", exampleProjectKey},
+				{"containerPortal_comment", "Project object"},
+				{"target", exampleAppTargetKey},
+				{"target_comment", unquoted(tt.targetName)},
+				{"targetProxy_comment", "PBXContainerItemProxy"},
+			}
+			for _, field := range fields {
+				obj := itemProxy
+				if strings.HasPrefix(field.key, "target") {
+					obj = last
+				}
+				if got := fmt.Sprint(obj.ForceGet(field.key)); got != field.want {
+					t.Errorf("%s = %s, want %s", field.key, got, field.want)
+				}
+			}
+		})
+	}
+}
+
+// bareFrameworksPhase lists a build file of the app's Frameworks phase as a bare uuid, without comment.
+var bareFrameworksPhase = []string{
+	"046BD63927EC51880044E784 /* Frameworks */ = {\n\t\t\tisa = PBXFrameworksBuildPhase;\n\t\t\tbuildActionMask = 2147483647;\n\t\t\tfiles = (\n",
+	"046BD63927EC51880044E784 /* Frameworks */ = {\n\t\t\tisa = PBXFrameworksBuildPhase;\n\t\t\tbuildActionMask = 2147483647;\n\t\t\tfiles = (\n\t\t\t\t046BD64027EC51880044E784,\n",
+}
+
+func TestFrameworks(t *testing.T) {
+	p := loadExampleProjectWith(t, bareFrameworksPhase...)
+	if err := p.AddBuildPhase([]string{}, "PBXCopyFilesBuildPhase", "Embed Frameworks", exampleAppTargetKey, "frameworks", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddFramework("libz.tbd", PbxFileOptions{Link: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddFramework("Custom.framework", PbxFileOptions{Link: true, CustomFramework: true, Embed: true, Weak: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]FrameworkInfo{}
+	// the bare entry is skipped
+	for _, framework := range reparse(t, p).Frameworks() {
+		got[framework.Name] = framework
+	}
+	tests := []struct {
+		name     string
+		linked   bool
+		embedded bool
+		weak     bool
+	}{
+		{"libz.tbd", true, false, false},
+		{"Custom.framework", true, true, true},
+	}
+	for _, tt := range tests {
+		framework, ok := got[tt.name]
+		if !ok {
+			t.Errorf("%s not listed in %v", tt.name, got)
+			continue
+		}
+		if framework.Linked != tt.linked || framework.Embedded != tt.embedded || framework.Weak != tt.weak {
+			t.Errorf("%s = %+v, want linked %v embedded %v weak %v", tt.name, framework, tt.linked, tt.embedded, tt.weak)
+		}
+	}
+}
+
+// packageProducts links the Swift package products Alamofire and Kingfisher to the app, the
+// app's Frameworks phase also lists a bare uuid and the dependencies a bare product key.
+var packageProducts = []string{
+	"/* End PBXBuildFile section */",
+	"\t\tAA0000000000000000000001 /* Alamofire in Frameworks */ = {isa = PBXBuildFile; productRef = AA0000000000000000000011 /* Alamofire */; };\n" +
+		"\t\tAA0000000000000000000002 /* Kingfisher in Frameworks */ = {isa = PBXBuildFile; productRef = AA0000000000000000000012 /* Kingfisher */; };\n" +
+		"/* End PBXBuildFile section */",
+	"046BD63927EC51880044E784 /* Frameworks */ = {\n\t\t\tisa = PBXFrameworksBuildPhase;\n\t\t\tbuildActionMask = 2147483647;\n\t\t\tfiles = (\n",
+	"046BD63927EC51880044E784 /* Frameworks */ = {\n\t\t\tisa = PBXFrameworksBuildPhase;\n\t\t\tbuildActionMask = 2147483647;\n\t\t\tfiles = (\n" +
+		"\t\t\t\tAA0000000000000000000003,\n" +
+		"\t\t\t\tAA0000000000000000000001 /* Alamofire in Frameworks */,\n" +
+		"\t\t\t\tAA0000000000000000000002 /* Kingfisher in Frameworks */,\n",
+	"\t\t\tname = DWebBrowser;\n",
+	"\t\t\tname = DWebBrowser;\n\t\t\tpackageProductDependencies = (\n" +
+		"\t\t\t\tAA0000000000000000000013,\n" +
+		"\t\t\t\tAA0000000000000000000011 /* Alamofire */,\n" +
+		"\t\t\t\tAA0000000000000000000012 /* Kingfisher */,\n\t\t\t);\n",
+	"/* End XCConfigurationList section */",
+	"/* End XCConfigurationList section */\n\n/* Begin XCSwiftPackageProductDependency section */\n" +
+		"\t\tAA0000000000000000000011 /* Alamofire */ = {\n\t\t\tisa = XCSwiftPackageProductDependency;\n\t\t\tproductName = Alamofire;\n\t\t};\n" +
+		"\t\tAA0000000000000000000012 /* Kingfisher */ = {\n\t\t\tisa = XCSwiftPackageProductDependency;\n\t\t\tproductName = Kingfisher;\n\t\t};\n" +
+		"/* End XCSwiftPackageProductDependency section */",
+}
+
+func TestRemovePackageProductFromTarget(t *testing.T) {
+	p := loadExampleProjectWith(t, packageProducts...)
+	if err := p.RemovePackageProductFromTarget("Alamofire", "DWebBrowser"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemovePackageProductFromTarget("Alamofire", "DWebBrowser"); err == nil {
+		t.Error("removing Alamofire twice succeeded")
+	}
+	p = reparse(t, p)
+
+	target := p.pbxNativeTargetSection.GetObject(exampleAppTargetKey)
+	if got := listValues(target, "packageProductDependencies"); containsString(got, "AA0000000000000000000011") {
+		t.Errorf("packageProductDependencies = %v, still lists Alamofire", got)
+	}
+	dependencies, _ := target.ForceGet("packageProductDependencies").([]interface{})
+	if len(dependencies) != 2 {
+		t.Errorf("packageProductDependencies = %v, want the bare key and Kingfisher", dependencies)
+	}
+	files, _ := p.pbxFrameworksBuildPhaseObj(exampleAppTargetKey).ForceGet("files").([]interface{})
+	if len(files) != 2 {
+		t.Errorf("Frameworks files = %v, want the bare uuid and Kingfisher", files)
+	}
+	tests := []struct {
+		section string
+		key     string
+		want    bool
+	}{
+		{"PBXBuildFile", "AA0000000000000000000001", false},
+		{"PBXBuildFile", "AA0000000000000000000002", true},
+		{"XCSwiftPackageProductDependency", "AA0000000000000000000011", false},
+		{"XCSwiftPackageProductDependency", "AA0000000000000000000012", true},
+	}
+	for _, tt := range tests {
+		if got := p.getPBXObject(tt.section).Has(tt.key); got != tt.want {
+			t.Errorf("%s has %s = %v, want %v", tt.section, tt.key, got, tt.want)
+		}
+	}
+}
+
+// sharedPackageProduct links Alamofire to DWebBrowserTests as well, through its own product
+// dependency on the XCRemoteSwiftPackageReference both dependencies point at.
+var sharedPackageProduct = []string{
+	"/* End PBXBuildFile section */",
+	"\t\tAA0000000000000000000004 /* Alamofire in Frameworks */ = {isa = PBXBuildFile; productRef = AA0000000000000000000014 /* Alamofire */; };\n" +
+		"/* End PBXBuildFile section */",
+	"046BD64F27EC518A0044E784 /* Frameworks */ = {\n\t\t\tisa = PBXFrameworksBuildPhase;\n\t\t\tbuildActionMask = 2147483647;\n\t\t\tfiles = (\n",
+	"046BD64F27EC518A0044E784 /* Frameworks */ = {\n\t\t\tisa = PBXFrameworksBuildPhase;\n\t\t\tbuildActionMask = 2147483647;\n\t\t\tfiles = (\n" +
+		"\t\t\t\tAA0000000000000000000004 /* Alamofire in Frameworks */,\n",
+	"\t\t\tname = DWebBrowserTests;\n",
+	"\t\t\tname = DWebBrowserTests;\n\t\t\tpackageProductDependencies = (\n" +
+		"\t\t\t\tAA0000000000000000000014 /* Alamofire */,\n\t\t\t);\n",
+	"/* End XCSwiftPackageProductDependency section */",
+	"\t\tAA0000000000000000000014 /* Alamofire */ = {\n\t\t\tisa = XCSwiftPackageProductDependency;\n" +
+		"\t\t\tpackage = AA0000000000000000000021 /* XCRemoteSwiftPackageReference \"Alamofire\" */;\n\t\t\tproductName = Alamofire;\n\t\t};\n" +
+		"/* End XCSwiftPackageProductDependency section */\n\n/* Begin XCRemoteSwiftPackageReference section */\n" +
+		"\t\tAA0000000000000000000021 /* XCRemoteSwiftPackageReference \"Alamofire\" */ = {\n\t\t\tisa = XCRemoteSwiftPackageReference;\n" +
+		"\t\t\trepositoryURL = \"https://github.com/Alamofire/Alamofire.git\";\n\t\t};\n" +
+		"/* End XCRemoteSwiftPackageReference section */",
+}
+
+func TestRemovePackageProductFromOneOfTwoTargets(t *testing.T) {
+	tests := []struct {
+		target    string
+		other     string
+		removed   [2]string
+		remaining [2]string
+	}{
+		{"DWebBrowser", "DWebBrowserTests",
+			[2]string{"AA0000000000000000000001", "AA0000000000000000000011"},
+			[2]string{"AA0000000000000000000004", "AA0000000000000000000014"}},
+		{"DWebBrowserTests", "DWebBrowser",
+			[2]string{"AA0000000000000000000004", "AA0000000000000000000014"},
+			[2]string{"AA0000000000000000000001", "AA0000000000000000000011"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			p := loadExampleProjectWith(t, append(append([]string{}, packageProducts...), sharedPackageProduct...)...)
+			if err := p.RemovePackageProductFromTarget("Alamofire", tt.target); err != nil {
+				t.Fatal(err)
+			}
+			p = reparse(t, p)
+
+			for _, keys := range []struct {
+				keys [2]string
+				want bool
+			}{{tt.removed, false}, {tt.remaining, true}} {
+				if got := p.pbxBuildFileSection.Has(keys.keys[0]); got != keys.want {
+					t.Errorf("PBXBuildFile has %s = %v, want %v", keys.keys[0], got, keys.want)
+				}
+				if got := p.getPBXObject("XCSwiftPackageProductDependency").Has(keys.keys[1]); got != keys.want {
+					t.Errorf("XCSwiftPackageProductDependency has %s = %v, want %v", keys.keys[1], got, keys.want)
+				}
+			}
+			other := p.pbxNativeTargetSection.GetObject(p.findTargetKey(tt.other))
+			if got := listValues(other, "packageProductDependencies"); !containsString(got, tt.remaining[1]) {
+				t.Errorf("%s packageProductDependencies = %v, want %s kept", tt.other, got, tt.remaining[1])
+			}
+			if !p.getPBXObject("XCRemoteSwiftPackageReference").Has("AA0000000000000000000021") {
+				t.Error("the XCRemoteSwiftPackageReference was removed")
+			}
+		})
+	}
+}
+
+func TestRemoveEmbeddedExtension(t *testing.T) {
+	p := loadExampleProject(t)
+	if err := p.AddTarget("Share", "app_extension", "Share", ""); err != nil {
+		t.Fatal(err)
+	}
+	embedPhase := p.buildPhaseObject("PBXCopyFilesBuildPhase", "Copy Files", exampleAppTargetKey)
+	files, _ := embedPhase.ForceGet("files").([]interface{})
+	embedPhase.Set("files", append([]interface{}{"AA0000000000000000000001"}, files...))
+	p = reparse(t, p)
+
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"Share", false},
+		{"Share.appex", true},
+		{"Missing", true},
+	}
+	for _, tt := range tests {
+		if err := p.RemoveEmbeddedExtension(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("RemoveEmbeddedExtension(%q) error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+	embedPhase = reparse(t, p).buildPhaseObject("PBXCopyFilesBuildPhase", "Copy Files", exampleAppTargetKey)
+	if got := embedPhase.ForceGet("files"); !reflect.DeepEqual(got, []interface{}{"AA0000000000000000000001"}) {
+		t.Errorf("Copy Files files = %v, want only the bare uuid", got)
+	}
+}
+
+// bareResourcesPhase lists the app's Resources phase as a bare uuid, without comment.
+var bareResourcesPhase = []string{
+	"\t\t\t\t046BD63A27EC51880044E784 /* Resources */,\n\t\t\t);\n\t\t\tbuildRules = (\n\t\t\t);\n\t\t\tdependencies = (\n\t\t\t);\n\t\t\tname = DWebBrowser;\n",
+	"\t\t\t\t046BD63A27EC51880044E784,\n\t\t\t);\n\t\t\tbuildRules = (\n\t\t\t);\n\t\t\tdependencies = (\n\t\t\t);\n\t\t\tname = DWebBrowser;\n",
+}
+
+func TestEnsureStandardBuildPhases(t *testing.T) {
+	p := loadExampleProjectWith(t, bareResourcesPhase...)
+	target := p.pbxNativeTargetSection.GetObject(exampleAppTargetKey)
+	// drop the Sources phase
+	target.Set("buildPhases", target.ForceGet("buildPhases").([]interface{})[1:])
+
+	p.EnsureStandardBuildPhases("DWebBrowser")
+	p.EnsureStandardBuildPhases("DWebBrowser")
+
+	p = reparse(t, p)
+	buildPhases, _ := p.pbxNativeTargetSection.GetObject(exampleAppTargetKey).ForceGet("buildPhases").([]interface{})
+	tests := []struct {
+		isa  string
+		want int
+	}{
+		{"PBXSourcesBuildPhase", 1},
+		{"PBXFrameworksBuildPhase", 1},
+		// the bare Resources entry is not recognized, a commented one is added
+		{"PBXResourcesBuildPhase", 1},
+	}
+	for _, tt := range tests {
+		got := 0
+		for _, buildPhase := range buildPhases {
+			entry, ok := buildPhase.(pegparser.Object)
+			if ok && p.pbxObjectSection.GetObject(tt.isa).Has(entry.GetString("value")) {
+				got++
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%s phases = %d, want %d in %v", tt.isa, got, tt.want, buildPhases)
+		}
+	}
+}
+
+func TestPbxCreateGroupWithType(t *testing.T) {
+	tests := []struct {
+		name      string
+		groupType string
+		setup     func(p *PbxProject)
+	}{
+		{"existing group section", "PBXGroup", func(p *PbxProject) {}},
+		{"empty group section", "PBXGroup", func(p *PbxProject) {
+			p.pbxGroupSection.Clear()
+		}},
+		{"missing group section", "PBXGroup", func(p *PbxProject) {
+			p.pbxObjectSection.Delete("PBXGroup")
+			p.initSections()
+		}},
+		{"empty variant group section", "PBXVariantGroup", func(p *PbxProject) {
+			p.pbxObjectSection.Set("PBXVariantGroup", pegparser.NewObject())
+		}},
+		{"missing variant group section", "PBXVariantGroup", func(p *PbxProject) {}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			tt.setup(p)
+			existed := p.pbxObjectSection.Has(tt.groupType)
+			section := p.pbxObjectSection.GetObject(tt.groupType)
+			key := p.pbxCreateGroupWithType("Group", "", tt.groupType)
+			if !p.pbxObjectSection.GetObject(tt.groupType).Has(key) {
+				t.Fatalf("%s section misses the new group", tt.groupType)
+			}
+			if existed && !section.Has(key) {
+				t.Errorf("the existing %s section was replaced", tt.groupType)
+			}
+			if tt.groupType == "PBXGroup" && !p.pbxGroupSection.Has(key) {
+				t.Error("pbxGroupSection misses the new group")
+			}
+			if got := reparse(t, p).pbxObjectSection.GetObject(tt.groupType).GetString(key + "_comment"); got != "Group" {
+				t.Errorf("reparsed group comment = %q, want %q", got, "Group")
+			}
+		})
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	path := writeFixture(t, t.TempDir(), "project.pbxproj", []byte("// !$*UTF8*$!\n{\n\tarchiveVersion = 1\n}\n"))
+	project := NewPbxProject(path)
+	err := project.Parse()
+	var pe *pegparser.ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Parse() error = %v, want a *pegparser.ParseError", err)
+	}
+	if pe.Line != 4 || pe.Column != 1 {
+		t.Errorf("position = %d:%d, want 4:1", pe.Line, pe.Column)
+	}
+}
+
+func TestAddTargetProductInProductsGroup(t *testing.T) {
+	tests := []struct {
+		name       string
+		targetType string
+		product    string
+	}{
+		{"Share", "app_extension", "Share.appex"},
+		{"Kit", "framework", "Kit.framework"},
+		{"Helper", "application", "Helper.app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.targetType, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := p.AddTarget(tt.name, tt.targetType, tt.name, ""); err != nil {
+				t.Fatal(err)
+			}
+			p = reparse(t, p)
+			productRef := p.pbxNativeTargetSection.GetObject(p.findTargetKey(tt.name)).GetString("productReference")
+			if !containsString(listValues(p.getPBXGroupByKey(exampleProductsGroupKey), "children"), productRef) {
+				t.Errorf("Products group misses the product %s", productRef)
+			}
+			fileReference := p.pbxFileReferenceSection.GetObject(productRef)
+			if got := unquoted(fileReference.GetString("path")); got != tt.product {
+				t.Errorf("product path = %q, want %q", got, tt.product)
+			}
+			if got := fileReference.GetString("sourceTree"); got != DEFAULT_PRODUCT_SOURCETREE {
+				t.Errorf("product sourceTree = %q, want %q", got, DEFAULT_PRODUCT_SOURCETREE)
+			}
+		})
+	}
+}
+
+func TestObjectAndCompatibilityVersion(t *testing.T) {
+	p := loadExampleProject(t)
+	if got := p.ObjectVersion(); got != 55 {
+		t.Errorf("ObjectVersion() = %d, want 55", got)
+	}
+	if got := p.CompatibilityVersion(); got != "Xcode 13.0" {
+		t.Errorf("CompatibilityVersion() = %q, want %q", got, "Xcode 13.0")
+	}
+
+	tests := []struct {
+		objectVersion        int
+		compatibilityVersion string
+		want                 string
+	}{
+		{56, "Xcode 14.0", "Xcode 14.0"},
+		{56, `"Xcode 14.0"`, "Xcode 14.0"},
+		{46, "Xcode 3.2", "Xcode 3.2"},
+	}
+	for _, tt := range tests {
+		p.SetObjectVersion(tt.objectVersion)
+		p.SetCompatibilityVersion(tt.compatibilityVersion)
+		written := `compatibilityVersion = "` + tt.want + `";`
+		if data := string(NewPbxWriter(p).Bytes()); !strings.Contains(data, written) {
+			t.Errorf("SetCompatibilityVersion(%q) output lacks %q", tt.compatibilityVersion, written)
+		}
+		p = reparse(t, p)
+		if got := p.ObjectVersion(); got != tt.objectVersion {
+			t.Errorf("ObjectVersion() = %d, want %d", got, tt.objectVersion)
+		}
+		if got := p.CompatibilityVersion(); got != tt.want {
+			t.Errorf("CompatibilityVersion() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestKnownRegions(t *testing.T) {
+	p := loadExampleProject(t)
+	if got, want := p.KnownRegions(), []string{"en", "Base"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("KnownRegions() = %v, want %v", got, want)
+	}
+	p.AddKnownRegion("fr")
+	p.AddKnownRegion("zh-Hans")
+	if got, want := reparse(t, p).KnownRegions(), []string{"en", "Base", "fr", "zh-Hans"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("KnownRegions() = %v, want %v", got, want)
+	}
+	if got := (&PbxProject{}).KnownRegions(); got != nil {
+		t.Errorf("KnownRegions() of an empty project = %v, want nil", got)
+	}
+}
+
+func TestReset(t *testing.T) {
+	p := loadExampleProject(t)
+	if err := p.AddSourceFile("InA.swift", PbxFileOptions{}, exampleMainGroupKey); err != nil {
+		t.Fatal(err)
+	}
+	fileRef := p.getFile("InA.swift").FileRef
+
+	other := strings.Replace(string(readExampleProject(t)), "\t\t\tname = DWebBrowser;\n", "\t\t\tname = Other;\n", 1)
+	other = strings.Replace(other, "objectVersion = 55;", "objectVersion = 56;", 1)
+	path := writeFixture(t, t.TempDir(), "project.pbxproj", []byte(other))
+
+	p.Reset()
+	p.SetFilePath(path)
+	if err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if p.getFile("InA.swift") != nil {
+		t.Error("the file added before Reset is still known")
+	}
+	if _, found := p.uuids[fileRef]; found {
+		t.Errorf("uuid %s generated before Reset is still reserved", fileRef)
+	}
+	if got := p.ObjectVersion(); got != 56 {
+		t.Errorf("ObjectVersion() = %d, want 56", got)
+	}
+	if p.findTargetKey("DWebBrowser") != "" || p.findTargetKey("Other") != exampleAppTargetKey {
+		t.Error("targets of the first project are still listed")
+	}
+}
+
+func TestAddToLocalizationVariantGroup(t *testing.T) {
+	p := loadExampleProject(t)
+	p.AddLocalizationVariantGroup("Localizable.strings")
+	members := []struct {
+		language string
+		path     string
+	}{
+		{"en", "en.lproj/Localizable.strings"},
+		{"fr", "fr.lproj/Localizable.strings"},
+	}
+	for _, member := range members {
+		if _, err := p.AddToLocalizationVariantGroup("Localizable.strings", member.language, member.path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.AddToLocalizationVariantGroup("Localizable.strings", "fr", "fr.lproj/Localizable.strings"); err == nil {
+		t.Error("adding fr twice succeeded")
+	}
+	if _, err := p.AddToLocalizationVariantGroup("Missing.strings", "fr", "fr.lproj/Missing.strings"); err == nil {
+		t.Error("adding to a missing variant group succeeded")
+	}
+
+	p = reparse(t, p)
+	group := p.getPBXVariantGroupByKey(p.findPBXVariantGroupKey(FindGroupCriteria{Name: "Localizable.strings"}))
+	children, _ := group.ForceGet("children").([]interface{})
+	if len(children) != len(members) {
+		t.Fatalf("children = %v, want %d members", children, len(members))
+	}
+	for i, member := range members {
+		child := children[i].(pegparser.Object)
+		if got := child.GetString("comment"); got != member.language {
+			t.Errorf("children[%d] comment = %q, want %q", i, got, member.language)
+		}
+		fileReference := p.pbxFileReferenceSection.GetObject(child.GetString("value"))
+		if got := unquoted(fileReference.GetString("name")); got != member.language {
+			t.Errorf("%s name = %q, want %q", member.language, got, member.language)
+		}
+		if got := unquoted(fileReference.GetString("path")); got != member.path {
+			t.Errorf("%s path = %q, want %q", member.language, got, member.path)
+		}
+	}
+}
+
+func TestApplyBuildSettings(t *testing.T) {
+	p := loadExampleProject(t)
+	p.ApplyBuildSettings(map[string]interface{}{
+		"PRODUCT_NAME":   "My App",
+		"SWIFT_VERSION":  "5.0",
+		"ENABLE_BITCODE": false,
+		"OTHER_LDFLAGS":  []string{"-ObjC", "$(inherited)"},
+	}, "", "DWebBrowser")
+	p = reparse(t, p)
+
+	tests := []struct {
+		key  string
+		want interface{}
+	}{
+		{"PRODUCT_NAME", `"My App"`},
+		{"SWIFT_VERSION", "5.0"},
+		{"ENABLE_BITCODE", "NO"},
+		{"OTHER_LDFLAGS", []interface{}{`"-ObjC"`, `"$(inherited)"`}},
+	}
+	configurations := p.buildConfigurations("", "DWebBrowser")
+	if len(configurations) != 2 {
+		t.Fatalf("DWebBrowser has %d configurations, want 2", len(configurations))
+	}
+	for _, configuration := range configurations {
+		buildSettings := configuration.GetObject("buildSettings")
+		for _, tt := range tests {
+			if got := buildSettings.ForceGet(tt.key); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s %s = %#v, want %#v", configuration.GetString("name"), tt.key, got, tt.want)
+			}
+		}
+	}
+	for _, configuration := range p.buildConfigurations("", "DWebBrowserTests") {
+		if configuration.GetObject("buildSettings").Has("ENABLE_BITCODE") {
+			t.Errorf("DWebBrowserTests %s got ENABLE_BITCODE", configuration.GetString("name"))
+		}
+	}
+}
+
+func TestRemoveFrameworkWithSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		options PbxFileOptions
+	}{
+		{"weak", PbxFileOptions{Link: true, Weak: true}},
+		{"compiler flags", PbxFileOptions{Link: true, CompilerFlags: "-fobjc-arc"}},
+		{"plain", PbxFileOptions{Link: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := p.AddFramework("Foo.framework", tt.options); err != nil {
+				t.Fatal(err)
+			}
+			fileReferences := p.FindFileReferencesByBasename("Foo.framework")
+			if len(fileReferences) != 1 {
+				t.Fatalf("Foo.framework has %d file references, want 1", len(fileReferences))
+			}
+			fileRef := fileReferences[0].UUID
+			if err := p.RemoveFramework("Foo.framework", tt.options); err != nil {
+				t.Fatal(err)
+			}
+			p = reparse(t, p)
+			p.pbxBuildFileSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+				if value.(pegparser.Object).GetString("fileRef") == fileRef {
+					t.Errorf("build file %s of the removed framework remains", key)
+				}
+				return pegparser.IterateActionContinue
+			}, nonCommentsFilter)
+			if files := listValues(p.pbxFrameworksBuildPhaseObj(exampleAppTargetKey), "files"); len(files) != 0 {
+				t.Errorf("Frameworks files = %v, want none", files)
+			}
+		})
+	}
+}
+
+func TestFileReferenceQuoting(t *testing.T) {
+	tests := []struct {
+		path     string
+		wantPath string
+	}{
+		{"foo.m", "foo.m"},
+		{"Sources/foo.m", "Sources/foo.m"},
+		{"my file.m", `"my file.m"`},
+		{"Sources/my-file.m", `"Sources/my-file.m"`},
+	}
+	p := loadExampleProject(t)
+	for _, tt := range tests {
+		if err := p.AddSourceFile(tt.path, PbxFileOptions{}, exampleMainGroupKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := string(NewPbxWriter(p).Bytes())
+	p = reparse(t, p)
+	for _, tt := range tests {
+		pbxfile := p.getFile(tt.path)
+		if pbxfile == nil {
+			t.Errorf("%s is missing after the round trip", tt.path)
+			continue
+		}
+		if !strings.Contains(data, "path = "+tt.wantPath+";") {
+			t.Errorf("output lacks path = %s;", tt.wantPath)
+		}
+		if got := p.pbxFileReferenceSection.GetObject(pbxfile.FileRef).GetString("path"); got != tt.wantPath {
+			t.Errorf("path = %s, want %s", got, tt.wantPath)
+		}
+	}
+}
+
+func TestAppTarget(t *testing.T) {
+	p := loadExampleProject(t)
+	if err := p.AddTarget("Share", "app_extension", "Share", ""); err != nil {
+		t.Fatal(err)
+	}
+	project := p.getFirstProject().Object
+	targets := project.ForceGet("targets").([]interface{})
+	tests := []struct {
+		name    string
+		targets []interface{}
+	}{
+		{"app first", targets},
+		{"extension first", append([]interface{}{targets[len(targets)-1]}, targets[:len(targets)-1]...)},
+	}
+	for _, tt := range tests {
+		project.Set("targets", tt.targets)
+		target, ok := p.AppTarget()
+		if !ok || target.UUID != exampleAppTargetKey {
+			t.Errorf("%s: AppTarget() = %s, %v, want %s", tt.name, target.UUID, ok, exampleAppTargetKey)
+		}
+	}
+
+	p.pbxNativeTargetSection.GetObject(exampleAppTargetKey).Set("productType", `"com.apple.product-type.framework"`)
+	if target, ok := p.AppTarget(); ok {
+		t.Errorf("AppTarget() = %s without an application target", target.UUID)
+	}
+}
+
+func TestAddEntitlements(t *testing.T) {
+	tests := []struct {
+		target    string
+		filePath  string
+		wantGroup string
+		wantRef   string
+	}{
+		// DWebBrowser has a group with path DWebBrowser, the reference is relative to it
+		{"DWebBrowser", "DWebBrowser/DWebBrowser.entitlements", "046BD63E27EC51880044E784", "DWebBrowser.entitlements"},
+		{"DWebBrowserTests", "Tests.entitlements", "046BD65527EC518A0044E784", "Tests.entitlements"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := p.AddEntitlements(tt.filePath, tt.target); err != nil {
+				t.Fatal(err)
+			}
+			p = reparse(t, p)
+			pbxfile := p.getFile(tt.wantRef)
+			if pbxfile == nil {
+				t.Fatalf("no file reference with path %s", tt.wantRef)
+			}
+			if !containsString(listValues(p.getPBXGroupByKey(tt.wantGroup), "children"), pbxfile.FileRef) {
+				t.Errorf("group %s misses the entitlements", tt.wantGroup)
+			}
+			for _, configuration := range p.buildConfigurations("", tt.target) {
+				if got := configuration.GetObject("buildSettings").GetString("CODE_SIGN_ENTITLEMENTS"); unquoted(got) != tt.filePath {
+					t.Errorf("%s CODE_SIGN_ENTITLEMENTS = %s, want %s", configuration.GetString("name"), got, tt.filePath)
+				}
+			}
+		})
+	}
+
+	p := loadExampleProject(t)
+	if err := p.AddEntitlements("Missing.entitlements", "Missing"); err == nil {
+		t.Error("AddEntitlements on a missing target succeeded")
+	}
+}
+
+func TestProductNameAndType(t *testing.T) {
+	p := loadExampleProject(t)
+	// without productName the name comes from the product reference
+	p.pbxNativeTargetSection.GetObject(exampleTestsTargetKey).Delete("productName")
+	tests := []struct {
+		target      string
+		productName string
+		productType string
+	}{
+		{"DWebBrowser", "DWebBrowser", "com.apple.product-type.application"},
+		{"DWebBrowserTests", "DWebBrowserTests", "com.apple.product-type.bundle.unit-test"},
+		{"DWebBrowserUITests", "DWebBrowserUITests", "com.apple.product-type.bundle.ui-testing"},
+		{"Missing", "", ""},
+	}
+	for _, tt := range tests {
+		if got := p.ProductName(tt.target); got != tt.productName {
+			t.Errorf("ProductName(%q) = %q, want %q", tt.target, got, tt.productName)
+		}
+		if got := p.ProductType(tt.target); got != tt.productType {
+			t.Errorf("ProductType(%q) = %q, want %q", tt.target, got, tt.productType)
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	groups := loadExampleProject(t).Groups()
+	tests := []struct {
+		uuid string
+		name string
+		path string
+	}{
+		{exampleMainGroupKey, "", ""},
+		{exampleProductsGroupKey, "Products", ""},
+		{"046BD63E27EC51880044E784", "", "DWebBrowser"},
+		{"046BD65527EC518A0044E784", "", "DWebBrowserTests"},
+		{"046BD65F27EC518A0044E784", "", "DWebBrowserUITests"},
+	}
+	if len(groups) < len(tests) {
+		t.Fatalf("Groups() returned %d groups, want at least %d", len(groups), len(tests))
+	}
+	for i, tt := range tests {
+		group := groups[i]
+		if group.UUID != tt.uuid {
+			t.Errorf("groups[%d] = %s, want %s", i, group.UUID, tt.uuid)
+			continue
+		}
+		if got := group.GetString("name"); got != tt.name {
+			t.Errorf("%s name = %q, want %q", tt.uuid, got, tt.name)
+		}
+		if got := group.GetString("path"); got != tt.path {
+			t.Errorf("%s path = %q, want %q", tt.uuid, got, tt.path)
+		}
+	}
+	for _, group := range groups {
+		if group.GetString("isa") != "PBXGroup" {
+			t.Errorf("%s isa = %s, want PBXGroup", group.UUID, group.GetString("isa"))
+		}
+	}
+}
+
+func TestAddToPbxGroupKeepsExtraKeys(t *testing.T) {
+	const groupKey = "046BD63E27EC51880044E784"
+	tests := []struct {
+		name  string
+		setup func(p *PbxProject)
+	}{
+		{"by comment", func(p *PbxProject) {}},
+		{"by path without comment", func(p *PbxProject) { p.pbxGroupSection.Delete(toCommentKey(groupKey)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			tt.setup(p)
+			group := p.getPBXGroupByKey(groupKey)
+			group.Set("usesTabs", 1)
+			group.Set("indentWidth", 2)
+			groupCount := len(p.Groups())
+
+			pbxfile := newPbxFile("Extra.swift", newPbxFileOptions())
+			pbxfile.FileRef = p.generateUuid()
+			p.addToPbxGroup(pbxfile, "DWebBrowser")
+
+			p = reparse(t, p)
+			if got := len(p.Groups()); got != groupCount {
+				t.Errorf("%d groups, want %d", got, groupCount)
+			}
+			group = p.getPBXGroupByKey(groupKey)
+			if !containsString(listValues(group, "children"), pbxfile.FileRef) {
+				t.Error("DWebBrowser group misses the new child")
+			}
+			if group.GetInt("usesTabs") != 1 || group.GetInt("indentWidth") != 2 {
+				t.Errorf("extra keys lost: usesTabs = %v, indentWidth = %v", group.ForceGet("usesTabs"), group.ForceGet("indentWidth"))
+			}
+		})
+	}
+}
+
+func TestReparseFromWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		reparse func(p *PbxProject) error
+	}{
+		{"ReparseFromWriter", func(p *PbxProject) error { return p.ReparseFromWriter(NewPbxWriter(p)) }},
+		{"ReparseBytes", func(p *PbxProject) error { return p.ReparseBytes(NewPbxWriter(p).Bytes()) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := p.AddSourceFile("Mutated.swift", PbxFileOptions{}, exampleMainGroupKey); err != nil {
+				t.Fatal(err)
+			}
+			p.AddKnownRegion("fr")
+			if err := tt.reparse(p); err != nil {
+				t.Fatal(err)
+			}
+			pbxfile := p.getFile("Mutated.swift")
+			if pbxfile == nil {
+				t.Fatal("Mutated.swift is lost")
+			}
+			if !containsString(listValues(p.getPBXGroupByKey(exampleMainGroupKey), "children"), pbxfile.FileRef) {
+				t.Error("main group misses Mutated.swift")
+			}
+			if !containsString(p.KnownRegions(), "fr") {
+				t.Errorf("KnownRegions() = %v, misses fr", p.KnownRegions())
+			}
+			// the sections point into the new contents
+			if !p.pbxObjectSection.GetObject("PBXFileReference").Has(pbxfile.FileRef) || !p.pbxFileReferenceSection.Has(pbxfile.FileRef) {
+				t.Error("file reference section is stale")
+			}
+		})
+	}
+
+	p := loadExampleProject(t)
+	if err := p.ReparseBytes([]byte("not a project")); err == nil {
+		t.Error("ReparseBytes accepted garbage")
+	}
+}
+
+func TestWriterRendersOnce(t *testing.T) {
+	p := loadExampleProject(t)
+	if err := p.AddSourceFile("Mutated.swift", PbxFileOptions{}, exampleMainGroupKey); err != nil {
+		t.Fatal(err)
+	}
+	w := NewPbxWriter(p)
+	path := filepath.Join(t.TempDir(), "project.pbxproj")
+	if err := w.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Bytes(); !bytes.Equal(got, written) {
+		t.Fatalf("Bytes() after Write is %d bytes, Write wrote %d", len(got), len(written))
+	}
+	if got := bytes.Count(written, []byte("// !$*UTF8*$!")); got != 1 {
+		t.Errorf("output holds the project %d times", got)
+	}
+
+	if err := p.ReparseFromWriter(w); err != nil {
+		t.Fatal(err)
+	}
+	if got := NewPbxWriter(p).Bytes(); !bytes.Equal(got, written) {
+		t.Error("ReparseFromWriter after Write changed the project")
+	}
+}
+
+func TestFindFileReferencesByBasename(t *testing.T) {
+	p := loadExampleProject(t)
+	for _, add := range []struct{ path, group string }{
+		{"App/Config.swift", "046BD63E27EC51880044E784"},
+		{"Tests/Config.swift", "046BD65527EC518A0044E784"},
+	} {
+		if err := p.AddSourceFile(add.path, PbxFileOptions{}, add.group); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p = reparse(t, p)
+
+	tests := []struct {
+		basename string
+		want     []string
+	}{
+		{"Config.swift", []string{"App/Config.swift", "Tests/Config.swift"}},
+		{"AppDelegate.swift", []string{"AppDelegate.swift"}},
+		{"Missing.swift", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, ref := range p.FindFileReferencesByBasename(tt.basename) {
+			got = append(got, unquoted(ref.GetString("path")))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FindFileReferencesByBasename(%q) paths = %v, want %v", tt.basename, got, tt.want)
+		}
+	}
+}
+
+// TestConcurrentReads is meant for go test -race: reads after Parse need no lock.
+func TestConcurrentReads(t *testing.T) {
+	p := loadExampleProject(t)
+	want := string(NewPbxWriter(p).Bytes())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := string(NewPbxWriter(p).Bytes()); got != want {
+				t.Error("concurrent writes differ")
+			}
+			if _, ok := p.AppTarget(); !ok {
+				t.Error("AppTarget() found nothing")
+			}
+			if len(p.Groups()) == 0 {
+				t.Error("Groups() found nothing")
+			}
+			if len(p.FindFileReferencesByBasename("AppDelegate.swift")) != 1 {
+				t.Error("FindFileReferencesByBasename found no AppDelegate.swift")
+			}
+			_ = p.Frameworks()
+			_ = p.KnownRegions()
+			_ = p.BuildConfigurations("DWebBrowser")
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLastSwiftUpdateCheck(t *testing.T) {
+	p := reparse(t, loadExampleProject(t))
+	if got := p.LastSwiftUpdateCheck(""); got != 1320 {
+		t.Errorf("LastSwiftUpdateCheck(\"\") = %d, want the parsed 1320", got)
+	}
+
+	tests := []struct {
+		target    string
+		check     int
+		migration int
+	}{
+		{"", 1400, 0},
+		{"DWebBrowser", 1410, 1420},
+		{"DWebBrowserTests", 1500, 1510},
+	}
+	for _, tt := range tests {
+		p.SetLastSwiftUpdateCheck(tt.target, tt.check)
+		if tt.migration != 0 {
+			p.SetLastSwiftMigrationOfTarget(tt.target, tt.migration)
+		}
+	}
+	p.SetLastSwiftUpdateCheck("Missing", 1600)
+	p = reparse(t, p)
+	for _, tt := range tests {
+		if got := p.LastSwiftUpdateCheck(tt.target); got != tt.check {
+			t.Errorf("LastSwiftUpdateCheck(%q) = %d, want %d", tt.target, got, tt.check)
+		}
+		if got := p.LastSwiftMigrationOfTarget(tt.target); got != tt.migration {
+			t.Errorf("LastSwiftMigrationOfTarget(%q) = %d, want %d", tt.target, got, tt.migration)
+		}
+	}
+	if got := p.LastSwiftUpdateCheck("Missing"); got != 0 {
+		t.Errorf("LastSwiftUpdateCheck(\"Missing\") = %d, want 0", got)
+	}
+	// the existing target attributes are kept
+	if got := p.projectAttributes("DWebBrowser", false).GetString("CreatedOnToolsVersion"); got != "13.2.1" {
+		t.Errorf("DWebBrowser CreatedOnToolsVersion = %q, want 13.2.1", got)
+	}
+}
+
+func TestEnsureStandardBuildPhasesAddsMissingPhase(t *testing.T) {
+	p := loadExampleProject(t)
+	target := p.pbxNativeTargetSection.GetObject(exampleAppTargetKey)
+	// drop the Resources phase, Sources and Frameworks remain
+	target.Set("buildPhases", target.ForceGet("buildPhases").([]interface{})[:2])
+
+	p.EnsureStandardBuildPhases(exampleAppTargetKey)
+	p.EnsureStandardBuildPhases("Missing")
+	p = reparse(t, p)
+
+	buildPhases := listValues(p.pbxNativeTargetSection.GetObject(exampleAppTargetKey), "buildPhases")
+	if len(buildPhases) != 3 {
+		t.Fatalf("buildPhases = %v, want 3 phases", buildPhases)
+	}
+	if buildPhases[0] != "046BD63827EC51880044E784" || buildPhases[1] != "046BD63927EC51880044E784" {
+		t.Errorf("buildPhases = %v, want the existing Sources and Frameworks phases first", buildPhases)
+	}
+	resources := p.pbxObjectSection.GetObject("PBXResourcesBuildPhase").GetObject(buildPhases[2])
+	if resources.IsEmpty() || buildPhases[2] == "046BD63A27EC51880044E784" {
+		t.Errorf("buildPhases[2] = %s, want a new Resources phase", buildPhases[2])
+	}
+	if files, ok := resources.ForceGet("files").([]interface{}); !ok || len(files) != 0 {
+		t.Errorf("new Resources phase files = %v, want an empty list", resources.ForceGet("files"))
+	}
+}
+
+func TestDeploymentTargetVersion(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     interface{}
+		platform  string
+		wantMajor int
+		wantMinor int
+		wantOk    bool
+	}{
+		{"major only", int64(16), "ios", 16, 0, true},
+		{"major only string", "16", "ios", 16, 0, true},
+		{"major and minor", "16.4", "ios", 16, 4, true},
+		{"quoted", `"17.0"`, "iOS", 17, 0, true},
+		{"parsed value", nil, "ios", 15, 2, true},
+		{"not a version", "latest", "ios", 0, 0, false},
+		{"missing platform setting", nil, "macos", 0, 0, false},
+		{"unknown platform", nil, "dos", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if tt.value != nil {
+				for _, configuration := range p.buildConfigurations("", "DWebBrowser") {
+					configuration.GetObject("buildSettings").Set("IPHONEOS_DEPLOYMENT_TARGET", tt.value)
+				}
+			}
+			major, minor, ok := reparse(t, p).DeploymentTargetVersion("DWebBrowser", tt.platform)
+			if major != tt.wantMajor || minor != tt.wantMinor || ok != tt.wantOk {
+				t.Errorf("DeploymentTargetVersion() = %d, %d, %v, want %d, %d, %v", major, minor, ok, tt.wantMajor, tt.wantMinor, tt.wantOk)
+			}
+		})
+	}
+
+	// without a target setting the project's applies
+	p := loadExampleProject(t)
+	for _, configuration := range p.buildConfigurations("", "DWebBrowser") {
+		configuration.GetObject("buildSettings").Delete("IPHONEOS_DEPLOYMENT_TARGET")
+	}
+	if major, minor, ok := p.DeploymentTargetVersion("DWebBrowser", "ios"); major != 15 || minor != 2 || !ok {
+		t.Errorf("DeploymentTargetVersion() = %d, %d, %v, want the project's 15, 2, true", major, minor, ok)
+	}
+}
+
+func TestRenameGroup(t *testing.T) {
+	tests := []struct {
+		name      string
+		oldName   string
+		newName   string
+		groupKey  string
+		parentKey string
+		wantPath  string
+	}{
+		{"named group", "Products", "Build Products", exampleProductsGroupKey, exampleMainGroupKey, ""},
+		{"group with path only", "DWebBrowserTests", "Tests", "046BD65527EC518A0044E784", exampleMainGroupKey, "DWebBrowserTests"},
+		{"nested group", "Tools", "Utilities", "046BD67427EC52D40044E784", "046BD63E27EC51880044E784", "Tools"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := p.RenameGroup(tt.oldName, tt.newName); err != nil {
+				t.Fatal(err)
+			}
+			p = reparse(t, p)
+			if got := p.findPBXGroupKey(FindGroupCriteria{Name: tt.newName}); got != tt.groupKey {
+				t.Errorf("group named %q = %s, want %s", tt.newName, got, tt.groupKey)
+			}
+			if got := p.pbxGroupSection.GetString(toCommentKey(tt.groupKey)); got != tt.newName {
+				t.Errorf("section comment = %q, want %q", got, tt.newName)
+			}
+			group := p.getPBXGroupByKey(tt.groupKey)
+			if got := unquoted(group.GetString("path")); got != tt.wantPath {
+				t.Errorf("path = %q, want %q", got, tt.wantPath)
+			}
+			if tt.wantPath != "" && group.IndexOf("name") > group.IndexOf("path") {
+				t.Error("name is written after path")
+			}
+			found := false
+			children, _ := p.getPBXGroupByKey(tt.parentKey).ForceGet("children").([]interface{})
+			for _, child := range children {
+				if child := child.(pegparser.Object); child.GetString("value") == tt.groupKey {
+					found = true
+					if got := child.GetString("comment"); got != tt.newName {
+						t.Errorf("parent child comment = %q, want %q", got, tt.newName)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("parent %s lost the child %s", tt.parentKey, tt.groupKey)
+			}
+		})
+	}
+
+	if err := loadExampleProject(t).RenameGroup("Missing", "Other"); err == nil {
+		t.Error("renaming a missing group succeeded")
+	}
+}
+
+func TestAddStaticFramework(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      PbxFileOptions
+		wantEmbedded bool
+	}{
+		{"dynamic", PbxFileOptions{Link: true, CustomFramework: true, Embed: true}, true},
+		{"static", PbxFileOptions{Link: true, CustomFramework: true, Embed: true, Static: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := p.AddBuildPhase([]string{}, "PBXCopyFilesBuildPhase", "Embed Frameworks", exampleAppTargetKey, "frameworks", ""); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.AddFramework("Kit.framework", tt.options); err != nil {
+				t.Fatal(err)
+			}
+			p = reparse(t, p)
+			if got := len(listValues(p.pbxEmbedFrameworksBuildPhaseObj(exampleAppTargetKey), "files")) > 0; got != tt.wantEmbedded {
+				t.Errorf("embedded = %v, want %v", got, tt.wantEmbedded)
+			}
+			if files := listValues(p.pbxFrameworksBuildPhaseObj(exampleAppTargetKey), "files"); len(files) != 1 {
+				t.Errorf("Frameworks files = %v, want the framework linked once", files)
+			}
+		})
+	}
+}
+
+func TestParseUTF8Marker(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+	}{
+		{"canonical", "// !$*UTF8*$!\n"},
+		{"bom", "\xEF\xBB\xBF// !$*UTF8*$!\n"},
+		{"no space", "//!$*UTF8*$!\n"},
+		{"trailing blanks", "// !$*UTF8*$!  \t\n"},
+		{"bom and no space", "\xEF\xBB\xBF//!$*UTF8*$!\n"},
+	}
+	example := readExampleProject(t)
+	body := example[bytes.IndexByte(example, '\n')+1:]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFixture(t, t.TempDir(), "project.pbxproj", append([]byte(tt.head), body...))
+			p := loadProject(t, path)
+			if got := p.HeadComment(); got != utf8Marker {
+				t.Errorf("head comment = %q, want %q", got, utf8Marker)
+			}
+			if got := NewPbxWriter(p).Bytes(); !bytes.Equal(got, example) {
+				t.Errorf("output differs from the example project, starts with %q", got[:20])
+			}
+		})
+	}
+}
+
+func TestMakePathsRelative(t *testing.T) {
+	const (
+		thirdKey    = "041EBF1527EDCAE40048F984"
+		delegateKey = "046BD63F27EC51880044E784"
+		viewKey     = "046BD64327EC51880044E784"
+	)
+	tests := []struct {
+		name        string
+		srcRoot     string
+		wantChanged int
+		wantPaths   map[string]string
+	}{
+		{"root", "/Users/me/App", 2, map[string]string{
+			thirdKey:    "DWebBrowser/ThirdViewController.swift",
+			delegateKey: "/Users/other/AppDelegate.swift",
+			viewKey:     "My Dir/ViewController.swift",
+		}},
+		{"trailing slash", "/Users/me/App/", 2, map[string]string{
+			thirdKey: "DWebBrowser/ThirdViewController.swift",
+			viewKey:  "My Dir/ViewController.swift",
+		}},
+		{"subfolder", "/Users/me/App/DWebBrowser", 1, map[string]string{
+			thirdKey: "ThirdViewController.swift",
+			viewKey:  "/Users/me/App/My Dir/ViewController.swift",
+		}},
+		{"sibling with the same prefix", "/Users/me/Ap", 0, map[string]string{
+			thirdKey: "/Users/me/App/DWebBrowser/ThirdViewController.swift",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProjectWith(t,
+				"path = ThirdViewController.swift;", "path = /Users/me/App/DWebBrowser/ThirdViewController.swift;",
+				"path = AppDelegate.swift;", "path = /Users/other/AppDelegate.swift;",
+				"path = ViewController.swift;", `path = "/Users/me/App/My Dir/ViewController.swift";`,
+			)
+			if got := p.MakePathsRelative(tt.srcRoot); got != tt.wantChanged {
+				t.Errorf("MakePathsRelative(%q) = %d, want %d", tt.srcRoot, got, tt.wantChanged)
+			}
+			p = reparse(t, p)
+			for key, want := range tt.wantPaths {
+				fileReference := p.pbxFileReferenceSection.GetObject(key)
+				if got := unquoted(fileReference.GetString("path")); got != want {
+					t.Errorf("%s path = %q, want %q", key, got, want)
+				}
+				wantSourceTree := `"<group>"`
+				if !strings.HasPrefix(want, "/") {
+					wantSourceTree = "SOURCE_ROOT"
+				}
+				if got := fileReference.GetString("sourceTree"); got != wantSourceTree {
+					t.Errorf("%s sourceTree = %s, want %s", key, got, wantSourceTree)
+				}
+			}
+		})
+	}
+}
+
+func TestParseUnsupportedFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"binary plist", "bplist00\xd4\x01\x02\x03\x04", ErrUnsupportedFormat},
+		{"xml plist", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<plist version=\"1.0\">\n<dict/>\n</plist>\n", ErrUnsupportedFormat},
+		{"xml plist without declaration", "<plist version=\"1.0\">\n<dict/>\n</plist>\n", ErrUnsupportedFormat},
+		{"xml plist after bom and blanks", "\xEF\xBB\xBF\n  <?xml version=\"1.0\"?>\n<plist/>\n", ErrUnsupportedFormat},
+		{"ascii plist", string(readExampleProject(t)), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFixture(t, t.TempDir(), "project.pbxproj", []byte(tt.data))
+			project := NewPbxProject(path)
+			if err := project.Parse(); !errors.Is(err, tt.want) {
+				t.Errorf("Parse() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddAssetCatalog(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		basename string
+	}{
+		{"catalog", "Media.xcassets", "Media.xcassets"},
+		{"trailing slash", "Media.xcassets/", "Media.xcassets"},
+		{"nested", "Shared/Icons.xcassets/", "Icons.xcassets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := p.AddResourceFile(tt.path, PbxFileOptions{}, "046BD63E27EC51880044E784"); err != nil {
+				t.Fatal(err)
+			}
+			p = reparse(t, p)
+
+			refs := p.FindFileReferencesByBasename(tt.basename)
+			if len(refs) != 1 {
+				t.Fatalf("%d file references to %s, want 1", len(refs), tt.basename)
+			}
+			if got := refs[0].GetString("lastKnownFileType"); got != "folder.assetcatalog" {
+				t.Errorf("lastKnownFileType = %s, want folder.assetcatalog", got)
+			}
+			if got := unquoted(refs[0].GetString("path")); strings.HasSuffix(got, "/") {
+				t.Errorf("path = %q, want no trailing slash", got)
+			}
+
+			inResources := 0
+			p.pbxBuildFileSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+				buildFile := value.(pegparser.Object)
+				if buildFile.GetString("fileRef") == refs[0].UUID &&
+					containsString(listValues(p.pbxResourcesBuildPhaseObj(exampleAppTargetKey), "files"), key) {
+					inResources++
+				}
+				return pegparser.IterateActionContinue
+			}, nonCommentsFilter)
+			if inResources != 1 {
+				t.Errorf("catalog is in the Resources phase %d times, want 1", inResources)
+			}
+		})
+	}
+
+	if err := loadExampleProject(t).AddResourceFile("Assets.xcassets/", PbxFileOptions{}, "046BD63E27EC51880044E784"); err == nil {
+		t.Error("adding the existing Assets.xcassets again succeeded")
+	}
+}
+
+func TestSetOnlyActiveArch(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		debug, release bool
+	}{
+		{"usual", "DWebBrowser", true, false},
+		{"both", "DWebBrowser", true, true},
+		{"neither", "DWebBrowserTests", false, false},
+		{"inverted", "DWebBrowserTests", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			p.SetOnlyActiveArch(tt.target, tt.debug, tt.release)
+			p = reparse(t, p)
+			for build, want := range map[string]bool{"Debug": tt.debug, "Release": tt.release} {
+				if got, ok := p.OnlyActiveArch(tt.target, build); !ok || got != want {
+					t.Errorf("OnlyActiveArch(%s, %s) = %v, %v, want %v, true", tt.target, build, got, ok, want)
+				}
+			}
+		})
+	}
+
+	// other targets keep their settings
+	p := loadExampleProject(t)
+	p.SetOnlyActiveArch("DWebBrowser", true, false)
+	if _, ok := p.OnlyActiveArch("DWebBrowserTests", "Release"); ok {
+		t.Error("ONLY_ACTIVE_ARCH was set on DWebBrowserTests")
+	}
+}
+
+func TestAddBuildPropertyAppend(t *testing.T) {
+	const projectDebugKey = "046BD66427EC518A0044E784"
+	tests := []struct {
+		name   string
+		prop   string
+		values []string
+		want   []string
+	}{
+		{"list", "GCC_PREPROCESSOR_DEFINITIONS", []string{"FOO=1", "BAR=1"}, []string{"DEBUG=1", "$(inherited)", "FOO=1", "BAR=1"}},
+		{"present", "GCC_PREPROCESSOR_DEFINITIONS", []string{"DEBUG=1", "$(inherited)"}, []string{"DEBUG=1", "$(inherited)"}},
+		{"single value", "SWIFT_ACTIVE_COMPILATION_CONDITIONS", []string{"EXTRA"}, []string{"DEBUG", "EXTRA"}},
+		{"new", "OTHER_SWIFT_FLAGS", []string{"-DFOO", "-DBAR"}, []string{"-DFOO", "-DBAR"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			for _, value := range tt.values {
+				p.AddBuildPropertyAppend(tt.prop, value, "Debug")
+			}
+			p = reparse(t, p)
+			buildSettings := p.pbxXCBuildConfigurationSection.GetObject(projectDebugKey).GetObject("buildSettings")
+			got := []string{}
+			for _, value := range listValues(buildSettings, tt.prop) {
+				got = append(got, unquoted(value))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.prop, got, tt.want)
+			}
+		})
+	}
+
+	p := loadExampleProject(t)
+	p.AddBuildPropertyAppend("OTHER_SWIFT_FLAGS", "-DFOO", "Debug")
+	for _, configuration := range p.buildConfigurations("Release", "") {
+		if configuration.GetObject("buildSettings").Has("OTHER_SWIFT_FLAGS") {
+			t.Error("OTHER_SWIFT_FLAGS was added to a Release configuration")
+		}
+	}
+}
+
+func TestLikelyXcodeVersion(t *testing.T) {
+	tests := []struct {
+		objectVersion    string
+		lastUpgradeCheck string
+		want             string
+	}{
+		{"55", "1320", "Xcode 13+"},
+		{"56", "1320", "Xcode 14+"},
+		{"46", "1320", "Xcode 3.2+"},
+		{"63", "1320", "Xcode 15.3+"},
+		{"99", "1320", "Xcode 13.2+"},
+		{"99", "1500", "Xcode 15+"},
+		{"99", "0", ""},
+	}
+	for _, tt := range tests {
+		p := loadExampleProjectWith(t,
+			"objectVersion = 55;", "objectVersion = "+tt.objectVersion+";",
+			"LastUpgradeCheck = 1320;", "LastUpgradeCheck = "+tt.lastUpgradeCheck+";",
+		)
+		if got := p.LikelyXcodeVersion(); got != tt.want {
+			t.Errorf("objectVersion %s, LastUpgradeCheck %s: LikelyXcodeVersion() = %q, want %q",
+				tt.objectVersion, tt.lastUpgradeCheck, got, tt.want)
+		}
+	}
+}
+
+func TestAddWeakFramework(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      PbxFileOptions
+		wantSettings string
+	}{
+		{"weak", PbxFileOptions{Link: true, Weak: true}, "settings = {ATTRIBUTES = (Weak, ); };"},
+		{"required", PbxFileOptions{Link: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := p.AddFramework("CoreNFC.framework", tt.options); err != nil {
+				t.Fatal(err)
+			}
+
+			var line string
+			for _, l := range strings.Split(string(NewPbxWriter(p).Bytes()), "\n") {
+				if strings.Contains(l, "/* CoreNFC.framework in Frameworks */ = {isa = PBXBuildFile;") {
+					line = l
+				}
+			}
+			if line == "" {
+				t.Fatal("no PBXBuildFile entry for CoreNFC.framework")
+			}
+			if tt.wantSettings == "" && strings.Contains(line, "settings") {
+				t.Errorf("build file %q has settings", line)
+			} else if !strings.Contains(line, tt.wantSettings) {
+				t.Errorf("build file %q lacks %s", line, tt.wantSettings)
+			}
+
+			p = reparse(t, p)
+			refs := p.FindFileReferencesByBasename("CoreNFC.framework")
+			if len(refs) != 1 {
+				t.Fatalf("%d file references to CoreNFC.framework, want 1", len(refs))
+			}
+			linked := false
+			for _, buildFileKey := range listValues(p.pbxFrameworksBuildPhaseObj(exampleAppTargetKey), "files") {
+				if p.pbxBuildFileSection.GetObject(buildFileKey).GetString("fileRef") == refs[0].UUID {
+					linked = true
+				}
+			}
+			if !linked {
+				t.Error("CoreNFC.framework is not in the Frameworks phase")
+			}
+		})
+	}
+}
+
+func TestRemoveBuildPropertyForTarget(t *testing.T) {
+	const prop = "PRODUCT_BUNDLE_IDENTIFIER"
+	targets := []string{"DWebBrowser", "DWebBrowserTests", "DWebBrowserUITests"}
+	tests := []struct {
+		name      string
+		buildName string
+		target    string
+	}{
+		{"one configuration", "Release", "DWebBrowserTests"},
+		{"all configurations", "", "DWebBrowser"},
+		{"missing target", "", "Missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			p.RemoveBuildPropertyForTarget(prop, tt.buildName, tt.target)
+			p = reparse(t, p)
+			for _, target := range targets {
+				for _, build := range []string{"Debug", "Release"} {
+					removed := target == tt.target && (tt.buildName == "" || tt.buildName == build)
+					configurations := p.buildConfigurations(build, target)
+					if len(configurations) != 1 {
+						t.Fatalf("%s has %d %s configurations, want 1", target, len(configurations), build)
+					}
+					if got := !configurations[0].GetObject("buildSettings").Has(prop); got != removed {
+						t.Errorf("%s %s removed = %v, want %v", target, build, got, removed)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHasDependencyCycle(t *testing.T) {
+	const uiTestsTargetKey = "046BD65B27EC518A0044E784"
+	tests := []struct {
+		name  string
+		edges [][2]string
+		want  []string
+	}{
+		// both test targets depend on DWebBrowser already
+		{"example", nil, nil},
+		{"acyclic", [][2]string{{uiTestsTargetKey, exampleTestsTargetKey}}, nil},
+		{"two targets", [][2]string{{exampleAppTargetKey, exampleTestsTargetKey}},
+			[]string{"DWebBrowser", "DWebBrowserTests", "DWebBrowser"}},
+		{"ui tests", [][2]string{{exampleAppTargetKey, uiTestsTargetKey}},
+			[]string{"DWebBrowser", "DWebBrowserUITests", "DWebBrowser"}},
+		{"self", [][2]string{{exampleTestsTargetKey, exampleTestsTargetKey}},
+			[]string{"DWebBrowserTests", "DWebBrowserTests"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			for _, edge := range tt.edges {
+				p.AddTargetDependency(edge[0], []string{edge[1]})
+			}
+			got, ok := reparse(t, p).HasDependencyCycle()
+			if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("HasDependencyCycle() = %v, %v, want %v, %v", got, ok, tt.want, tt.want != nil)
+			}
+		})
+	}
+}
+
+func TestAddFileAuto(t *testing.T) {
+	tests := []struct {
+		path      string
+		options   PbxFileOptions
+		wantPhase string
+	}{
+		{"Foo.swift", PbxFileOptions{}, "Sources"},
+		{"Foo.m", PbxFileOptions{}, "Sources"},
+		{"Foo.h", PbxFileOptions{}, ""},
+		{"Kit.framework", PbxFileOptions{Link: true, CustomFramework: true}, "Frameworks"},
+		{"libz.tbd", PbxFileOptions{Link: true}, "Frameworks"},
+		{"Media.xcassets", PbxFileOptions{}, "Resources"},
+		{"Main.storyboard", PbxFileOptions{}, "Resources"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p := loadExampleProject(t)
+			pbxfile, err := p.AddFileAuto(tt.path, "046BD63E27EC51880044E784", tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pbxfile == nil || pbxfile.Basename != tt.path {
+				t.Fatalf("AddFileAuto(%q) = %+v, want the added file", tt.path, pbxfile)
+			}
+			p = reparse(t, p)
+
+			phases := []string{}
+			for phase, obj := range map[string]pegparser.Object{
+				"Sources":    p.pbxSourcesBuildPhaseObj(exampleAppTargetKey),
+				"Frameworks": p.pbxFrameworksBuildPhaseObj(exampleAppTargetKey),
+				"Resources":  p.pbxResourcesBuildPhaseObj(exampleAppTargetKey),
+			} {
+				for _, buildFileKey := range listValues(obj, "files") {
+					if p.pbxBuildFileSection.GetObject(buildFileKey).GetString("fileRef") == pbxfile.FileRef {
+						phases = append(phases, phase)
+					}
+				}
+			}
+			want := []string{}
+			if tt.wantPhase != "" {
+				want = append(want, tt.wantPhase)
+			}
+			if !reflect.DeepEqual(phases, want) {
+				t.Errorf("%s is in the phases %v, want %v", tt.path, phases, want)
+			}
+		})
+	}
+}
+
+func TestPlistFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		add  func(p *PbxProject) error
+		want []string
+	}{
+		{"example", func(p *PbxProject) error { return nil }, []string{"Info.plist"}},
+		{"added", func(p *PbxProject) error {
+			return p.AddResourceFile("Widget/Info.plist", PbxFileOptions{}, "046BD63E27EC51880044E784")
+		}, []string{"Info.plist", "Widget/Info.plist"}},
+		{"other types", func(p *PbxProject) error {
+			return p.AddResourceFile("Data.json", PbxFileOptions{}, "046BD63E27EC51880044E784")
+		}, []string{"Info.plist"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := tt.add(p); err != nil {
+				t.Fatal(err)
+			}
+			if got := reparse(t, p).PlistFiles(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PlistFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	p := loadExampleProjectWith(t, "lastKnownFileType = text.plist.xml; path = Info.plist;", "explicitFileType = text.plist.xml; path = Info.plist;")
+	if got := p.PlistFiles(); !reflect.DeepEqual(got, []string{"Info.plist"}) {
+		t.Errorf("PlistFiles() = %v, want the plist with an explicit file type", got)
+	}
+}
+
+func TestAddFileWithSourceTree(t *testing.T) {
+	tests := []struct {
+		name       string
+		add        func(p *PbxProject, options PbxFileOptions) error
+		path       string
+		sourceTree string
+		want       string
+	}{
+		{"source root", func(p *PbxProject, options PbxFileOptions) error {
+			return p.AddSourceFile("Gen/Version.swift", options, "046BD63E27EC51880044E784")
+		}, "Gen/Version.swift", "SOURCE_ROOT", "SOURCE_ROOT"},
+		{"sdk root", func(p *PbxProject, options PbxFileOptions) error {
+			return p.AddResourceFile("Data.json", options, "046BD63E27EC51880044E784")
+		}, "Data.json", "SDKROOT", "SDKROOT"},
+		{"group", func(p *PbxProject, options PbxFileOptions) error {
+			return p.AddResourceFile("Data.json", options, "046BD63E27EC51880044E784")
+		}, "Data.json", "<group>", `"<group>"`},
+		{"default", func(p *PbxProject, options PbxFileOptions) error {
+			return p.AddSourceFile("Version.swift", options, "046BD63E27EC51880044E784")
+		}, "Version.swift", "", `"<group>"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := tt.add(p, PbxFileOptions{SourceTree: tt.sourceTree}); err != nil {
+				t.Fatal(err)
+			}
+			fileReference, ok := reparse(t, p).FileReferenceByPath(tt.path)
+			if !ok {
+				t.Fatalf("no file reference to %s", tt.path)
+			}
+			if got := fileReference.GetString("sourceTree"); got != tt.want {
+				t.Errorf("sourceTree = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildConfigurations(t *testing.T) {
+	tests := []struct {
+		target  string
+		setting string
+		want    map[string]string
+	}{
+		{"DWebBrowser", "PRODUCT_BUNDLE_IDENTIFIER", map[string]string{
+			"Debug":   "com.bngl.BFChain.DWebBrowser",
+			"Release": "com.bngl.BFChain.DWebBrowser",
+		}},
+		{"DWebBrowserTests", "PRODUCT_BUNDLE_IDENTIFIER", map[string]string{
+			"Debug":   "com.bngl.BFChain.DWebBrowserTests",
+			"Release": "com.bngl.BFChain.DWebBrowserTests",
+		}},
+		{"", "SWIFT_OPTIMIZATION_LEVEL", map[string]string{
+			"Debug":   "-Onone",
+			"Release": "-O",
+		}},
+		{"Missing", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			p := loadExampleProject(t)
+			configs := p.BuildConfigurations(tt.target)
+			if len(configs) != len(tt.want) {
+				t.Fatalf("BuildConfigurations(%q) = %d configurations, want %d", tt.target, len(configs), len(tt.want))
+			}
+			for i, name := range []string{"Debug", "Release"}[:len(configs)] {
+				if configs[i].Name != name {
+					t.Errorf("configs[%d].Name = %q, want %q", i, configs[i].Name, name)
+				}
+				if got := unquoted(configs[i].BuildSettings.GetString(tt.setting)); got != tt.want[name] {
+					t.Errorf("%s %s = %q, want %q", name, tt.setting, got, tt.want[name])
+				}
+			}
+
+			// the settings are copies
+			for _, config := range configs {
+				config.BuildSettings.Set("CHANGED", "YES")
+			}
+			for _, config := range p.BuildConfigurations(tt.target) {
+				if config.BuildSettings.Has("CHANGED") {
+					t.Errorf("changing the %s copy changed the project", config.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestAddCopyfileWithAttributes(t *testing.T) {
+	tests := []struct {
+		path       string
+		attributes []string
+	}{
+		{"Kit.h", []string{"RemoveHeadersOnCopy"}},
+		{"Kit.framework", []string{"CodeSignOnCopy", "RemoveHeadersOnCopy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p := loadExampleProject(t)
+			options := PbxFileOptions{Destination: "frameworks", Target: exampleAppTargetKey, Attributes: tt.attributes}
+			if err := p.AddCopyfile(tt.path, options); err != nil {
+				t.Fatal(err)
+			}
+			p = reparse(t, p)
+
+			files := listValues(p.buildPhaseObject("PBXCopyFilesBuildPhase", "Copy Files (frameworks)", exampleAppTargetKey), "files")
+			if len(files) != 1 {
+				t.Fatalf("Copy Files files = %v, want one", files)
+			}
+			settings := p.pbxBuildFileSection.GetObject(files[0]).GetObject("settings")
+			if got := listValues(settings, "ATTRIBUTES"); !reflect.DeepEqual(got, tt.attributes) {
+				t.Errorf("ATTRIBUTES = %v, want %v", got, tt.attributes)
+			}
+		})
+	}
+}
+
+func TestProductPath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"DWebBrowser", "DWebBrowser.app"},
+		{exampleAppTargetKey, "DWebBrowser.app"},
+		{"DWebBrowserTests", "DWebBrowserTests.xctest"},
+		{exampleTestsTargetKey, "DWebBrowserTests.xctest"},
+		{"Missing", ""},
+	}
+	p := loadExampleProject(t)
+	for _, tt := range tests {
+		if got := p.ProductPath(tt.target); got != tt.want {
+			t.Errorf("ProductPath(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestSetBaseConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		build   string
+		wantErr bool
+	}{
+		{"debug", "DWebBrowser", "Debug", false},
+		{"release of tests", "DWebBrowserTests", "Release", false},
+		{"missing configuration", "DWebBrowser", "Profile", true},
+		{"missing target", "Missing", "Debug", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			err := p.SetBaseConfiguration(tt.target, tt.build, "Config/Base.xcconfig")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetBaseConfiguration error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, ok := p.FileReferenceByPath("Config/Base.xcconfig"); ok {
+					t.Error("the xcconfig file was added")
+				}
+				return
+			}
+			// a second configuration shares the file reference
+			if err := p.SetBaseConfiguration("DWebBrowserUITests", tt.build, "Config/Base.xcconfig"); err != nil {
+				t.Fatal(err)
+			}
+			p = reparse(t, p)
+
+			fileReference, ok := p.FileReferenceByPath("Config/Base.xcconfig")
+			if !ok {
+				t.Fatal("no file reference to the xcconfig file")
+			}
+			if got := fileReference.GetString("lastKnownFileType"); got != "text.xcconfig" {
+				t.Errorf("lastKnownFileType = %s, want text.xcconfig", got)
+			}
+			for _, target := range []string{tt.target, "DWebBrowserUITests"} {
+				for _, build := range []string{"Debug", "Release"} {
+					configuration := p.buildConfigurations(build, target)[0]
+					want := ""
+					if build == tt.build {
+						want = fileReference.UUID
+					}
+					if got := configuration.GetString("baseConfigurationReference"); got != want {
+						t.Errorf("%s %s baseConfigurationReference = %q, want %q", target, build, got, want)
+					}
+					if want == "" {
+						continue
+					}
+					if got := configuration.GetString(toCommentKey("baseConfigurationReference")); got != "Base.xcconfig" {
+						t.Errorf("%s %s comment = %q, want Base.xcconfig", target, build, got)
+					}
+					if got := configuration.IndexOf("baseConfigurationReference"); got != configuration.IndexOf("isa")+1 {
+						t.Errorf("%s %s baseConfigurationReference is not written after isa", target, build)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFileReferenceByPath(t *testing.T) {
+	p := loadExampleProjectWith(t, "path = ViewController.swift;", `path = "View Controller.swift";`)
+	tests := []struct {
+		path   string
+		want   string
+		wantOk bool
+	}{
+		{"AppDelegate.swift", "046BD63F27EC51880044E784", true},
+		{`"AppDelegate.swift"`, "046BD63F27EC51880044E784", true},
+		{"Base.lproj/Main.storyboard", "046BD64627EC51880044E784", true},
+		{"View Controller.swift", "046BD64327EC51880044E784", true},
+		{"Base", "", false},
+		{"Missing.swift", "", false},
+	}
+	for _, tt := range tests {
+		ref, ok := p.FileReferenceByPath(tt.path)
+		if ok != tt.wantOk || ref.UUID != tt.want {
+			t.Errorf("FileReferenceByPath(%s) = %s, %v, want %s, %v", tt.path, ref.UUID, ok, tt.want, tt.wantOk)
+		}
+		if ok && unquoted(ref.GetString("path")) != unquoted(tt.path) {
+			t.Errorf("FileReferenceByPath(%s) path = %s", tt.path, ref.GetString("path"))
+		}
+	}
+}
+
+func TestRemoveFileByUUID(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		add  func(p *PbxProject) error
+		// AddFramework creates a Frameworks group, which stays
+		keepsGroup bool
+	}{
+		{"source", "Extra.swift", func(p *PbxProject) error {
+			return p.AddSourceFile("Extra.swift", PbxFileOptions{}, "046BD63E27EC51880044E784")
+		}, false},
+		{"resource", "Extra.json", func(p *PbxProject) error {
+			return p.AddResourceFile("Extra.json", PbxFileOptions{}, "046BD63E27EC51880044E784")
+		}, false},
+		{"framework", "System/Library/Frameworks/CoreNFC.framework", func(p *PbxProject) error {
+			return p.AddFramework("CoreNFC.framework", PbxFileOptions{Link: true})
+		}, true},
+		{"quoted path", "My Extra.swift", func(p *PbxProject) error {
+			return p.AddSourceFile("My Extra.swift", PbxFileOptions{}, "046BD63E27EC51880044E784")
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			want := string(NewPbxWriter(p).Bytes())
+			if err := tt.add(p); err != nil {
+				t.Fatal(err)
+			}
+			fileReference, ok := p.FileReferenceByPath(tt.path)
+			if !ok {
+				t.Fatalf("no file reference to %s", tt.path)
+			}
+
+			buildFiles := []string{}
+			p.pbxBuildFileSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+				if value.(pegparser.Object).GetString("fileRef") == fileReference.UUID {
+					buildFiles = append(buildFiles, key)
+				}
+				return pegparser.IterateActionContinue
+			}, nonCommentsFilter)
+			if len(buildFiles) == 0 {
+				t.Fatalf("no build file for %s", tt.path)
+			}
+
+			if err := p.RemoveFileByUUID(fileReference.UUID); err != nil {
+				t.Fatal(err)
+			}
+			got := string(NewPbxWriter(p).Bytes())
+			for _, key := range append(buildFiles, fileReference.UUID) {
+				if strings.Contains(got, key) {
+					t.Errorf("output still mentions %s", key)
+				}
+			}
+			if !tt.keepsGroup && got != want {
+				t.Errorf("output after removing %s differs from the example project", tt.path)
+			}
+			if p.hasFile(tt.path) {
+				t.Errorf("%s is still known", tt.path)
+			}
+			if err := p.RemoveFileByUUID(fileReference.UUID); err == nil {
+				t.Error("removing the file twice succeeded")
+			}
+		})
+	}
+}
+
+func TestHasScannedForEncodings(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		set     func(p *PbxProject)
+		want    bool
+		written string
+	}{
+		{"round trip 0", "0", func(p *PbxProject) {}, false, "hasScannedForEncodings = 0;"},
+		{"round trip 1", "1", func(p *PbxProject) {}, true, "hasScannedForEncodings = 1;"},
+		{"set", "0", func(p *PbxProject) { p.SetHasScannedForEncodings(true) }, true, "hasScannedForEncodings = 1;"},
+		{"clear", "1", func(p *PbxProject) { p.SetHasScannedForEncodings(false) }, false, "hasScannedForEncodings = 0;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProjectWith(t, "hasScannedForEncodings = 0;", "hasScannedForEncodings = "+tt.value+";")
+			tt.set(p)
+			data := string(NewPbxWriter(p).Bytes())
+			if !strings.Contains(data, "\t\t\t"+tt.written+"\n\t\t\tknownRegions = (") {
+				t.Errorf("output lacks %s in its place", tt.written)
+			}
+			if got := reparse(t, p).HasScannedForEncodings(); got != tt.want {
+				t.Errorf("HasScannedForEncodings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// countCommentKeys counts the *_comment keys of decoded JSON.
+func countCommentKeys(value interface{}) int {
+	count := 0
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if strings.HasSuffix(key, "_comment") {
+				count++
+			}
+			count += countCommentKeys(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			count += countCommentKeys(child)
+		}
+	}
+	return count
+}
+
+func TestDumpClean(t *testing.T) {
+	p := loadExampleProject(t)
+	tests := []struct {
+		name         string
+		dump         func(w io.Writer) error
+		wantComments bool
+	}{
+		{"dump", p.Dump, true},
+		{"clean", p.DumpClean, false},
+		// DumpClean works on a copy
+		{"dump after clean", p.Dump, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.dump(&buf); err != nil {
+				t.Fatal(err)
+			}
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if got := countCommentKeys(decoded) > 0; got != tt.wantComments {
+				t.Errorf("has _comment keys = %v, want %v", got, tt.wantComments)
+			}
+			objects := decoded["project"].(map[string]interface{})["objects"].(map[string]interface{})
+			if _, ok := objects["PBXNativeTarget"].(map[string]interface{})[exampleAppTargetKey]; !ok {
+				t.Error("the app target is missing")
+			}
+		})
+	}
+}
+
+func TestProjectWithoutTargets(t *testing.T) {
+	prepares := []struct {
+		name    string
+		prepare func(p *PbxProject)
+	}{
+		{"empty targets", func(p *PbxProject) { p.getFirstProject().Object.Set("targets", []interface{}{}) }},
+		{"no targets key", func(p *PbxProject) { p.getFirstProject().Object.Delete("targets") }},
+	}
+	calls := []struct {
+		name string
+		call func(p *PbxProject) error
+	}{
+		{"getFirstTarget", func(p *PbxProject) error {
+			if _, ok := p.getFirstTarget(); ok {
+				return errors.New("found a first target")
+			}
+			return nil
+		}},
+		{"AddTarget", func(p *PbxProject) error {
+			_ = p.AddTarget("Share", "app_extension", "Share", "")
+			return nil
+		}},
+		{"AddBuildPhase", func(p *PbxProject) error {
+			_ = p.AddBuildPhase([]string{}, "PBXResourcesBuildPhase", "Resources", "", nil, "")
+			return nil
+		}},
+		{"AddSourceFile", func(p *PbxProject) error {
+			_ = p.AddSourceFile("Extra.swift", PbxFileOptions{}, "046BD63E27EC51880044E784")
+			return nil
+		}},
+		{"write", func(p *PbxProject) error {
+			NewPbxWriter(p).Bytes()
+			return nil
+		}},
+	}
+	for _, prepare := range prepares {
+		for _, call := range calls {
+			t.Run(prepare.name+"/"+call.name, func(t *testing.T) {
+				p := loadExampleProject(t)
+				prepare.prepare(p)
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("%s panicked: %v", call.name, r)
+					}
+				}()
+				if err := call.call(p); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+func TestAddUnitTestTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		add     func(p *PbxProject) error
+		wantErr bool
+	}{
+		{"host name", func(p *PbxProject) error {
+			return p.AddUnitTestTarget("HostTests", "DWebBrowser", "", "")
+		}, false},
+		{"host uuid", func(p *PbxProject) error {
+			return p.AddUnitTestTarget("HostTests", exampleAppTargetKey, "", "")
+		}, false},
+		{"AddTarget", func(p *PbxProject) error {
+			return p.AddTarget("HostTests", "unit_test_bundle", "", "")
+		}, false},
+		{"missing host", func(p *PbxProject) error {
+			return p.AddUnitTestTarget("HostTests", "Missing", "", "")
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := tt.add(p); (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if p.findTargetKey("HostTests") != "" {
+					t.Error("the target was added")
+				}
+				return
+			}
+			p = reparse(t, p)
+
+			for _, config := range p.BuildConfigurations("HostTests") {
+				if got := config.BuildSettings.GetString("TEST_HOST"); got != `"$(BUILT_PRODUCTS_DIR)/DWebBrowser.app/DWebBrowser"` {
+					t.Errorf("%s TEST_HOST = %s", config.Name, got)
+				}
+				if got := config.BuildSettings.GetString("BUNDLE_LOADER"); got != `"$(TEST_HOST)"` {
+					t.Errorf("%s BUNDLE_LOADER = %s, want \"$(TEST_HOST)\"", config.Name, got)
+				}
+			}
+			target := p.pbxNativeTargetSection.GetObject(p.findTargetKey("HostTests"))
+			dependencies := listValues(target, "dependencies")
+			if len(dependencies) != 1 {
+				t.Fatalf("dependencies = %v, want the host", dependencies)
+			}
+			if got := p.pbxTargetDependencySection.GetObject(dependencies[0]).GetString("target"); got != exampleAppTargetKey {
+				t.Errorf("dependency target = %s, want %s", got, exampleAppTargetKey)
+			}
+		})
+	}
+}
+
+func TestResolveMacros(t *testing.T) {
+	path := writeFixture(t, t.TempDir(), "App.xcodeproj/project.pbxproj", readExampleProject(t))
+	p := loadProject(t, path)
+	for _, configuration := range p.projectBuildConfigurations() {
+		buildSettings := configuration.GetObject("buildSettings")
+		buildSettings.Set("CONFIG_DIR", `"$(SRCROOT)/Config"`)
+		buildSettings.Set("CONFIG_FILE", `"$(CONFIG_DIR)/$(PROJECT_NAME).xcconfig"`)
+		buildSettings.Set("LOOP", `"$(LOOP)x"`)
+	}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"$(SRCROOT)/foo", "/src/foo"},
+		{"${SRCROOT}/foo", "/src/foo"},
+		{`"$(PROJECT_DIR)/My Dir"`, "/src/My Dir"},
+		{"$(SOURCE_ROOT)/$(PROJECT_NAME)/Info.plist", "/src/App/Info.plist"},
+		{"$(CONFIG_DIR)/Debug.xcconfig", "/src/Config/Debug.xcconfig"},
+		{"$(CONFIG_FILE)", "/src/Config/App.xcconfig"},
+		{"$(SDKROOT)", "iphoneos"},
+		{"$(inherited) $(SRCROOT)", "$(inherited) /src"},
+		{"plain/path", "plain/path"},
+	}
+	for _, tt := range tests {
+		if got := p.ResolveMacros(tt.value, "/src"); got != tt.want {
+			t.Errorf("ResolveMacros(%s) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+	// a self reference stops expanding
+	if got := p.ResolveMacros("$(LOOP)", "/src"); !strings.HasPrefix(got, "$(LOOP)x") {
+		t.Errorf("ResolveMacros($(LOOP)) = %q", got)
+	}
+}
+
+// projectSection returns the written PBXProject section.
+func projectSection(t *testing.T, p *PbxProject) string {
+	t.Helper()
+	data := string(NewPbxWriter(p).Bytes())
+	begin := strings.Index(data, "/* Begin PBXProject section */")
+	end := strings.Index(data, "/* End PBXProject section */")
+	if begin < 0 || end < begin {
+		t.Fatal("no PBXProject section")
+	}
+	return data[begin:end]
+}
+
+func TestSetDevelopmentRegion(t *testing.T) {
+	tests := []struct {
+		region      string
+		want        string
+		wantRegions []string
+	}{
+		{"fr", "developmentRegion = fr;", []string{"en", "Base", "fr"}},
+		{"zh-Hans", `developmentRegion = "zh-Hans";`, []string{"en", "Base", `"zh-Hans"`}},
+		{"en", "developmentRegion = en;", []string{"en", "Base"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			p := loadExampleProject(t)
+			p.SetDevelopmentRegion(tt.region)
+			if section := projectSection(t, p); !strings.Contains(section, "\t\t\t"+tt.want+"\n") {
+				t.Errorf("PBXProject section lacks %s", tt.want)
+			}
+			project := reparse(t, p).getFirstProject().Object
+			if got := listValues(project, "knownRegions"); !reflect.DeepEqual(got, tt.wantRegions) {
+				t.Errorf("knownRegions = %v, want %v", got, tt.wantRegions)
+			}
+		})
+	}
+}
+
+func TestSetOrganizationName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Acme", "ORGANIZATIONNAME = Acme;"},
+		{"Acme Inc.", `ORGANIZATIONNAME = "Acme Inc.";`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			p.SetOrganizationName("Old")
+			p.SetOrganizationName(tt.name)
+			section := projectSection(t, p)
+			if !strings.Contains(section, "\t\t\t\t"+tt.want+"\n") {
+				t.Errorf("PBXProject attributes lack %s", tt.want)
+			}
+			if strings.Count(section, "ORGANIZATIONNAME") != 1 {
+				t.Error("ORGANIZATIONNAME is written more than once")
+			}
+			if got := unquoted(reparse(t, p).ProjectAttributes().GetString("ORGANIZATIONNAME")); got != tt.name {
+				t.Errorf("ORGANIZATIONNAME = %q, want %q", got, tt.name)
+			}
+		})
+	}
+}
+
+func TestTargetDependencies(t *testing.T) {
+	const uiTestsTargetKey = "046BD65B27EC518A0044E784"
+	tests := []struct {
+		name   string
+		target string
+		add    []string
+		edit   []string
+		want   []string
+	}{
+		{"one", "DWebBrowserTests", nil, nil, []string{"DWebBrowser"}},
+		{"two", "DWebBrowserUITests", []string{exampleTestsTargetKey}, nil, []string{"DWebBrowser", "DWebBrowserTests"}},
+		{"by uuid", uiTestsTargetKey, []string{exampleTestsTargetKey}, nil, []string{"DWebBrowser", "DWebBrowserTests"}},
+		{"none", "DWebBrowser", nil, nil, []string{}},
+		{"missing target", "Missing", nil, nil, []string{}},
+		// a target of another project is only known by its proxy
+		{"remote", "DWebBrowserTests", nil, []string{
+			"\t\t\ttarget = 046BD63B27EC51880044E784 /* DWebBrowser */;\n\t\t\ttargetProxy = 046BD65327EC518A0044E784", "\t\t\ttargetProxy = 046BD65327EC518A0044E784",
+		}, []string{"DWebBrowser"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProjectWith(t, tt.edit...)
+			if tt.add != nil {
+				p.AddTargetDependency(p.resolveTargetKey(tt.target), tt.add)
+			}
+			if got := reparse(t, p).TargetDependencies(tt.target); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TargetDependencies(%s) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnableLocalization(t *testing.T) {
+	tests := []struct {
+		name        string
+		edit        []string
+		locales     []string
+		wantRegions []string
+		wantRegion  string
+	}{
+		{"en and fr", nil, []string{"en", "fr"}, []string{"en", "Base", "fr"}, "en"},
+		{"quoted locale", nil, []string{"zh-Hans"}, []string{"en", "Base", `"zh-Hans"`}, "en"},
+		{"no regions", []string{"knownRegions = (\n\t\t\t\ten,\n\t\t\t\tBase,\n\t\t\t);", "knownRegions = (\n\t\t\t);",
+			"developmentRegion = en;\n", ""}, []string{"fr", "de"}, []string{"Base", "fr", "de"}, "fr"},
+		{"no locales", []string{"developmentRegion = en;\n", ""}, nil, []string{"en", "Base"}, "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProjectWith(t, tt.edit...)
+			p.EnableLocalization(tt.locales)
+			p.EnableLocalization(tt.locales)
+			project := reparse(t, p).getFirstProject().Object
+			if got := listValues(project, "knownRegions"); !reflect.DeepEqual(got, tt.wantRegions) {
+				t.Errorf("knownRegions = %v, want %v", got, tt.wantRegions)
+			}
+			if got := unquoted(project.GetString("developmentRegion")); got != tt.wantRegion {
+				t.Errorf("developmentRegion = %q, want %q", got, tt.wantRegion)
+			}
+		})
+	}
+}
+
+func TestRemovePhaseFileByPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		target  string
+		phase   string
+		wantErr bool
+	}{
+		{"detected as a resource", "Extra.json", "DWebBrowser", "Sources", false},
+		{"any phase", "Extra.json", exampleAppTargetKey, "", false},
+		{"existing source", "AppDelegate.swift", "DWebBrowser", "Sources", false},
+		{"other phase", "Extra.json", "DWebBrowser", "Resources", true},
+		{"other target", "Extra.json", "DWebBrowserTests", "", true},
+		{"missing target", "Extra.json", "Missing", "", true},
+		{"missing file", "Missing.swift", "DWebBrowser", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			// a JSON file compiled as a source, its build file is not commented "in Resources"
+			if err := p.AddSourceFile("Extra.json", PbxFileOptions{}, "046BD63E27EC51880044E784"); err != nil {
+				t.Fatal(err)
+			}
+			before := string(NewPbxWriter(p).Bytes())
+			err := p.RemovePhaseFileByPath(tt.path, tt.target, tt.phase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RemovePhaseFileByPath error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if after := string(NewPbxWriter(p).Bytes()); after != before {
+					t.Error("failed RemovePhaseFileByPath changed the project")
+				}
+				return
+			}
+
+			p = reparse(t, p)
+			fileReference, ok := p.FileReferenceByPath(tt.path)
+			if !ok {
+				t.Fatalf("the file reference to %s was removed", tt.path)
+			}
+			for _, buildFileKey := range listValues(p.pbxSourcesBuildPhaseObj(exampleAppTargetKey), "files") {
+				if p.pbxBuildFileSection.GetObject(buildFileKey).GetString("fileRef") == fileReference.UUID {
+					t.Errorf("%s is still in the Sources phase", tt.path)
+				}
+			}
+			p.pbxBuildFileSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+				if value.(pegparser.Object).GetString("fileRef") == fileReference.UUID {
+					t.Errorf("build file %s of %s is left", key, tt.path)
+				}
+				return pegparser.IterateActionContinue
+			}, nonCommentsFilter)
+		})
+	}
+}
+
+func TestRemoveTargetDependency(t *testing.T) {
+	p := loadExampleProject(t)
+	want := string(NewPbxWriter(p).Bytes())
+	p.AddTargetDependency(exampleAppTargetKey, []string{exampleTestsTargetKey})
+	p = reparse(t, p)
+	dependencies := listValues(p.pbxNativeTargetSection.GetObject(exampleAppTargetKey), "dependencies")
+	if len(dependencies) != 1 {
+		t.Fatalf("dependencies = %v, want one", dependencies)
+	}
+	proxy := p.pbxTargetDependencySection.GetObject(dependencies[0]).GetString("targetProxy")
+
+	tests := []struct {
+		name         string
+		target       string
+		dependencies []string
+		wantErr      bool
+	}{
+		{"missing target", "Missing", []string{"DWebBrowserTests"}, true},
+		{"missing dependency", "DWebBrowser", []string{"Missing"}, true},
+		{"not a dependency", "DWebBrowser", []string{"DWebBrowserUITests"}, false},
+		{"dependency", "DWebBrowser", []string{"DWebBrowserTests"}, false},
+		{"again", "DWebBrowser", []string{exampleTestsTargetKey}, false},
+	}
+	for _, tt := range tests {
+		if err := p.RemoveTargetDependency(tt.target, tt.dependencies); (err != nil) != tt.wantErr {
+			t.Errorf("%s: RemoveTargetDependency error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	if p.pbxTargetDependencySection.Has(dependencies[0]) || p.pbxContainerItemProxySection.Has(proxy) {
+		t.Error("the PBXTargetDependency or PBXContainerItemProxy is left")
+	}
+	if got := string(NewPbxWriter(p).Bytes()); got != want {
+		t.Error("output differs from the example project")
+	}
+	if got := p.TargetDependencies("DWebBrowserTests"); !reflect.DeepEqual(got, []string{"DWebBrowser"}) {
+		t.Errorf("DWebBrowserTests dependencies = %v, want them kept", got)
+	}
+}
+
+func TestCopyFilesDstPathQuoting(t *testing.T) {
+	tests := []struct {
+		name string
+		add  func(p *PbxProject) error
+		want string
+	}{
+		{"watch app", func(p *PbxProject) error {
+			return p.AddTarget("Watch", "watch2_app", "Watch", "")
+		}, `dstPath = "$(CONTENTS_FOLDER_PATH)/Watch";`},
+		{"quoted macro", func(p *PbxProject) error {
+			return p.AddBuildPhase([]string{}, "PBXCopyFilesBuildPhase", "Embed Watch Content", exampleAppTargetKey, "watch2_app", `"$(CONTENTS_FOLDER_PATH)/Watch"`)
+		}, `dstPath = "$(CONTENTS_FOLDER_PATH)/Watch";`},
+		{"plain", func(p *PbxProject) error {
+			return p.AddBuildPhase([]string{}, "PBXCopyFilesBuildPhase", "Embed Watch Content", exampleAppTargetKey, "watch2_app", "Watch")
+		}, `dstPath = Watch;`},
+		{"empty", func(p *PbxProject) error {
+			return p.AddBuildPhase([]string{}, "PBXCopyFilesBuildPhase", "Embed Watch Content", exampleAppTargetKey, "watch2_app", "")
+		}, `dstPath = "";`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := tt.add(p); err != nil {
+				t.Fatal(err)
+			}
+			phase := p.buildPhaseObject("PBXCopyFilesBuildPhase", "Embed Watch Content", exampleAppTargetKey)
+			if phase.IsEmpty() {
+				t.Fatal("no Embed Watch Content phase")
+			}
+			if data := string(NewPbxWriter(p).Bytes()); !strings.Contains(data, "\t\t\t"+tt.want+"\n") {
+				t.Errorf("output lacks %s", tt.want)
+			}
+		})
+	}
+}
+
+func TestFileReferenceName(t *testing.T) {
+	// written by Xcode
+	const xcode = `/* CustomFileManager.swift */ = {isa = PBXFileReference; fileEncoding = 4; lastKnownFileType = sourcecode.swift; path = CustomFileManager.swift; sourceTree = "<group>"; };`
+	if !strings.Contains(string(readExampleProject(t)), xcode) {
+		t.Fatal("the example project lacks the Xcode file reference")
+	}
+	tests := []struct {
+		name string
+		add  func(p *PbxProject) error
+		want string
+	}{
+		{"name is the path", func(p *PbxProject) error {
+			return p.AddSourceFile("Extra.swift", PbxFileOptions{}, "046BD63E27EC51880044E784")
+		}, strings.ReplaceAll(xcode, "CustomFileManager", "Extra")},
+		{"name is the last path component", func(p *PbxProject) error {
+			return p.AddSourceFile("Sub/Extra.swift", PbxFileOptions{}, "046BD63E27EC51880044E784")
+		}, `/* Extra.swift */ = {isa = PBXFileReference; fileEncoding = 4; lastKnownFileType = sourcecode.swift; path = Sub/Extra.swift; sourceTree = "<group>"; };`},
+		{"name differs", func(p *PbxProject) error {
+			p.AddLocalizationVariantGroup("Localizable.strings")
+			_, err := p.AddToLocalizationVariantGroup("Localizable.strings", "fr", "fr.lproj/Localizable.strings")
+			return err
+		}, "name = fr;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := tt.add(p); err != nil {
+				t.Fatal(err)
+			}
+			data := string(NewPbxWriter(reparse(t, p)).Bytes())
+			if !strings.Contains(data, tt.want) {
+				t.Errorf("output lacks %s", tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPbxFileReferenceObj(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		options PbxFileOptions
+		want    map[string]interface{}
+		absent  []string
+	}{
+		{"source file", "Extra.swift", PbxFileOptions{},
+			map[string]interface{}{"lastKnownFileType": "sourcecode.swift", "fileEncoding": 4},
+			[]string{"explicitFileType", "includeInIndex", "name"}},
+		{"indexed source file", "Extra.swift", PbxFileOptions{IncludeInIndex: 1},
+			map[string]interface{}{"includeInIndex": 1},
+			[]string{"explicitFileType"}},
+		{"product", "Extra", PbxFileOptions{ExplicitFileType: "wrapper.application"},
+			map[string]interface{}{"explicitFileType": "wrapper.application", "includeInIndex": 0},
+			[]string{"lastKnownFileType"}},
+		{"explicit last known type", "Extra.swift", PbxFileOptions{LastKnownFileType: "text"},
+			map[string]interface{}{"lastKnownFileType": "text"},
+			[]string{"explicitFileType", "includeInIndex"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newPbxFileReferenceObj(newPbxFile(tt.path, tt.options))
+			for key, value := range tt.want {
+				if got := obj.ForceGet(key); got != value {
+					t.Errorf("%s = %#v, want %#v", key, got, value)
+				}
+			}
+			for _, key := range tt.absent {
+				if obj.Has(key) {
+					t.Errorf("%s = %#v, want it omitted", key, obj.ForceGet(key))
+				}
+			}
+		})
+	}
+}
+
+func TestHeadComment(t *testing.T) {
+	tests := []struct {
+		name    string
+		comment string
+		want    string
+	}{
+		{"unchanged", "", "// !$*UTF8*$!\n{"},
+		{"custom", "!$*UTF8*$! generated", "// !$*UTF8*$! generated\n{"},
+		{"marker", "!$*UTF8*$!", "// !$*UTF8*$!\n{"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if got := p.HeadComment(); got != "!$*UTF8*$!" {
+				t.Fatalf("HeadComment() = %q, want the UTF8 marker", got)
+			}
+			if tt.comment != "" {
+				p.SetHeadComment(tt.comment)
+			}
+			data := string(NewPbxWriter(p).Bytes())
+			if !strings.HasPrefix(data, tt.want) {
+				t.Errorf("output starts with %q, want %q", data[:len(tt.want)], tt.want)
+			}
+			if got, want := reparse(t, p).HeadComment(), p.HeadComment(); got != want {
+				t.Errorf("reparsed HeadComment() = %q, want %q", got, want)
+			}
+		})
+	}
+
+	// nothing to set on a project that was never parsed
+	p := NewPbxProject("")
+	p.SetHeadComment("!$*UTF8*$!")
+	if got := p.HeadComment(); got != "" {
+		t.Errorf("HeadComment() = %q on an empty project", got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(p *PbxProject) error
+	}{
+		{"add source file", func(p *PbxProject) error {
+			return p.AddSourceFile("Extra.swift", PbxFileOptions{}, "046BD63E27EC51880044E784")
+		}},
+		{"remove source file", func(p *PbxProject) error {
+			return p.RemoveSourceFile("AppDelegate.swift", PbxFileOptions{}, "046BD63E27EC51880044E784")
+		}},
+		{"add build property", func(p *PbxProject) error {
+			p.AddBuildProperty("SWIFT_VERSION", "5.7", "")
+			return nil
+		}},
+		{"rename group", func(p *PbxProject) error {
+			return p.RenameGroup("DWebBrowser", "Browser")
+		}},
+		{"set head comment", func(p *PbxProject) error {
+			p.SetHeadComment("!$*UTF8*$! snapshot")
+			return nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			before := string(NewPbxWriter(p).Bytes())
+			uuids := len(p.uuids)
+
+			snapshot := p.Snapshot()
+			if got := string(NewPbxWriter(snapshot).Bytes()); got != before {
+				t.Fatal("the snapshot writes differently from the original")
+			}
+			if err := tt.mutate(snapshot); err != nil {
+				t.Fatal(err)
+			}
+			if string(NewPbxWriter(snapshot).Bytes()) == before {
+				t.Fatal("mutating the snapshot changed nothing")
+			}
+			if got := string(NewPbxWriter(p).Bytes()); got != before {
+				t.Error("mutating the snapshot changed the original")
+			}
+			if len(p.uuids) != uuids {
+				t.Errorf("original has %d uuids, want %d", len(p.uuids), uuids)
+			}
+		})
+	}
+
+	// an unparsed project snapshots to an empty one
+	empty := NewPbxProject("")
+	if snapshot := empty.Snapshot(); !snapshot.Contents().IsEmpty() {
+		t.Error("snapshot of an empty project has contents")
+	}
+}
+
+func TestCorrectForResourcesPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		groupName string
+		groupPath string
+		path      string
+		want      string
+	}{
+		{"group path", "Resources", "Resources", "Resources/foo.png", "foo.png"},
+		{"lowercase group path", "Resources", "resources", "Resources/foo.png", "foo.png"},
+		{"lowercase file path", "Resources", "Resources", "resources/foo.png", "foo.png"},
+		{"nested group path", "Resources", "App/Resources", "App/Resources/foo.png", "foo.png"},
+		{"quoted group path", "Resources", `"My Resources"`, "My Resources/foo.png", "foo.png"},
+		{"path differs from name", "Resources", "Assets", "Resources/foo.png", "Resources/foo.png"},
+		{"path differs from name matches", "Resources", "Assets", "Assets/foo.png", "foo.png"},
+		{"prefix only", "Resources", "Resources", "ResourcesExtra/foo.png", "ResourcesExtra/foo.png"},
+		{"group without path", "Resources", "", "Resources/foo.png", "Resources/foo.png"},
+		{"no group", "Other", "Resources", "Resources/foo.png", "Resources/foo.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			p.pbxCreateGroup(tt.groupName, tt.groupPath)
+			pbxfile := newPbxFile(tt.path, PbxFileOptions{})
+			if got := p.correctForResourcesPath(pbxfile).Path; got != tt.want {
+				t.Errorf("Path = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectsByISA(t *testing.T) {
+	tests := []struct {
+		isa  string
+		want int
+	}{
+		{"XCBuildConfiguration", 8},
+		{"XCConfigurationList", 4},
+		{"PBXNativeTarget", 3},
+		{"PBXProject", 1},
+		{"PBXFileReference", 22},
+		{"PBXUnknown", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.isa, func(t *testing.T) {
+			objects := loadExampleProject(t).ObjectsByISA(tt.isa)
+			if len(objects) != tt.want {
+				t.Fatalf("got %d objects, want %d", len(objects), tt.want)
+			}
+			for _, obj := range objects {
+				if isCommentKey(obj.UUID) || obj.GetString("isa") != tt.isa {
+					t.Errorf("%s = %v is not a %s", obj.UUID, obj.Object, tt.isa)
+				}
+			}
+		})
+	}
+
+	t.Run("outside its own section", func(t *testing.T) {
+		p := loadExampleProject(t)
+		p.pbxGroupSection.Set("AA0000000000000000000001", pegparser.NewObjectWithData([]pegparser.SliceItem{
+			pegparser.NewObjectItem("isa", "XCBuildConfiguration"),
+			pegparser.NewObjectItem("name", "Extra"),
+		}))
+		if got := len(p.ObjectsByISA("XCBuildConfiguration")); got != 9 {
+			t.Errorf("got %d objects, want 9", got)
+		}
+	})
+}
+
+// appDelegateResource also copies AppDelegate.swift, compiled in Sources, as a resource of the app.
+var appDelegateResource = []string{
+	"/* End PBXBuildFile section */",
+	"\t\tAA0000000000000000000001 /* AppDelegate.swift in Resources */ = {isa = PBXBuildFile; fileRef = 046BD63F27EC51880044E784 /* AppDelegate.swift */; };\n" +
+		"/* End PBXBuildFile section */",
+	"\t\t\t\t046BD64C27EC51890044E784 /* LaunchScreen.storyboard in Resources */,\n",
+	"\t\t\t\tAA0000000000000000000001 /* AppDelegate.swift in Resources */,\n" +
+		"\t\t\t\t046BD64C27EC51890044E784 /* LaunchScreen.storyboard in Resources */,\n",
+}
+
+func TestRemoveFileFromBuildPhase(t *testing.T) {
+	const (
+		sourcesBuildFile   = "046BD64027EC51880044E784"
+		resourcesBuildFile = "AA0000000000000000000001"
+	)
+	tests := []struct {
+		name          string
+		phase         string
+		wantErr       bool
+		wantSources   bool
+		wantResources bool
+	}{
+		{"resources", "Resources", false, true, false},
+		{"sources", "Sources", false, false, true},
+		{"not in phase", "Frameworks", true, true, true},
+		{"no phase", "", true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProjectWith(t, appDelegateResource...)
+			err := p.RemoveFileFromBuildPhase("AppDelegate.swift", tt.phase, "DWebBrowser")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RemoveFileFromBuildPhase error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			p = reparse(t, p)
+			phases := []struct {
+				phase     pegparser.Object
+				buildFile string
+				want      bool
+			}{
+				{p.pbxSourcesBuildPhaseObj(exampleAppTargetKey), sourcesBuildFile, tt.wantSources},
+				{p.pbxResourcesBuildPhaseObj(exampleAppTargetKey), resourcesBuildFile, tt.wantResources},
+			}
+			for _, phase := range phases {
+				if got := containsString(listValues(phase.phase, "files"), phase.buildFile); got != phase.want {
+					t.Errorf("%s in %s = %v, want %v", phase.buildFile, phase.phase.GetString("isa"), got, phase.want)
+				}
+				if got := p.pbxBuildFileSection.Has(phase.buildFile); got != phase.want {
+					t.Errorf("build file %s kept = %v, want %v", phase.buildFile, got, phase.want)
+				}
+			}
+			if _, ok := p.FileReferenceByPath("AppDelegate.swift"); !ok {
+				t.Error("the file reference was removed")
+			}
+		})
+	}
+}
+
+func TestAddCopyfileUuids(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		options PbxFileOptions
+	}{
+		{"new file", "Helper.xpc", PbxFileOptions{}},
+		{"new file to a destination", "Helper.xpc", PbxFileOptions{Destination: "xpc_services", Target: exampleAppTargetKey}},
+		{"existing file", "AppDelegate.swift", PbxFileOptions{Destination: "resources", Target: exampleAppTargetKey}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			before := map[string]bool{}
+			p.pbxBuildFileSection.ForeachWithFilter(func(key string, _ interface{}) pegparser.IterateActionType {
+				before[key] = true
+				return pegparser.IterateActionContinue
+			}, nonCommentsFilter)
+			if err := p.AddCopyfile(tt.path, tt.options); err != nil {
+				t.Fatal(err)
+			}
+
+			added := []string{}
+			p.pbxBuildFileSection.ForeachWithFilter(func(key string, _ interface{}) pegparser.IterateActionType {
+				if !before[key] {
+					added = append(added, key)
+				}
+				return pegparser.IterateActionContinue
+			}, nonCommentsFilter)
+			if len(added) != 1 {
+				t.Fatalf("added build files %v, want one", added)
+			}
+			uuid := added[0]
+			fileRef := p.pbxBuildFileSection.GetObject(uuid).GetString("fileRef")
+			if fileRef == uuid {
+				t.Fatalf("build file and file reference share the uuid %s", uuid)
+			}
+			if !p.pbxFileReferenceSection.Has(fileRef) {
+				t.Errorf("file reference %s missing", fileRef)
+			}
+			for _, key := range []string{uuid, fileRef} {
+				if _, ok := p.uuids[key]; !ok {
+					t.Errorf("uuid %s not registered", key)
+				}
+			}
+		})
+	}
+}
+
+func TestAddTargetStandardBuildPhases(t *testing.T) {
+	standard := []string{"PBXSourcesBuildPhase", "PBXFrameworksBuildPhase", "PBXResourcesBuildPhase"}
+	tests := []struct {
+		targetType string
+		want       []string
+	}{
+		{"application", standard},
+		{"framework", standard},
+		{"app_extension", standard},
+		{"static_library", nil},
+		{"bundle", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.targetType, func(t *testing.T) {
+			p := loadExampleProject(t)
+			if err := p.AddTarget("Extra", tt.targetType, "Extra", ""); err != nil {
+				t.Fatal(err)
+			}
+			p = reparse(t, p)
+			buildPhases, _ := p.pbxNativeTargetSection.GetObject(p.findTargetKey("Extra")).ForceGet("buildPhases").([]interface{})
+			got := []string{}
+			for _, buildPhase := range buildPhases {
+				got = append(got, p.objectByKey(buildPhase.(pegparser.Object).GetString("value")).GetString("isa"))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("build phases = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("build phases = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+// widgetTemplate is a project with the single application target Widget, reusing uuids of the
+// example project: its target has the app target's uuid and Widget.swift AppDelegate.swift's.
+const widgetTemplate = `// !$*UTF8*$!
+{
+	archiveVersion = 1;
+	classes = {
+	};
+	objectVersion = 55;
+	objects = {
+
+/* Begin PBXBuildFile section */
+		BB0000000000000000000001 /* Widget.swift in Sources */ = {isa = PBXBuildFile; fileRef = 046BD63F27EC51880044E784 /* Widget.swift */; };
+/* End PBXBuildFile section */
+
+/* Begin PBXFileReference section */
+		046BD63F27EC51880044E784 /* Widget.swift */ = {isa = PBXFileReference; lastKnownFileType = sourcecode.swift; path = Widget.swift; sourceTree = "<group>"; };
+		BB0000000000000000000002 /* Widget.app */ = {isa = PBXFileReference; explicitFileType = wrapper.application; includeInIndex = 0; path = Widget.app; sourceTree = BUILT_PRODUCTS_DIR; };
+/* End PBXFileReference section */
+
+/* Begin PBXGroup section */
+		BB0000000000000000000003 = {
+			isa = PBXGroup;
+			children = (
+				BB0000000000000000000004 /* Widget */,
+				BB0000000000000000000005 /* Products */,
+			);
+			sourceTree = "<group>";
+		};
+		BB0000000000000000000004 /* Widget */ = {
+			isa = PBXGroup;
+			children = (
+				046BD63F27EC51880044E784 /* Widget.swift */,
+			);
+			path = Widget;
+			sourceTree = "<group>";
+		};
+		BB0000000000000000000005 /* Products */ = {
+			isa = PBXGroup;
+			children = (
+				BB0000000000000000000002 /* Widget.app */,
+			);
+			name = Products;
+			sourceTree = "<group>";
+		};
+/* End PBXGroup section */
+
+/* Begin PBXNativeTarget section */
+		046BD63B27EC51880044E784 /* Widget */ = {
+			isa = PBXNativeTarget;
+			buildConfigurationList = BB0000000000000000000008 /* Build configuration list for PBXNativeTarget "Widget" */;
+			buildPhases = (
+				BB0000000000000000000006 /* Sources */,
+			);
+			buildRules = (
+			);
+			dependencies = (
+			);
+			name = Widget;
+			productName = Widget;
+			productReference = BB0000000000000000000002 /* Widget.app */;
+			productType = "com.apple.product-type.application";
+		};
+/* End PBXNativeTarget section */
+
+/* Begin PBXProject section */
+		046BD63427EC51880044E784 /* Project object */ = {
+			isa = PBXProject;
+			buildConfigurationList = BB0000000000000000000007 /* Build configuration list for PBXProject "Widget" */;
+			compatibilityVersion = "Xcode 13.0";
+			mainGroup = BB0000000000000000000003;
+			productRefGroup = BB0000000000000000000005 /* Products */;
+			projectDirPath = "";
+			projectRoot = "";
+			targets = (
+				046BD63B27EC51880044E784 /* Widget */,
+			);
+		};
+/* End PBXProject section */
+
+/* Begin PBXSourcesBuildPhase section */
+		BB0000000000000000000006 /* Sources */ = {
+			isa = PBXSourcesBuildPhase;
+			buildActionMask = 2147483647;
+			files = (
+				BB0000000000000000000001 /* Widget.swift in Sources */,
+			);
+			runOnlyForDeploymentPostprocessing = 0;
+		};
+/* End PBXSourcesBuildPhase section */
+
+/* Begin XCBuildConfiguration section */
+		BB0000000000000000000009 /* Debug */ = {
+			isa = XCBuildConfiguration;
+			buildSettings = {
+			};
+			name = Debug;
+		};
+		BB000000000000000000000A /* Debug */ = {
+			isa = XCBuildConfiguration;
+			buildSettings = {
+				PRODUCT_NAME = "$(TARGET_NAME)";
+			};
+			name = Debug;
+		};
+/* End XCBuildConfiguration section */
+
+/* Begin XCConfigurationList section */
+		BB0000000000000000000007 /* Build configuration list for PBXProject "Widget" */ = {
+			isa = XCConfigurationList;
+			buildConfigurations = (
+				BB0000000000000000000009 /* Debug */,
+			);
+			defaultConfigurationIsVisible = 0;
+			defaultConfigurationName = Debug;
+		};
+		BB0000000000000000000008 /* Build configuration list for PBXNativeTarget "Widget" */ = {
+			isa = XCConfigurationList;
+			buildConfigurations = (
+				BB000000000000000000000A /* Debug */,
+			);
+			defaultConfigurationIsVisible = 0;
+			defaultConfigurationName = Debug;
+		};
+/* End XCConfigurationList section */
+	};
+	rootObject = 046BD63427EC51880044E784 /* Project object */;
+}
+`
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		groupName string
+	}{
+		{"into the main group", ""},
+		{"into a new group", "Template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			template := NewPbxProject("")
+			if err := template.ReparseBytes([]byte(widgetTemplate)); err != nil {
+				t.Fatal(err)
+			}
+			templateBefore := string(NewPbxWriter(&template).Bytes())
+			if err := p.Merge(&template, MergeOptions{GroupName: tt.groupName}); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(NewPbxWriter(&template).Bytes()); got != templateBefore {
+				t.Error("Merge changed the merged project")
+			}
+
+			p = reparse(t, p)
+			appKey, widgetKey := p.findTargetKey("DWebBrowser"), p.findTargetKey("Widget")
+			if appKey != exampleAppTargetKey {
+				t.Errorf("DWebBrowser target = %s, want %s", appKey, exampleAppTargetKey)
+			}
+			if widgetKey == "" || widgetKey == appKey {
+				t.Fatalf("Widget target = %q, want a uuid of its own", widgetKey)
+			}
+			if got := listValues(p.getFirstProject().Object, "targets"); len(got) != 4 || got[3] != widgetKey {
+				t.Errorf("project targets = %v, want Widget appended", got)
+			}
+			if got := len(p.ObjectsByISA("PBXProject")); got != 1 {
+				t.Errorf("%d project objects, want 1", got)
+			}
+
+			// the colliding file reference got a new uuid, AppDelegate.swift keeps its own
+			if got := unquoted(p.pbxFileReferenceSection.GetObject("046BD63F27EC51880044E784").GetString("path")); got != "AppDelegate.swift" {
+				t.Errorf("046BD63F27EC51880044E784 path = %q, want AppDelegate.swift", got)
+			}
+			widget, ok := p.FileReferenceByPath("Widget.swift")
+			if !ok {
+				t.Fatal("Widget.swift not merged")
+			}
+			sources := p.pbxSourcesBuildPhaseObj(widgetKey)
+			buildFiles := listValues(sources, "files")
+			if len(buildFiles) != 1 || p.pbxBuildFileSection.GetObject(buildFiles[0]).GetString("fileRef") != widget.UUID {
+				t.Errorf("Widget sources = %v, want the build file of %s", buildFiles, widget.UUID)
+			}
+
+			productRef := p.pbxNativeTargetSection.GetObject(widgetKey).GetString("productReference")
+			if !containsString(listValues(p.getPBXGroupByKey(exampleProductsGroupKey), "children"), productRef) {
+				t.Errorf("Products group misses the product %s", productRef)
+			}
+			widgetGroup := p.findPBXGroupKey(FindGroupCriteria{Path: "Widget"})
+			parentGroup := exampleMainGroupKey
+			if tt.groupName != "" {
+				parentGroup = p.findPBXGroupKey(FindGroupCriteria{Name: tt.groupName})
+				if !containsString(listValues(p.getPBXGroupByKey(exampleMainGroupKey), "children"), parentGroup) {
+					t.Errorf("main group misses the group %s", tt.groupName)
+				}
+			}
+			if !containsString(listValues(p.getPBXGroupByKey(parentGroup), "children"), widgetGroup) {
+				t.Errorf("group %s misses the Widget group %s", parentGroup, widgetGroup)
+			}
+
+			// merging again would duplicate the target
+			if err := p.Merge(&template, MergeOptions{}); err == nil {
+				t.Error("merging a target twice succeeded")
+			}
+		})
+	}
+}
+
+func TestSetBuildSetting(t *testing.T) {
+	tests := []struct {
+		name    string
+		prop    string
+		value   interface{}
+		written string
+		want    interface{}
+	}{
+		{"bool true", "ENABLE_BITCODE", true, "ENABLE_BITCODE = YES;", "YES"},
+		{"bool false", "ENABLE_BITCODE", false, "ENABLE_BITCODE = NO;", "NO"},
+		{"int", "TARGETED_DEVICE_FAMILY", 2, "TARGETED_DEVICE_FAMILY = 2;", int64(2)},
+		{"string with spaces", "PRODUCT_NAME", "My App", `PRODUCT_NAME = "My App";`, `"My App"`},
+		{"quoted string", "PRODUCT_NAME", `"My App"`, `PRODUCT_NAME = "My App";`, `"My App"`},
+		{"plain string", "SWIFT_VERSION", "5.7", "SWIFT_VERSION = 5.7;", "5.7"},
+		{"float", "SWIFT_VERSION", 5.7, "SWIFT_VERSION = 5.7;", "5.7"},
+		{"whole float", "SWIFT_VERSION", 4.0, "SWIFT_VERSION = 4.0;", "4.0"},
+		{"quoted string with escaped quotes", "INFOPLIST_KEY_NSHumanReadableCopyright", `"say \"hi\""`,
+			`INFOPLIST_KEY_NSHumanReadableCopyright = "say \"hi\"";`, `"say \"hi\""`},
+		{"string array", "OTHER_LDFLAGS", []string{"-ObjC", "$(inherited)"},
+			"OTHER_LDFLAGS = (\n\t\t\t\t\t\"-ObjC\",\n\t\t\t\t\t\"$(inherited)\",\n\t\t\t\t);",
+			[]interface{}{`"-ObjC"`, `"$(inherited)"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			p.SetBuildSetting(tt.prop, tt.value, "Debug", "DWebBrowser")
+			if data := string(NewPbxWriter(p).Bytes()); !strings.Contains(data, tt.written) {
+				t.Errorf("output lacks %q", tt.written)
+			}
+
+			p = reparse(t, p)
+			for _, configuration := range p.buildConfigurations("", "DWebBrowser") {
+				got, ok := configuration.GetObject("buildSettings").Get(tt.prop)
+				if configuration.GetString("name") != "Debug" {
+					if ok && reflect.DeepEqual(got, tt.want) {
+						t.Errorf("%s %s set too", configuration.GetString("name"), tt.prop)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s = %#v, want %#v", tt.prop, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRootProject(t *testing.T) {
+	tests := []struct {
+		name           string
+		project        func(t *testing.T) *PbxProject
+		wantUUID       string
+		wantUpgrade    int
+		wantAttributes int
+	}{
+		{"example", loadExampleProject, exampleProjectKey, 1320, 3},
+		{"without attributes", func(t *testing.T) *PbxProject {
+			return loadExampleProjectWith(t, "\t\t\tattributes = {", "\t\t\tunknownAttributes = {")
+		}, exampleProjectKey, 0, 0},
+		{"not parsed", func(t *testing.T) *PbxProject {
+			p := NewPbxProject("")
+			return &p
+		}, "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.project(t)
+			root := p.RootProject()
+			if root.UUID != tt.wantUUID {
+				t.Errorf("RootProject().UUID = %q, want %q", root.UUID, tt.wantUUID)
+			}
+			if tt.wantUUID != "" {
+				if got := root.GetString("isa"); got != "PBXProject" {
+					t.Errorf("isa = %q, want PBXProject", got)
+				}
+				if got := p.Contents().GetObject("project").GetString("rootObject"); got != root.UUID {
+					t.Errorf("rootObject = %q, want %q", got, root.UUID)
+				}
+			}
+			attributes := p.ProjectAttributes()
+			if got := attributes.GetInt("LastUpgradeCheck"); got != tt.wantUpgrade {
+				t.Errorf("LastUpgradeCheck = %d, want %d", got, tt.wantUpgrade)
+			}
+			if got := attributes.GetObject("TargetAttributes").Size(); got != tt.wantAttributes {
+				t.Errorf("TargetAttributes has %d targets, want %d", got, tt.wantAttributes)
+			}
+		})
+	}
+}
+
+func TestSetProvisioningStyleAndDevelopmentTeam(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		targetKey string
+		style     string
+		team      string
+		wantErr   bool
+	}{
+		{"app automatic", "DWebBrowser", exampleAppTargetKey, "Automatic", "AB12CD34EF", false},
+		{"tests manual", "DWebBrowserTests", exampleTestsTargetKey, "Manual", "AB12CD34EF", false},
+		{"invalid style", "DWebBrowser", exampleAppTargetKey, "Sometimes", "AB12CD34EF", true},
+		{"missing target", "Missing", "", "Automatic", "AB12CD34EF", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			err := p.SetProvisioningStyle(tt.target, tt.style)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetProvisioningStyle error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if err := p.SetDevelopmentTeam(tt.target, tt.team); err != nil {
+				t.Fatal(err)
+			}
+
+			attributes := reparse(t, p).ProjectAttributes().GetObject("TargetAttributes").GetObject(tt.targetKey)
+			if got := attributes.GetString("ProvisioningStyle"); got != tt.style {
+				t.Errorf("ProvisioningStyle = %q, want %q", got, tt.style)
+			}
+			if got := attributes.GetString("DevelopmentTeam"); got != tt.team {
+				t.Errorf("DevelopmentTeam = %q, want %q", got, tt.team)
+			}
+			if got := attributes.GetString("CreatedOnToolsVersion"); got != "13.2.1" {
+				t.Errorf("CreatedOnToolsVersion = %q, want it kept", got)
+			}
+		})
+	}
+
+	if err := loadExampleProject(t).SetDevelopmentTeam("Missing", "AB12CD34EF"); err == nil {
+		t.Error("SetDevelopmentTeam of a missing target succeeded")
+	}
+
+	// the target attributes are created when the project has none
+	p := loadExampleProjectWith(t, "\t\t\t\tTargetAttributes = {", "\t\t\t\tOtherAttributes = {")
+	if err := p.SetProvisioningStyle("DWebBrowser", "Manual"); err != nil {
+		t.Fatal(err)
+	}
+	targetAttributes := reparse(t, p).ProjectAttributes().GetObject("TargetAttributes")
+	if got := targetAttributes.GetObject(exampleAppTargetKey).GetString("ProvisioningStyle"); got != "Manual" || targetAttributes.Size() != 1 {
+		t.Errorf("TargetAttributes = %v, want the app's ProvisioningStyle only", targetAttributes)
+	}
+}
+
+func TestEmptyObjectsSurviveRoundTrip(t *testing.T) {
+	data := string(readExampleProject(t))
+	start := strings.Index(data, "\t\t\tattributes = {\n")
+	end := strings.Index(data, "\t\t\tbuildConfigurationList = 046BD63727EC51880044E784")
+	if start < 0 || end < start {
+		t.Fatal("example project lacks the project attributes")
+	}
+	withAttributes := func(attributes string) string {
+		return data[:start] + attributes + data[end:]
+	}
+	tests := []struct {
+		name    string
+		data    string
+		written string
+	}{
+		{"empty attributes", withAttributes("\t\t\tattributes = {\n\t\t\t};\n"), "\t\t\tattributes = {\n\t\t\t};\n"},
+		{"empty inline attributes", withAttributes("\t\t\tattributes = { };\n"), "\t\t\tattributes = {\n\t\t\t};\n"},
+		{"empty target attributes", withAttributes("\t\t\tattributes = {\n\t\t\t\tTargetAttributes = {\n\t\t\t\t};\n\t\t\t};\n"),
+			"\t\t\tattributes = {\n\t\t\t\tTargetAttributes = {\n\t\t\t\t};\n\t\t\t};\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPbxProject("")
+			if err := p.ReparseBytes([]byte(tt.data)); err != nil {
+				t.Fatal(err)
+			}
+			written := string(NewPbxWriter(&p).Bytes())
+			if !strings.Contains(written, tt.written) {
+				t.Errorf("output lacks %q", tt.written)
+			}
+			again := reparse(t, &p)
+			if !again.RootProject().Has("attributes") {
+				t.Fatal("attributes lost")
+			}
+			if got := string(NewPbxWriter(again).Bytes()); got != written {
+				t.Error("writing the reparsed project changed the output")
+			}
+
+			// the empty attributes are the ones target attributes are added to
+			if err := again.AddTargetAttribute("ProvisioningStyle", "Manual", pegparser.ObjectWithUUID{UUID: exampleAppTargetKey}); err != nil {
+				t.Fatal(err)
+			}
+			if got := again.ProjectAttributes().GetObject("TargetAttributes").GetObject(exampleAppTargetKey).GetString("ProvisioningStyle"); got != "Manual" {
+				t.Errorf("ProvisioningStyle = %q, want Manual", got)
+			}
+		})
+	}
+}
+
+func TestQuotedObjectKeys(t *testing.T) {
+	const (
+		appDelegateKey = "046BD63F27EC51880044E784"
+		appGroupKey    = "046BD63E27EC51880044E784"
+	)
+	tests := []struct {
+		name          string
+		replacements  []string
+		wantAggregate bool
+	}{
+		{"unquoted", nil, false},
+		{"quoted uuids", []string{
+			"\t\t" + appDelegateKey + " /* AppDelegate.swift */ = {isa = PBXFileReference;",
+			"\t\t\"" + appDelegateKey + "\" /* AppDelegate.swift */ = {isa = PBXFileReference;",
+			"\t\t" + appGroupKey + " /* DWebBrowser */ = {\n",
+			"\t\t\"" + appGroupKey + "\" /* DWebBrowser */ = {\n",
+		}, false},
+		{"quoted section", []string{
+			"\tobjects = {\n",
+			"\tobjects = {\n\t\t\"PBXAggregateTarget\" = {\n\t\t\t\"AA0000000000000000000001\" /* Lint */ = {isa = PBXAggregateTarget; name = Lint; };\n\t\t};\n",
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProjectWith(t, tt.replacements...)
+			fileReference, ok := p.FileReferenceByPath("AppDelegate.swift")
+			if !ok || fileReference.UUID != appDelegateKey {
+				t.Errorf("AppDelegate.swift = %q, want %s", fileReference.UUID, appDelegateKey)
+			}
+			if got := p.pbxFileReferenceSection.GetString(toCommentKey(appDelegateKey)); got != "AppDelegate.swift" {
+				t.Errorf("file reference comment = %q, want AppDelegate.swift", got)
+			}
+			if got := p.findPBXGroupKey(FindGroupCriteria{Path: "DWebBrowser"}); got != appGroupKey {
+				t.Errorf("DWebBrowser group = %q, want %s", got, appGroupKey)
+			}
+			for _, key := range []string{appDelegateKey, appGroupKey} {
+				if _, ok := p.uuids[key]; !ok {
+					t.Errorf("uuid %s not registered", key)
+				}
+			}
+			data := string(NewPbxWriter(p).Bytes())
+			if strings.Contains(data, `"`+appDelegateKey+`"`) || strings.Contains(data, `"`+appGroupKey+`"`) {
+				t.Error("output keeps the quoted uuids")
+			}
+			if tt.wantAggregate {
+				if objects := p.ObjectsByISA("PBXAggregateTarget"); len(objects) != 1 || objects[0].UUID != "AA0000000000000000000001" {
+					t.Errorf("aggregate targets = %v, want AA0000000000000000000001", objects)
+				}
+				if !p.pbxObjectSection.Has("PBXAggregateTarget") {
+					t.Error("the quoted section name was not unquoted")
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateBuildProperty(t *testing.T) {
+	tests := []struct {
+		name   string
+		build  string
+		target string
+		want   []string
+	}{
+		{"all configurations", "", "", []string{"Debug", "Release", "Debug", "Release", "Debug", "Release", "Debug", "Release"}},
+		{"debug configurations", "Debug", "", []string{"Debug", "Debug", "Debug", "Debug"}},
+		{"target", "", "DWebBrowser", []string{"Debug", "Release"}},
+		{"target debug configuration", "Debug", "DWebBrowser", []string{"Debug"}},
+		{"missing target", "", "Missing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			p.UpdateBuildProperty("MY_SETTING", "YES", tt.build, tt.target)
+			p = reparse(t, p)
+
+			// the configuration lists are left alone, UpdateBuildProperty used to write there
+			p.pbxXCConfigurationListSection.ForeachWithFilter(func(key string, value interface{}) pegparser.IterateActionType {
+				if value.(pegparser.Object).Has("MY_SETTING") {
+					t.Errorf("configuration list %s got MY_SETTING", key)
+				}
+				return pegparser.IterateActionContinue
+			}, nonCommentsFilter)
+
+			got := []string{}
+			for _, configuration := range p.buildConfigurations("", "") {
+				if configuration.GetObject("buildSettings").GetString("MY_SETTING") == "YES" {
+					got = append(got, configuration.GetString("name"))
+				}
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("configurations with MY_SETTING = %v, want %v", got, tt.want)
+			}
+			if tt.target != "" {
+				for _, configuration := range p.buildConfigurations("", tt.target) {
+					if tt.build == "" || configuration.GetString("name") == tt.build {
+						if !configuration.GetObject("buildSettings").Has("MY_SETTING") {
+							t.Errorf("%s %s misses MY_SETTING", tt.target, configuration.GetString("name"))
+						}
+					}
+				}
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ package pbxproj
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"reflect"
 	"strings"
@@ -42,6 +43,14 @@ func WithOmitEmpty() PbxWriterOption {
 	}
 }
 
+// WithSortedSectionEntries writes the entries of every section sorted by UUID, like Xcode does,
+// instead of in parse order with new entries last. The project itself is not reordered.
+func WithSortedSectionEntries() PbxWriterOption {
+	return func(w *PbxWriter) {
+		w.sortSectionEntries = true
+	}
+}
+
 func WithStringWriter(writer StringWriter) PbxWriterOption {
 	return func(w *PbxWriter) {
 		w.stringWriter = writer
@@ -49,11 +58,12 @@ func WithStringWriter(writer StringWriter) PbxWriterOption {
 }
 
 type PbxWriter struct {
-	stringWriter    StringWriter
-	omitEmptyValues bool
-	contents        pegparser.Object
-	sync            bool
-	indentLevel     int
+	stringWriter       StringWriter
+	omitEmptyValues    bool
+	sortSectionEntries bool
+	contents           pegparser.Object
+	sync               bool
+	indentLevel        int
 }
 
 func NewPbxWriter(project *PbxProject, options ...PbxWriterOption) *PbxWriter {
@@ -69,43 +79,68 @@ func NewPbxWriter(project *PbxProject, options ...PbxWriterOption) *PbxWriter {
 	return w
 }
 
-func indent(x int) string {
-	if x <= 0 {
-		return ""
-	} else {
-		return INDENT + indent(x-1)
-	}
-}
-
 func getComment(key string, parent pegparser.Object) string {
 	return parent.GetString(toCommentKey(key))
 }
 
+// commentedKey appends the key's comment, e.g. for objects and arrays read as `key /* cmt */ = {`
+func commentedKey(key, cmt string) string {
+	if cmt == "" {
+		return key
+	}
+	return fmt.Sprintf("%s /* %s */", key, cmt)
+}
+
 // func (w *PbxWriter) writeString(str string) {
 // 	_, _ = w.stringWriter.WriteString(str)
 // }
 func (w *PbxWriter) writeFormatString(format string, str ...string) {
+	if len(str) == 0 && !strings.Contains(format, "%") {
+		_, _ = w.stringWriter.WriteString(format)
+		return
+	}
+	// format straight into the underlying buffer when it supports it, saving an intermediate string per line
+	if iw, ok := w.stringWriter.(io.Writer); ok {
+		_, _ = fmt.Fprintf(iw, format, stringToInterfaceSlice(str)...)
+		return
+	}
 	_, _ = w.stringWriter.WriteString(fmt.Sprintf(format, stringToInterfaceSlice(str)...))
 }
 
+func (w *PbxWriter) writeIndent(level int) {
+	for i := 0; i < level; i++ {
+		_, _ = w.stringWriter.WriteString(INDENT)
+	}
+}
+
 func (w PbxWriter) write(format string, str ...string) {
-	fmtStr := fmt.Sprintf(format, stringToInterfaceSlice(str)...)
-	w.writeFormatString("%s%s", indent(w.indentLevel), fmtStr)
+	w.writeIndent(w.indentLevel)
+	w.writeFormatString(format, str...)
 }
 
 func (w PbxWriter) writeNoIndent(format string, str ...string) {
-	fmtStr := fmt.Sprintf(format, stringToInterfaceSlice(str)...)
-	w.writeFormatString("%s%s", indent(0), fmtStr)
+	w.writeFormatString(format, str...)
 }
 
 func (w *PbxWriter) Write(filePath string) error {
+	return os.WriteFile(filePath, w.Bytes(), 0644)
+}
+
+// Bytes renders the project without writing it to disk. Every call renders it again, the
+// output of earlier calls is dropped from writers with a Reset method like strings.Builder.
+func (w *PbxWriter) Bytes() []byte {
+	if r, ok := w.stringWriter.(interface{ Reset() }); ok {
+		r.Reset()
+	}
+	w.indentLevel = 0
 	w.writeHeadComment()
 	w.writeProject()
-	return os.WriteFile(filePath, []byte(w.stringWriter.String()), 0644)
+	return []byte(w.stringWriter.String())
 }
 
 func (w *PbxWriter) writeHeadComment() {
-	comment := w.contents.GetString("headComment")
+	// the output is plain UTF-8, a BOM set on the contents is never written
+	comment := strings.TrimPrefix(w.contents.GetString("headComment"), "\uFEFF")
 	if comment != "" {
 		w.writeNoIndent("// %s\n", comment)
 	}
@@ -120,9 +155,9 @@ func (w *PbxWriter) writeProject() {
 	proj.ForeachWithFilter(func(key string, val interface{}) pegparser.IterateActionType {
 		cmt := getComment(key, proj)
 		if isArray(val) {
-			w.writeArray(toArray(val), key)
+			w.writeArray(toArray(val), commentedKey(key, cmt))
 		} else if isObject(val) {
-			w.write("%s = {\n", key)
+			w.write("%s = {\n", commentedKey(key, cmt))
 			w.indentLevel++
 			if key == "objects" {
 				w.writeObjectsSections(toObject(val))
@@ -168,9 +203,9 @@ func (w PbxWriter) writeObject(obj pegparser.Object) {
 	obj.ForeachWithFilter(func(key string, val interface{}) pegparser.IterateActionType {
 		cmt := getComment(key, obj)
 		if isArray(val) {
-			w.writeArray(toArray(val), key)
+			w.writeArray(toArray(val), commentedKey(key, cmt))
 		} else if isObject(val) {
-			w.write("%s = {\n", key)
+			w.write("%s = {\n", commentedKey(key, cmt))
 			w.indentLevel++
 			w.writeObject(toObject(val))
 			w.indentLevel--
@@ -235,6 +270,8 @@ func (w PbxWriter) writeArray(arr []interface{}, name string) {
 			comment := val.GetString("comment")
 			if value != "" && comment != "" {
 				w.write("%s /* %s */,\n", value, comment)
+			} else if value != "" && isCommentValue(val) {
+				w.write("%s,\n", value)
 			} else {
 				w.write("{\n")
 				w.indentLevel++
@@ -243,7 +280,11 @@ func (w PbxWriter) writeArray(arr []interface{}, name string) {
 				w.write("},\n")
 			}
 		} else if isString(obj) {
-			w.write("%s,\n", obj.(string))
+			str := obj.(string)
+			if str == "" {
+				str = `""`
+			}
+			w.write("%s,\n", str)
 		} else if isInt(obj) {
 			w.write("%s,\n", toIntString(obj))
 		} else {
@@ -255,6 +296,16 @@ func (w PbxWriter) writeArray(arr []interface{}, name string) {
 	w.write(");\n")
 }
 
+// isCommentValue tells a list entry like CommentValue, holding only value and comment, from a nested object.
+func isCommentValue(obj pegparser.Object) bool {
+	for _, key := range []string{"value", "comment"} {
+		if obj.Has(key) && !isString(obj.ForceGet(key)) {
+			return false
+		}
+	}
+	return obj.Size() == 1 && obj.Has("value") || obj.Size() == 2 && obj.Has("value") && obj.Has("comment")
+}
+
 func (w PbxWriter) writeSectionComment(name string, begin bool) {
 	if begin {
 		w.writeNoIndent("/* Begin %s section */\n", name)
@@ -264,7 +315,7 @@ func (w PbxWriter) writeSectionComment(name string, begin bool) {
 }
 
 func (w PbxWriter) writeSection(section pegparser.Object) {
-	section.ForeachWithFilter(func(key string, val interface{}) pegparser.IterateActionType {
+	writeEntry := func(key string, val interface{}) pegparser.IterateActionType {
 		cmt := getComment(key, section)
 		if !isObject(val) {
 			return pegparser.IterateActionContinue
@@ -286,7 +337,18 @@ func (w PbxWriter) writeSection(section pegparser.Object) {
 			w.write("};\n")
 		}
 		return pegparser.IterateActionContinue
-	}, nonCommentsFilter)
+	}
+
+	if w.sortSectionEntries {
+		section.ForeachSorted(func(key string, val interface{}) pegparser.IterateActionType {
+			if !nonCommentsFilter(key, val) {
+				return pegparser.IterateActionContinue
+			}
+			return writeEntry(key, val)
+		})
+		return
+	}
+	section.ForeachWithFilter(writeEntry, nonCommentsFilter)
 }
 
 func (w PbxWriter) writeInlineObjectHelp(buffer *[]string, name string, desc string, ref pegparser.Object) {
@@ -300,9 +362,24 @@ func (w PbxWriter) writeInlineObjectHelp(buffer *[]string, name string, desc str
 	ref.ForeachWithFilter(func(key string, val interface{}) pegparser.IterateActionType {
 		cmt := getComment(key, ref)
 		if isArray(val) {
-			output = append(output, fmt.Sprintf("%s = (", key))
-			output = append(output, strings.Join(interfaceToStringSlice(val), ","))
-			output = append(output, "),")
+			output = append(output, fmt.Sprintf("%s = (", commentedKey(key, cmt)))
+			for _, item := range toArray(val) {
+				if isObject(item) {
+					ref := toObject(item)
+					if comment := ref.GetString("comment"); comment != "" {
+						output = append(output, fmt.Sprintf("%s /* %s */, ", ref.GetString("value"), comment))
+					} else {
+						output = append(output, ref.GetString("value")+", ")
+					}
+				} else if isInt(item) {
+					output = append(output, toIntString(item)+", ")
+				} else if item == "" {
+					output = append(output, `"", `)
+				} else {
+					output = append(output, fmt.Sprintf("%v, ", item))
+				}
+			}
+			output = append(output, "); ")
 		} else if isObject(val) {
 			w.writeInlineObjectHelp(&output, key, cmt, val.(pegparser.Object))
 		} else if isString(val) {
@@ -332,7 +409,7 @@ func (w PbxWriter) writeInlineObjectHelp(buffer *[]string, name string, desc str
 		return pegparser.IterateActionContinue
 	}, nonCommentsFilter)
 
-	output = append(output, "};")
+	output = append(output, "}; ")
 	*buffer = output
 }
 
@@ -0,0 +1,271 @@
+package pbxproj
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/soapywu/pbxproj/pegparser"
+)
+
+func TestWriteIntegralFloats(t *testing.T) {
+	p := loadExampleProject(t)
+	var dump bytes.Buffer
+	if err := p.Dump(&dump); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(dump.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	objects := decoded["project"].(map[string]interface{})["objects"].(map[string]interface{})
+	phase := objects["PBXFrameworksBuildPhase"].(map[string]interface{})["046BD63927EC51880044E784"].(map[string]interface{})
+	buildActionMask, ok := phase["buildActionMask"].(float64)
+	if !ok {
+		t.Fatalf("decoded buildActionMask = %#v, want a float64", phase["buildActionMask"])
+	}
+
+	// put the decoded values back, as a project loaded from the JSON dump holds them
+	frameworksPhase := p.pbxFrameworksBuildPhaseObj(exampleAppTargetKey)
+	frameworksPhase.Set("buildActionMask", buildActionMask)
+	frameworksPhase.Set("runOnlyForDeploymentPostprocessing", phase["runOnlyForDeploymentPostprocessing"])
+
+	data := string(NewPbxWriter(p).Bytes())
+	for _, want := range []string{"buildActionMask = 2147483647;", "runOnlyForDeploymentPostprocessing = 0;"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("output lacks %s", want)
+		}
+	}
+	if got := reparse(t, p).pbxFrameworksBuildPhaseObj(exampleAppTargetKey).GetInt("buildActionMask"); got != 2147483647 {
+		t.Errorf("buildActionMask = %d, want 2147483647", got)
+	}
+}
+
+func TestWriteKeepsComments(t *testing.T) {
+	comments := []struct {
+		old string
+		new string
+	}{
+		{"buildSettings = {", "buildSettings /* unusual */ = {"},
+		{"files = (", "files /* odd */ = ("},
+		{"knownRegions = (", "knownRegions /* languages */ = ("},
+		{"mainGroup = 046BD63327EC51880044E784;", "mainGroup = 046BD63327EC51880044E784 /* main */;"},
+	}
+	replacements := []string{}
+	for _, comment := range comments {
+		replacements = append(replacements, comment.old, comment.new)
+	}
+	p := loadExampleProjectWith(t, replacements...)
+
+	// twice, the second write starts from parsed output
+	for i := 0; i < 2; i++ {
+		data := string(NewPbxWriter(p).Bytes())
+		for _, comment := range comments {
+			if !strings.Contains(data, comment.new) {
+				t.Errorf("write %d lacks %s", i+1, comment.new)
+			}
+		}
+		p = reparse(t, p)
+	}
+}
+
+func TestWriteNeverEmitsBOM(t *testing.T) {
+	example := readExampleProject(t)
+	tests := []struct {
+		name        string
+		data        []byte
+		headComment string
+	}{
+		{"bom fixture", append([]byte("\xEF\xBB\xBF"), example...), ""},
+		{"bom in head comment", example, "\uFEFF!$*UTF8*$!"},
+		{"bom in custom head comment", example, "\uFEFFgenerated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFixture(t, t.TempDir(), "project.pbxproj", tt.data)
+			p := loadProject(t, path)
+			if tt.headComment != "" {
+				p.SetHeadComment(tt.headComment)
+			}
+			data := NewPbxWriter(p).Bytes()
+			if !bytes.HasPrefix(data, []byte("// ")) {
+				t.Fatalf("output starts with %q, want the head comment", data[:8])
+			}
+			if bytes.Contains(data, []byte("\uFEFF")) {
+				t.Error("output contains a BOM")
+			}
+			// a second round trip is stable
+			if again := NewPbxWriter(reparse(t, p)).Bytes(); !bytes.Equal(again, data) {
+				t.Error("writing the reparsed project changed the output")
+			}
+		})
+	}
+}
+
+// sectionKeys returns the entry keys written between the begin and end comments of section.
+func sectionKeys(data, section string) []string {
+	begin := strings.Index(data, "/* Begin "+section+" section */\n")
+	end := strings.Index(data, "/* End "+section+" section */")
+	if begin < 0 || end < begin {
+		return nil
+	}
+	keys := []string{}
+	for _, line := range strings.Split(data[begin:end], "\n")[1:] {
+		if strings.HasPrefix(line, "\t\t") && !strings.HasPrefix(line, "\t\t\t") && !strings.HasPrefix(line, "\t\t}") {
+			keys = append(keys, strings.Fields(line)[0])
+		}
+	}
+	return keys
+}
+
+func TestWriteSortedSectionEntries(t *testing.T) {
+	p := loadExampleProject(t)
+	for _, path := range []string{"Zeta.swift", "Alpha.swift", "Mid.swift"} {
+		if err := p.AddSourceFile(path, PbxFileOptions{}, "046BD63E27EC51880044E784"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	example := string(readExampleProject(t))
+
+	tests := []struct {
+		name    string
+		options []PbxWriterOption
+		sorted  bool
+	}{
+		{"parse order", nil, false},
+		{"sorted", []PbxWriterOption{WithSortedSectionEntries()}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := string(NewPbxWriter(p, tt.options...).Bytes())
+			for _, section := range []string{"PBXBuildFile", "PBXFileReference"} {
+				keys := sectionKeys(data, section)
+				parsed := sectionKeys(example, section)
+				if len(keys) < len(parsed) {
+					t.Fatalf("%s has %d entries, want at least %d", section, len(keys), len(parsed))
+				}
+				// the new UUIDs are random, only the sorted output has a known order
+				if tt.sorted && !sort.StringsAreSorted(keys) {
+					t.Errorf("%s entries = %v, want them sorted", section, keys)
+				}
+				if !tt.sorted && !reflect.DeepEqual(keys[:len(parsed)], parsed) {
+					t.Errorf("%s entries = %v, want the parsed entries %v first", section, keys, parsed)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteInlineObjectArrays(t *testing.T) {
+	const reference = "path = ThirdViewController.swift; sourceTree = \"<group>\"; "
+	tests := []struct {
+		name  string
+		array string
+		want  string
+	}{
+		{"commented values", "(A1 /* First */, B2 /* Second */, )", "children = (A1 /* First */, B2 /* Second */, ); "},
+		{"values", "(A1, B2, )", "children = (A1, B2, ); "},
+		{"mixed", "(A1 /* First */, 3, \"\", \"a b\", )", "children = (A1 /* First */, 3, \"\", \"a b\", ); "},
+		{"empty", "()", "children = (); "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProjectWith(t, reference, reference+"children = "+tt.array+"; ")
+			data := string(NewPbxWriter(p).Bytes())
+			if !strings.Contains(data, "/* ThirdViewController.swift */ = {isa = PBXFileReference; ") ||
+				!strings.Contains(data, tt.want) {
+				t.Errorf("output lacks the inline array %q", tt.want)
+			}
+			// the written array parses back to the same entries
+			again := string(NewPbxWriter(reparse(t, p)).Bytes())
+			if again != data {
+				t.Error("writing the reparsed project changed the output")
+			}
+		})
+	}
+}
+
+func TestWriteEmptyStringArrayElements(t *testing.T) {
+	const projectDebugKey = "046BD66427EC518A0044E784"
+	tests := []struct {
+		name  string
+		array []interface{}
+		want  []string
+	}{
+		{"only", []interface{}{""}, []string{`""`}},
+		{"first", []interface{}{"", "-ObjC"}, []string{`""`, "-ObjC"}},
+		{"last", []interface{}{`"$(inherited)"`, ""}, []string{`"$(inherited)"`, `""`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			buildSettings := p.pbxXCBuildConfigurationSection.GetObject(projectDebugKey).GetObject("buildSettings")
+			buildSettings.Set("OTHER_LDFLAGS", tt.array)
+
+			data := string(NewPbxWriter(p).Bytes())
+			if strings.Contains(data, "\t,\n") {
+				t.Error("output has an element without a value")
+			}
+			buildSettings = reparse(t, p).pbxXCBuildConfigurationSection.GetObject(projectDebugKey).GetObject("buildSettings")
+			if got := listValues(buildSettings, "OTHER_LDFLAGS"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OTHER_LDFLAGS = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkWrite writes a project with a thousand extra source files, run it with -benchmem to
+// compare allocations.
+func BenchmarkWrite(b *testing.B) {
+	p := NewPbxProject(exampleProjectPath)
+	if err := p.Parse(); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := p.AddSourceFile(fmt.Sprintf("Generated/File%d.swift", i), PbxFileOptions{}, "046BD63E27EC51880044E784"); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewPbxWriter(&p).Bytes()
+	}
+}
+
+func TestWriteArrayValueEntries(t *testing.T) {
+	const projectDebugKey = "046BD66427EC518A0044E784"
+	entry := func(items ...pegparser.SliceItem) pegparser.Object {
+		return pegparser.NewObjectWithData(items)
+	}
+	tests := []struct {
+		name  string
+		entry pegparser.Object
+		want  string
+	}{
+		{"value and comment", entry(pegparser.NewObjectItem("value", "A1"), pegparser.NewObjectItem("comment", "First")),
+			"\t\t\t\t\tA1 /* First */,\n"},
+		{"value and empty comment", entry(pegparser.NewObjectItem("value", "A1"), pegparser.NewObjectItem("comment", "")),
+			"\t\t\t\t\tA1,\n"},
+		{"value only", entry(pegparser.NewObjectItem("value", "A1")), "\t\t\t\t\tA1,\n"},
+		{"nested object", entry(pegparser.NewObjectItem("value", "A1"), pegparser.NewObjectItem("name", "B2")),
+			"\t\t\t\t\t{\n\t\t\t\t\t\tvalue = A1;\n\t\t\t\t\t\tname = B2;\n\t\t\t\t\t},\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			buildSettings := p.pbxXCBuildConfigurationSection.GetObject(projectDebugKey).GetObject("buildSettings")
+			buildSettings.Set("OTHER_LDFLAGS", []interface{}{tt.entry})
+
+			data := string(NewPbxWriter(p).Bytes())
+			if want := "OTHER_LDFLAGS = (\n" + tt.want + "\t\t\t\t);\n"; !strings.Contains(data, want) {
+				t.Errorf("output lacks %q", want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package pbxproj
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindTargetKey(t *testing.T) {
+	p := loadExampleProject(t)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"DWebBrowser", exampleAppTargetKey},
+		{`"DWebBrowser"`, exampleAppTargetKey},
+		{"DWebBrowserTests", exampleTestsTargetKey},
+		{"Missing", ""},
+	}
+	for _, tt := range tests {
+		if got := p.findTargetKey(tt.name); got != tt.want {
+			t.Errorf("findTargetKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddAggregateTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		wantName string
+		wantErr  bool
+	}{
+		{"plain", "Lint", "Lint", false},
+		{"with spaces", " Run Tools ", `"Run Tools"`, false},
+		{"empty", " ", "", true},
+		{"native target name", "DWebBrowser", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadExampleProject(t)
+			uuid, err := p.AddAggregateTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddAggregateTarget error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if got := len(p.ObjectsByISA("PBXAggregateTarget")); got != 0 {
+					t.Errorf("%d aggregate targets added", got)
+				}
+				return
+			}
+
+			p = reparse(t, p)
+			target := p.pbxObjectSection.GetObject("PBXAggregateTarget").GetObject(uuid)
+			if got := target.GetString("isa"); got != "PBXAggregateTarget" {
+				t.Fatalf("isa = %q, want PBXAggregateTarget", got)
+			}
+			if got := target.GetString("name"); got != tt.wantName {
+				t.Errorf("name = %q, want %q", got, tt.wantName)
+			}
+			if target.Has("productReference") || target.Has("productType") {
+				t.Error("aggregate target has a product")
+			}
+			if got := listValues(target, "buildPhases"); len(got) != 0 {
+				t.Errorf("buildPhases = %v, want none", got)
+			}
+			configurations := listValues(p.pbxXCConfigurationListSection.GetObject(target.GetString("buildConfigurationList")), "buildConfigurations")
+			if len(configurations) != 2 {
+				t.Errorf("buildConfigurations = %v, want Debug and Release", configurations)
+			}
+			if !containsString(listValues(p.getFirstProject().Object, "targets"), uuid) {
+				t.Errorf("project targets miss %s", uuid)
+			}
+			// a second target of the name is refused
+			if _, err := p.AddAggregateTarget(tt.target); err == nil {
+				t.Error("adding the aggregate target twice succeeded")
+			}
+		})
+	}
+}
+
+func TestTargetAPIsAcceptNameAndUUID(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(p *PbxProject, target string) interface{}
+	}{
+		{"ProductName", func(p *PbxProject, target string) interface{} { return p.ProductName(target) }},
+		{"ProductType", func(p *PbxProject, target string) interface{} { return p.ProductType(target) }},
+		{"ProductPath", func(p *PbxProject, target string) interface{} { return p.ProductPath(target) }},
+		{"TargetDependencies", func(p *PbxProject, target string) interface{} { return p.TargetDependencies(target) }},
+		{"BuildConfigurations", func(p *PbxProject, target string) interface{} {
+			names := []string{}
+			for _, config := range p.BuildConfigurations(target) {
+				names = append(names, config.Name)
+			}
+			return names
+		}},
+		{"ConfigurationList", func(p *PbxProject, target string) interface{} {
+			list, _ := p.ConfigurationList(target)
+			return list.UUID
+		}},
+		{"AddEntitlements", func(p *PbxProject, target string) interface{} {
+			if err := p.AddEntitlements("DWebBrowserTests/DWebBrowserTests.entitlements", target); err != nil {
+				return nil
+			}
+			values := []string{}
+			for _, configuration := range p.buildConfigurations("", exampleTestsTargetKey) {
+				values = append(values, configuration.GetObject("buildSettings").GetString("CODE_SIGN_ENTITLEMENTS"))
+			}
+			return values
+		}},
+	}
+	empty := func(v interface{}) bool {
+		value := reflect.ValueOf(v)
+		return !value.IsValid() || value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			byName := tt.call(loadExampleProject(t), "DWebBrowserTests")
+			byUUID := tt.call(loadExampleProject(t), exampleTestsTargetKey)
+			if empty(byName) {
+				t.Fatalf("%s(%q) = %#v", tt.name, "DWebBrowserTests", byName)
+			}
+			if !reflect.DeepEqual(byName, byUUID) {
+				t.Errorf("%s(%q) = %#v, %s(%q) = %#v", tt.name, "DWebBrowserTests", byName, tt.name, exampleTestsTargetKey, byUUID)
+			}
+			if got := tt.call(loadExampleProject(t), "Missing"); !empty(got) {
+				t.Errorf("%s(%q) = %#v, want nothing", tt.name, "Missing", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package pegparser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ParseError describes where the grammar failed to match the input.
+type ParseError struct {
+	Line    int
+	Column  int
+	Offset  int
+	Rule    string
+	Snippet string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("parse error at line %d, column %d (offset %d)", e.Line, e.Column, e.Offset)
+	if e.Rule != "" {
+		msg += ", rule " + e.Rule
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Snippet != "" {
+		msg += fmt.Sprintf(" near %q", e.Snippet)
+	}
+	return msg
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// NewParseError converts an error returned by Parse/ParseReader into a *ParseError,
+// using data to extract the offending line. Other errors are returned unchanged.
+func NewParseError(err error, data []byte) error {
+	var pe *parserError
+	switch e := err.(type) {
+	case errList:
+		for _, inner := range e {
+			if v, ok := inner.(*parserError); ok {
+				pe = v
+				break
+			}
+		}
+	case *parserError:
+		pe = e
+	}
+	if pe == nil {
+		return err
+	}
+
+	rule := ""
+	if idx := strings.LastIndex(pe.prefix, "rule "); idx >= 0 {
+		rule = pe.prefix[idx+len("rule "):]
+	}
+
+	return &ParseError{
+		Line:    pe.pos.line,
+		Column:  pe.pos.col,
+		Offset:  pe.pos.offset,
+		Rule:    rule,
+		Snippet: lineAt(data, pe.pos.offset),
+		Err:     pe.Inner,
+	}
+}
+
+func lineAt(data []byte, offset int) string {
+	if offset < 0 || offset > len(data) {
+		return ""
+	}
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	end := bytes.IndexByte(data[offset:], '\n')
+	if end < 0 {
+		end = len(data)
+	} else {
+		end += offset
+	}
+	return strings.TrimSpace(string(data[start:end]))
+}
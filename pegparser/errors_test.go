@@ -0,0 +1,50 @@
+package pegparser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewParseError(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		line    int
+		column  int
+		snippet string
+	}{
+		{"missing semicolon", "// !$*UTF8*$!\n{\n\ta = b\n\tc = d;\n}\n", 4, 2, "c = d;"},
+		{"missing value", "// !$*UTF8*$!\n{\n\ta = ;\n}\n", 3, 6, "a = ;"},
+		{"unterminated object", "// !$*UTF8*$!\n{\n\ta = {\n\t\tb = c;\n}\n", 6, 1, ""},
+		{"unterminated array", "// !$*UTF8*$!\n{\n\ta = (\n\t\tb,\n}\n", 6, 1, ""},
+		{"garbage", "not a project", 1, 1, "not a project"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("", []byte(tt.input))
+			if err == nil {
+				t.Fatal("Parse succeeded")
+			}
+			var pe *ParseError
+			if !errors.As(NewParseError(err, []byte(tt.input)), &pe) {
+				t.Fatalf("NewParseError(%v) is not a *ParseError", err)
+			}
+			if pe.Line != tt.line || pe.Column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", pe.Line, pe.Column, tt.line, tt.column)
+			}
+			if pe.Snippet != tt.snippet {
+				t.Errorf("Snippet = %q, want %q", pe.Snippet, tt.snippet)
+			}
+			if pe.Unwrap() == nil {
+				t.Error("Unwrap() = nil, want the parser error")
+			}
+		})
+	}
+}
+
+func TestNewParseErrorPassesOtherErrorsThrough(t *testing.T) {
+	err := errors.New("read failed")
+	if got := NewParseError(err, nil); got != err {
+		t.Errorf("NewParseError(%v) = %v, want the error unchanged", err, got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"reflect"
+	"sort"
 )
 
 type IterateActionType = int8
@@ -105,6 +106,8 @@ func (o Object) GetInt(key string) int {
 		switch value.(type) {
 		case int, int8, int16, int32, int64:
 			return int(reflect.ValueOf(value).Int())
+		case float32, float64:
+			return int(reflect.ValueOf(value).Float())
 		}
 	}
 	return 0
@@ -113,15 +116,18 @@ func (o Object) GetInt(key string) int {
 type ApplyFunc = func(key string, val interface{}) IterateActionType
 type FilterFunc = func(key string, val interface{}) bool
 
+// Foreach visits the items present when it starts, apply may Set and Delete keys of o:
+// deleted items are not visited anymore and replaced ones are visited with their new value.
 func (o Object) Foreach(apply ApplyFunc) {
 	if o.IsEmpty() {
 		return
 	}
-	for _, item := range o.Items() {
-		if item.data == nil {
+	for _, item := range o.snapshot() {
+		val, found := o.Get(item.key)
+		if !found || val == nil {
 			continue
 		}
-		action := apply(item.key.(string), item.data)
+		action := apply(item.key.(string), val)
 		if action == IterateActionBreak {
 			break
 		}
@@ -132,10 +138,10 @@ func (o Object) ForeachWithFilter(apply ApplyFunc, filter FilterFunc) {
 	if o.IsEmpty() {
 		return
 	}
-	for _, item := range o.Items() {
+	for _, item := range o.snapshot() {
 		key := item.key.(string)
-		val := item.data
-		if val == nil {
+		val, found := o.Get(key)
+		if !found || val == nil {
 			continue
 		}
 		if filter(key, val) {
@@ -147,6 +153,32 @@ func (o Object) ForeachWithFilter(apply ApplyFunc, filter FilterFunc) {
 	}
 }
 
+// snapshot copies the items, Delete shifts the backing array of Items() in place.
+func (o Object) snapshot() []*SliceItem {
+	return append([]*SliceItem{}, o.Items()...)
+}
+
+// ForeachSorted is Foreach in lexicographic key order instead of insertion order.
+func (o Object) ForeachSorted(apply ApplyFunc) {
+	if o.IsEmpty() {
+		return
+	}
+	items := o.snapshot()
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].key.(string) < items[j].key.(string)
+	})
+	for _, item := range items {
+		val, found := o.Get(item.key)
+		if !found || val == nil {
+			continue
+		}
+		action := apply(item.key.(string), val)
+		if action == IterateActionBreak {
+			break
+		}
+	}
+}
+
 func (o Object) Filter(f func(key string, val interface{}) bool) Object {
 	newObj := NewObject()
 	for _, item := range o.Items() {
@@ -159,6 +191,43 @@ func (o Object) Filter(f func(key string, val interface{}) bool) Object {
 	return newObj
 }
 
+// Clone returns a deep copy of the object, nested objects and arrays included.
+func (o Object) Clone() Object {
+	clone := NewObject()
+	if o.SliceMap == nil {
+		return clone
+	}
+	for _, item := range o.Items() {
+		clone.Set(item.key, cloneValue(item.data))
+	}
+	return clone
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Object:
+		return v.Clone()
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = cloneValue(item)
+		}
+		return arr
+	default:
+		return v
+	}
+}
+
+// SortKeysFunc reorders the object's keys, e.g. a section by UUID like Xcode writes it.
+func (o Object) SortKeysFunc(less func(a, b string) bool) {
+	if o.IsEmpty() {
+		return
+	}
+	o.Sort(func(a, b interface{}) bool {
+		return less(a.(string), b.(string))
+	})
+}
+
 func merge_obj(obj Object, secondObj Object) Object {
 	for _, item := range secondObj.Items() {
 		key := item.key.(string)
@@ -0,0 +1,152 @@
+package pegparser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestObjectSortKeysFunc(t *testing.T) {
+	section := NewObject()
+	for _, key := range []string{"C3", "A1", "B2"} {
+		section.Set(key, NewObject())
+		section.Set(key+"_comment", strings.ToLower(key))
+	}
+	// by uuid, each comment right after its object
+	section.SortKeysFunc(func(a, b string) bool {
+		ka, kb := strings.TrimSuffix(a, "_comment"), strings.TrimSuffix(b, "_comment")
+		if ka != kb {
+			return ka < kb
+		}
+		return !strings.HasSuffix(a, "_comment") && strings.HasSuffix(b, "_comment")
+	})
+
+	want := []string{"A1", "A1_comment", "B2", "B2_comment", "C3", "C3_comment"}
+	items := section.Items()
+	if len(items) != len(want) {
+		t.Fatalf("%d items, want %d", len(items), len(want))
+	}
+	for i, item := range items {
+		if item.key != want[i] {
+			t.Errorf("items[%d] = %v, want %s", i, item.key, want[i])
+		}
+		if idx := section.IndexOf(item.key); idx != i {
+			t.Errorf("IndexOf(%v) = %d, want %d", item.key, idx, i)
+		}
+	}
+	if got := section.GetString("B2_comment"); got != "b2" {
+		t.Errorf("B2_comment = %q, want b2", got)
+	}
+
+	// sorting an empty object is a no-op
+	Object{}.SortKeysFunc(func(a, b string) bool { return a < b })
+}
+
+func TestObjectForeachSorted(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		stop string
+		want []string
+	}{
+		{"shuffled", []string{"C3", "A1", "b2", "B2", "A1_comment"}, "", []string{"A1", "A1_comment", "B2", "C3", "b2"}},
+		{"break", []string{"C3", "A1", "B2"}, "B2", []string{"A1", "B2"}},
+		{"empty", nil, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := NewObject()
+			for _, key := range tt.keys {
+				obj.Set(key, key)
+			}
+			var got []string
+			obj.ForeachSorted(func(key string, val interface{}) IterateActionType {
+				got = append(got, key)
+				if key == tt.stop {
+					return IterateActionBreak
+				}
+				return IterateActionContinue
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ForeachSorted visited %v, want %v", got, tt.want)
+			}
+			// the object keeps its insertion order
+			for i, item := range obj.Items() {
+				if item.key != tt.keys[i] {
+					t.Errorf("items[%d] = %v, want %s", i, item.key, tt.keys[i])
+				}
+			}
+		})
+	}
+}
+
+func TestObjectForeachMutation(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(obj Object, key string)
+		wantVisited []string
+		wantKeys    []string
+	}{
+		{"delete current", func(obj Object, key string) { obj.Delete(key) },
+			[]string{"A", "B", "C", "D"}, []string{}},
+		{"delete current B", func(obj Object, key string) {
+			if key == "B" {
+				obj.Delete(key)
+			}
+		}, []string{"A", "B", "C", "D"}, []string{"A", "C", "D"}},
+		{"delete next", func(obj Object, key string) {
+			if key == "B" {
+				obj.Delete("C")
+			}
+		}, []string{"A", "B", "D"}, []string{"A", "B", "D"}},
+		{"set new keys", func(obj Object, key string) { obj.Set(key+"_comment", key) },
+			[]string{"A", "B", "C", "D"}, []string{"A", "B", "C", "D", "A_comment", "B_comment", "C_comment", "D_comment"}},
+		{"move current", func(obj Object, key string) {
+			if key == "A" {
+				obj.MoveKey("A", 3)
+			}
+		}, []string{"A", "B", "C", "D"}, []string{"B", "C", "D", "A"}},
+	}
+	foreaches := []struct {
+		name    string
+		foreach func(obj Object, apply ApplyFunc)
+	}{
+		{"Foreach", func(obj Object, apply ApplyFunc) { obj.Foreach(apply) }},
+		{"ForeachWithFilter", func(obj Object, apply ApplyFunc) {
+			obj.ForeachWithFilter(apply, func(string, interface{}) bool { return true })
+		}},
+		{"ForeachSorted", func(obj Object, apply ApplyFunc) { obj.ForeachSorted(apply) }},
+	}
+	for _, foreach := range foreaches {
+		for _, tt := range tests {
+			t.Run(foreach.name+"/"+tt.name, func(t *testing.T) {
+				obj := NewObject()
+				for _, key := range []string{"A", "B", "C", "D"} {
+					obj.Set(key, key)
+				}
+				visited := []string{}
+				foreach.foreach(obj, func(key string, val interface{}) IterateActionType {
+					if val != key {
+						t.Errorf("%s = %v", key, val)
+					}
+					visited = append(visited, key)
+					tt.mutate(obj, key)
+					return IterateActionContinue
+				})
+				if !reflect.DeepEqual(visited, tt.wantVisited) {
+					t.Errorf("visited %v, want %v", visited, tt.wantVisited)
+				}
+				keys := []string{}
+				for i, item := range obj.Items() {
+					keys = append(keys, item.key.(string))
+					if idx := obj.IndexOf(item.key); idx != i {
+						t.Errorf("IndexOf(%v) = %d, want %d", item.key, idx, i)
+					}
+				}
+				if !reflect.DeepEqual(keys, tt.wantKeys) {
+					t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+				}
+			})
+		}
+	}
+}
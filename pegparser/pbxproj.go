@@ -45,6 +45,14 @@ func charsToString(v interface{}) string {
 	return strings.Join(result, "")
 }
 
+// trimValue trims string values; objects, arrays and numbers are returned as is.
+func trimValue(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return strings.TrimSpace(s)
+	}
+	return v
+}
+
 var g = &grammar{
 	rules: []*rule{
 		{
@@ -262,8 +270,12 @@ var g = &grammar{
 								name: "Value",
 							},
 						},
+						&ruleRefExpr{
+							pos:  position{line: 89, col: 53, offset: 2439},
+							name: "_",
+						},
 						&litMatcher{
-							pos:        position{line: 89, col: 53, offset: 2439},
+							pos:        position{line: 89, col: 55, offset: 2441},
 							val:        ";",
 							ignoreCase: false,
 							want:       "\";\"",
@@ -328,8 +340,12 @@ var g = &grammar{
 								name: "Value",
 							},
 						},
+						&ruleRefExpr{
+							pos:  position{line: 97, col: 75, offset: 2681},
+							name: "_",
+						},
 						&litMatcher{
-							pos:        position{line: 97, col: 75, offset: 2681},
+							pos:        position{line: 97, col: 77, offset: 2683},
 							val:        ";",
 							ignoreCase: false,
 							want:       "\";\"",
@@ -377,8 +393,12 @@ var g = &grammar{
 								name: "CommentedValue",
 							},
 						},
+						&ruleRefExpr{
+							pos:  position{line: 106, col: 75, offset: 3019},
+							name: "_",
+						},
 						&litMatcher{
-							pos:        position{line: 106, col: 75, offset: 3019},
+							pos:        position{line: 106, col: 77, offset: 3021},
 							val:        ";",
 							ignoreCase: false,
 							want:       "\";\"",
@@ -815,11 +835,20 @@ var g = &grammar{
 			expr: &choiceExpr{
 				pos: position{line: 182, col: 18, offset: 5207},
 				alternatives: []interface{}{
-					&litMatcher{
-						pos:        position{line: 182, col: 18, offset: 5207},
-						val:        ",",
-						ignoreCase: false,
-						want:       "\",\"",
+					&seqExpr{
+						pos: position{line: 182, col: 18, offset: 5207},
+						exprs: []interface{}{
+							&ruleRefExpr{
+								pos:  position{line: 182, col: 18, offset: 5207},
+								name: "_",
+							},
+							&litMatcher{
+								pos:        position{line: 182, col: 20, offset: 5209},
+								val:        ",",
+								ignoreCase: false,
+								want:       "\",\"",
+							},
+						},
 					},
 					&seqExpr{
 						pos: position{line: 182, col: 24, offset: 5213},
@@ -984,9 +1013,24 @@ var g = &grammar{
 						},
 						&notExpr{
 							pos: position{line: 198, col: 38, offset: 5612},
-							expr: &ruleRefExpr{
-								pos:  position{line: 198, col: 39, offset: 5613},
-								name: "NonTerminator",
+							expr: &seqExpr{
+								pos: position{line: 198, col: 40, offset: 5614},
+								exprs: []interface{}{
+									&zeroOrMoreExpr{
+										pos: position{line: 198, col: 40, offset: 5614},
+										expr: &charClassMatcher{
+											pos:        position{line: 198, col: 40, offset: 5614},
+											val:        "[ \\t]",
+											chars:      []rune{' ', '\t'},
+											ignoreCase: false,
+											inverted:   false,
+										},
+									},
+									&ruleRefExpr{
+										pos:  position{line: 198, col: 48, offset: 5622},
+										name: "NonTerminator",
+									},
+								},
 							},
 						},
 					},
@@ -1439,7 +1483,7 @@ func (p *parser) callonAssignmentList1() (interface{}, error) {
 func (c *current) onSimpleAssignment1(id, val interface{}) (interface{}, error) {
 
 	result := NewObject()
-	result.Set(id.(string), val)
+	result.Set(id.(string), trimValue(val))
 	return result, nil
 }
 
@@ -1454,7 +1498,7 @@ func (c *current) onCommentedAssignment11(commentedId, val interface{}) (interfa
 	result := NewObject()
 	commentKey := commentedId.(Object).GetString("id") + "_comment"
 
-	result.Set(commentedId.(Object).GetString("id"), val)
+	result.Set(commentedId.(Object).GetString("id"), trimValue(val))
 	result.Set(commentKey, commentedId.(Object).ForceGet(commentKey))
 	return result, nil
 }
@@ -1497,7 +1541,7 @@ func (c *current) onCommentedValue1(literal, comment interface{}) (interface{},
 
 	result := NewObject()
 	result.Set("comment", strings.TrimSpace(comment.(string)))
-	result.Set("value", strings.TrimSpace(literal.(string)))
+	result.Set("value", trimValue(literal))
 	return result, nil
 }
 
@@ -1596,7 +1640,7 @@ func (p *parser) callonArrayBody1() (interface{}, error) {
 
 func (c *current) onSimpleArrayEntry1(val interface{}) (interface{}, error) {
 
-	return val, nil
+	return trimValue(val), nil
 }
 
 func (p *parser) callonSimpleArrayEntry1() (interface{}, error) {
@@ -1608,7 +1652,7 @@ func (p *parser) callonSimpleArrayEntry1() (interface{}, error) {
 func (c *current) onCommentedArrayEntry1(val, comment interface{}) (interface{}, error) {
 
 	result := NewObject()
-	result.Set("value", strings.TrimSpace(val.(string)))
+	result.Set("value", trimValue(val))
 	result.Set("comment", strings.TrimSpace(comment.(string)))
 	return result, nil
 }
@@ -0,0 +1,127 @@
+package pegparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func parseProjectBody(t *testing.T, body string) Object {
+	t.Helper()
+	input := "// !$*UTF8*$!\n{\n" + body + "\n}\n"
+	result, err := Parse("", []byte(input))
+	if err != nil {
+		t.Fatalf("parse %q: %v", body, NewParseError(err, []byte(input)))
+	}
+	return result.(Object).GetObject("project")
+}
+
+func TestParseAssignmentWhitespace(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		key     string
+		value   interface{}
+		comment string
+	}{
+		{"tight", "a=b;", "a", "b", ""},
+		{"spaces", "a = b;", "a", "b", ""},
+		{"space before semicolon", "a = b ;", "a", "b", ""},
+		{"tabs", "a\t=\tb\t;", "a", "b", ""},
+		{"newlines", "a\n=\nb\n;", "a", "b", ""},
+		{"quoted", `a = "b c" ;`, "a", `"b c"`, ""},
+		{"integer", "a = 46;", "a", int64(46), ""},
+		{"integer space before semicolon", "a = 46 ;", "a", int64(46), ""},
+		{"integer newline before semicolon", "a = 46\n;", "a", int64(46), ""},
+		{"digits and letters", "a = 46 b;", "a", "46 b", ""},
+		{"commented identifier", "X /* c */ = b;", "X", "b", "c"},
+		{"commented identifier space before semicolon", "X /* c */ = b ;", "X", "b", "c"},
+		{"commented identifier tight", "X/* c */=b;", "X", "b", "c"},
+		{"commented value", "fileRef = X /* c */;", "fileRef", "X", "c"},
+		{"commented value space before semicolon", "fileRef = X /* c */ ;", "fileRef", "X", "c"},
+		{"commented value tabs", "fileRef\t=\tX\t/* c */\t;", "fileRef", "X", "c"},
+		{"commented value tight", "fileRef=X/* c */;", "fileRef", "X", "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := parseProjectBody(t, tt.body)
+			if got := project.ForceGet(tt.key); !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("%s = %#v, want %#v", tt.key, got, tt.value)
+			}
+			if got := project.GetString(tt.key + "_comment"); got != tt.comment {
+				t.Errorf("%s_comment = %q, want %q", tt.key, got, tt.comment)
+			}
+		})
+	}
+}
+
+func TestParseArrayWhitespace(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []interface{}
+	}{
+		{"empty", "a = ();", []interface{}{}},
+		{"empty with blanks", "a = ( \n );", []interface{}{}},
+		{"tight", "a = (b,c,);", []interface{}{"b", "c"}},
+		{"no trailing comma", `a = ("b", "c");`, []interface{}{`"b"`, `"c"`}},
+		{"space before comma", "a = (b , c ,);", []interface{}{"b", "c"}},
+		{"tabs", "a = (\tb\t,\tc\t,\t);", []interface{}{"b", "c"}},
+		{"newlines", "a = (\n\tb,\n\tc,\n);", []interface{}{"b", "c"}},
+		{"space before closing paren", `a = (b, "c" );`, []interface{}{"b", `"c"`}},
+		{"integers", "a = (1 , 2\t,\n3,);", []interface{}{int64(1), int64(2), int64(3)}},
+		{"integer newline before closing paren", "a = (1\n);", []interface{}{int64(1)}},
+		{"last integer without trailing comma", "a = (1,\n2\n);", []interface{}{int64(1), int64(2)}},
+		{"quoted", `a = ("b c" , "" ,);`, []interface{}{`"b c"`, `""`}},
+		{"commented", "a = (b /* c */, d /* e */ ,);", []interface{}{
+			NewObjectWithData([]SliceItem{NewObjectItem("value", "b"), NewObjectItem("comment", "c")}),
+			NewObjectWithData([]SliceItem{NewObjectItem("value", "d"), NewObjectItem("comment", "e")}),
+		}},
+		{"commented no trailing comma", "a = (b /* c */ );", []interface{}{
+			NewObjectWithData([]SliceItem{NewObjectItem("value", "b"), NewObjectItem("comment", "c")}),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := parseProjectBody(t, tt.body).ForceGet("a").([]interface{})
+			if len(got) != len(tt.want) {
+				t.Fatalf("a = %#v, want %#v", got, tt.want)
+			}
+			for i := range got {
+				if !equalValue(got[i], tt.want[i]) {
+					t.Errorf("a[%d] = %#v, want %#v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func equalValue(a, b interface{}) bool {
+	objA, okA := a.(Object)
+	objB, okB := b.(Object)
+	if !okA || !okB {
+		return reflect.DeepEqual(a, b)
+	}
+	if objA.Size() != objB.Size() {
+		return false
+	}
+	for _, item := range objA.Items() {
+		if !equalValue(item.data, objB.ForceGet(item.key)) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseSpacesFixture(t *testing.T) {
+	tabs, err := ParseFile("../example/project.pbxproj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spaces, err := ParseFile("testdata/spaces.pbxproj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalValue(tabs.(Object).ForceGet("project"), spaces.(Object).ForceGet("project")) {
+		t.Error("spaces.pbxproj parsed differently from the example project")
+	}
+}
@@ -1,5 +1,7 @@
 package pegparser
 
+import "sort"
+
 type mapItem struct {
 	data interface{}
 	idx  int
@@ -23,6 +25,9 @@ func NewSliceMap() *SliceMap {
 }
 
 func (m *SliceMap) ForceGet(key interface{}) interface{} {
+	if m == nil {
+		return nil
+	}
 	v, found := m.mp[key]
 	if found {
 		return v.data
@@ -32,6 +37,9 @@ func (m *SliceMap) ForceGet(key interface{}) interface{} {
 }
 
 func (m *SliceMap) Get(key interface{}) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
 	v, found := m.mp[key]
 	if found {
 		return v.data, true
@@ -61,6 +69,9 @@ func (m *SliceMap) Set(key, v interface{}) {
 }
 
 func (m *SliceMap) Has(key interface{}) bool {
+	if m == nil {
+		return false
+	}
 	_, found := m.mp[key]
 	return found
 }
@@ -70,6 +81,15 @@ func (m *SliceMap) Delete(key interface{}) {
 	if found {
 		m.sl = append(m.sl[0:old.idx], m.sl[old.idx+1:]...)
 		delete(m.mp, key)
+		m.reindex(old.idx)
+	}
+}
+
+// reindex refreshes the positions stored in mp for the items from idx on,
+// they shift after a deletion.
+func (m *SliceMap) reindex(idx int) {
+	for i := idx; i < len(m.sl); i++ {
+		m.mp[m.sl[i].key].idx = i
 	}
 }
 
@@ -88,7 +108,7 @@ func (m *SliceMap) Items() []*SliceItem {
 }
 
 func (m *SliceMap) GetAt(idx int) (interface{}, bool) {
-	if idx >= len(m.sl) {
+	if idx < 0 || idx >= len(m.sl) {
 		return nil, false
 	}
 	val := m.sl[idx].data
@@ -96,9 +116,58 @@ func (m *SliceMap) GetAt(idx int) (interface{}, bool) {
 }
 
 func (m *SliceMap) DeleteAt(idx int) {
-	if idx < len(m.sl) {
+	if idx >= 0 && idx < len(m.sl) {
 		old := m.sl[idx]
 		m.sl = append(m.sl[0:idx], m.sl[idx+1:]...)
 		delete(m.mp, old.key)
+		m.reindex(idx)
+	}
+}
+
+// IndexOf returns the position of key, or -1 when it is missing.
+func (m *SliceMap) IndexOf(key interface{}) int {
+	if m == nil {
+		return -1
+	}
+	if v, found := m.mp[key]; found {
+		return v.idx
 	}
+	return -1
+}
+
+// MoveKey moves key to position toIndex, shifting the items in between.
+func (m *SliceMap) MoveKey(key interface{}, toIndex int) {
+	old, found := m.mp[key]
+	if !found || toIndex < 0 || toIndex >= len(m.sl) || toIndex == old.idx {
+		return
+	}
+	item := m.sl[old.idx]
+	if toIndex < old.idx {
+		copy(m.sl[toIndex+1:old.idx+1], m.sl[toIndex:old.idx])
+		m.sl[toIndex] = item
+		m.reindex(toIndex)
+	} else {
+		copy(m.sl[old.idx:toIndex], m.sl[old.idx+1:toIndex+1])
+		m.sl[toIndex] = item
+		m.reindex(old.idx)
+	}
+}
+
+// RenameKey replaces key by newKey in place, nothing happens when key is missing or newKey exists.
+func (m *SliceMap) RenameKey(key, newKey interface{}) {
+	old, found := m.mp[key]
+	if !found || m.Has(newKey) {
+		return
+	}
+	m.sl[old.idx] = &SliceItem{key: newKey, data: old.data}
+	delete(m.mp, key)
+	m.mp[newKey] = old
+}
+
+// Sort reorders the items by key, keeping the relative order of equal keys.
+func (m *SliceMap) Sort(less func(a, b interface{}) bool) {
+	sort.SliceStable(m.sl, func(i, j int) bool {
+		return less(m.sl[i].key, m.sl[j].key)
+	})
+	m.reindex(0)
 }
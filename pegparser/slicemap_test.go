@@ -0,0 +1,179 @@
+package pegparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newSliceMapOf(keys ...string) *SliceMap {
+	m := NewSliceMap()
+	for i, key := range keys {
+		m.Set(key, i)
+	}
+	return m
+}
+
+// checkSliceMap asserts the keys and values in order and that every stored position is right.
+func checkSliceMap(t *testing.T, m *SliceMap, keys []string, values []interface{}) {
+	t.Helper()
+	gotKeys := []string{}
+	gotValues := []interface{}{}
+	for i, item := range m.Items() {
+		gotKeys = append(gotKeys, item.key.(string))
+		gotValues = append(gotValues, item.data)
+		if idx := m.IndexOf(item.key); idx != i {
+			t.Errorf("IndexOf(%v) = %d, want %d", item.key, idx, i)
+		}
+		if v := m.ForceGet(item.key); v != item.data {
+			t.Errorf("ForceGet(%v) = %v, want %v", item.key, v, item.data)
+		}
+	}
+	if !reflect.DeepEqual(gotKeys, keys) {
+		t.Errorf("keys = %v, want %v", gotKeys, keys)
+	}
+	if !reflect.DeepEqual(gotValues, values) {
+		t.Errorf("values = %v, want %v", gotValues, values)
+	}
+}
+
+func TestSliceMapDeleteThenSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		ops    func(m *SliceMap)
+		keys   []string
+		values []interface{}
+	}{
+		{"delete first, update last", func(m *SliceMap) {
+			m.Delete("a")
+			m.Set("d", "D")
+		}, []string{"b", "c", "d"}, []interface{}{1, 2, "D"}},
+		{"delete middle, update next", func(m *SliceMap) {
+			m.Delete("b")
+			m.Set("c", "C")
+		}, []string{"a", "c", "d"}, []interface{}{0, "C", 3}},
+		{"delete twice, update and append", func(m *SliceMap) {
+			m.Delete("a")
+			m.Delete("c")
+			m.Set("d", "D")
+			m.Set("e", "E")
+		}, []string{"b", "d", "e"}, []interface{}{1, "D", "E"}},
+		{"delete then delete later key", func(m *SliceMap) {
+			m.Delete("a")
+			m.Delete("d")
+		}, []string{"b", "c"}, []interface{}{1, 2}},
+		{"delete missing", func(m *SliceMap) {
+			m.Delete("x")
+		}, []string{"a", "b", "c", "d"}, []interface{}{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newSliceMapOf("a", "b", "c", "d")
+			tt.ops(m)
+			checkSliceMap(t, m, tt.keys, tt.values)
+		})
+	}
+}
+
+func TestSliceMapDeleteAt(t *testing.T) {
+	tests := []struct {
+		name   string
+		ops    func(m *SliceMap)
+		keys   []string
+		values []interface{}
+	}{
+		{"delete first, update last", func(m *SliceMap) {
+			m.DeleteAt(0)
+			m.Set("d", "D")
+		}, []string{"b", "c", "d"}, []interface{}{1, 2, "D"}},
+		{"delete at, then delete by key", func(m *SliceMap) {
+			m.DeleteAt(1)
+			m.Delete("c")
+			m.Set("d", "D")
+		}, []string{"a", "d"}, []interface{}{0, "D"}},
+		{"delete at, append, delete at", func(m *SliceMap) {
+			m.DeleteAt(0)
+			m.Set("e", 4)
+			m.DeleteAt(2)
+			m.Set("e", "E")
+		}, []string{"b", "c", "e"}, []interface{}{1, 2, "E"}},
+		{"delete last", func(m *SliceMap) {
+			m.DeleteAt(3)
+		}, []string{"a", "b", "c"}, []interface{}{0, 1, 2}},
+		{"out of range", func(m *SliceMap) {
+			m.DeleteAt(-1)
+			m.DeleteAt(4)
+		}, []string{"a", "b", "c", "d"}, []interface{}{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newSliceMapOf("a", "b", "c", "d")
+			tt.ops(m)
+			checkSliceMap(t, m, tt.keys, tt.values)
+		})
+	}
+}
+
+func TestSliceMapMoveKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		toIndex int
+		keys    []string
+	}{
+		{"d", 0, []string{"d", "a", "b", "c"}},
+		{"a", 3, []string{"b", "c", "d", "a"}},
+		{"b", 2, []string{"a", "c", "b", "d"}},
+		{"c", 1, []string{"a", "c", "b", "d"}},
+		{"b", 1, []string{"a", "b", "c", "d"}},
+		{"b", 4, []string{"a", "b", "c", "d"}},
+		{"b", -1, []string{"a", "b", "c", "d"}},
+		{"x", 0, []string{"a", "b", "c", "d"}},
+	}
+	for _, tt := range tests {
+		m := newSliceMapOf("a", "b", "c", "d")
+		m.MoveKey(tt.key, tt.toIndex)
+		values := []interface{}{}
+		for _, key := range tt.keys {
+			values = append(values, int(key[0]-'a'))
+		}
+		checkSliceMap(t, m, tt.keys, values)
+		m.Set(tt.keys[0], "first")
+		if got, _ := m.GetAt(0); got != "first" {
+			t.Errorf("MoveKey(%q, %d): Set on the first key wrote elsewhere", tt.key, tt.toIndex)
+		}
+	}
+}
+
+func TestSliceMapRenameKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		ops    func(m *SliceMap)
+		keys   []string
+		values []interface{}
+	}{
+		{"rename middle", func(m *SliceMap) {
+			m.RenameKey("b", "x")
+		}, []string{"a", "x", "c", "d"}, []interface{}{0, 1, 2, 3}},
+		{"rename then set", func(m *SliceMap) {
+			m.RenameKey("a", "x")
+			m.Set("x", "X")
+			m.Set("a", "A")
+		}, []string{"x", "b", "c", "d", "a"}, []interface{}{"X", 1, 2, 3, "A"}},
+		{"rename after delete", func(m *SliceMap) {
+			m.Delete("a")
+			m.RenameKey("c", "x")
+		}, []string{"b", "x", "d"}, []interface{}{1, 2, 3}},
+		{"rename to existing key", func(m *SliceMap) {
+			m.RenameKey("a", "b")
+		}, []string{"a", "b", "c", "d"}, []interface{}{0, 1, 2, 3}},
+		{"rename missing", func(m *SliceMap) {
+			m.RenameKey("x", "y")
+		}, []string{"a", "b", "c", "d"}, []interface{}{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newSliceMapOf("a", "b", "c", "d")
+			tt.ops(m)
+			checkSliceMap(t, m, tt.keys, tt.values)
+		})
+	}
+}